@@ -8,8 +8,21 @@ import (
 	"github.com/davidjspooner/dshttp/pkg/logevent"
 	"github.com/davidjspooner/dsrepo/internal/forest"
 
+	_ "github.com/davidjspooner/dsrepo/internal/impl/apk"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/apt"
 	_ "github.com/davidjspooner/dsrepo/internal/impl/binary"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/cargo"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/conda"
 	_ "github.com/davidjspooner/dsrepo/internal/impl/container"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/goproxy"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/helm"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/maven"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/npm"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/nuget"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/proxy"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/pypi"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/rpm"
+	_ "github.com/davidjspooner/dsrepo/internal/impl/rubygems"
 	_ "github.com/davidjspooner/dsrepo/internal/impl/tfregistry"
 
 	_ "github.com/davidjspooner/dsfile/pkg/impl/localfs"
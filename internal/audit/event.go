@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/access"
+)
+
+type Action string
+
+const (
+	ActionPush      Action = "push"
+	ActionOverwrite Action = "overwrite"
+	ActionDelete    Action = "delete"
+	ActionAccess    Action = "access"
+)
+
+type Event struct {
+	Sequence   uint64    `json:"seq"`
+	Time       time.Time `json:"time"`
+	Action     Action    `json:"action"`
+	Repository string    `json:"repository"`
+	Type       string    `json:"type"`
+	Target     string    `json:"target"`
+	Operation  string    `json:"operation,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	// the BasicAuth user name of the request, it is not verified
+	ClaimedUser string            `json:"claimed_user"`
+	Remote      string            `json:"remote"`
+	Allowed     bool              `json:"allowed"`
+	Policy      access.PolicyName `json:"policy,omitempty"`
+	PrevHash    string            `json:"prev_hash"`
+	Hash        string            `json:"hash"`
+}
+
+func (e *Event) computeHash() (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	encoded, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
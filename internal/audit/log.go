@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+)
+
+type Config struct {
+	File  string            `yaml:"file"`
+	Store string            `yaml:"store"`
+	Args  map[string]string `yaml:"args"`
+}
+
+type Log struct {
+	sink     sink
+	lock     sync.Mutex
+	sequence uint64
+	lastHash string
+}
+
+func Open(ctx context.Context, config *Config) (*Log, error) {
+	var s sink
+	switch {
+	case config.File != "" && config.Store != "":
+		return nil, fmt.Errorf("audit: only one of file or store may be set")
+	case config.File != "":
+		fsink, err := openFileSink(config.File)
+		if err != nil {
+			return nil, err
+		}
+		s = fsink
+	case config.Store != "":
+		mounted, err := store.Mount(ctx, config.Store, config.Args)
+		if err != nil {
+			return nil, err
+		}
+		s = &storeSink{store: mounted}
+	default:
+		return nil, fmt.Errorf("audit: one of file or store must be set")
+	}
+	return newLog(s)
+}
+
+// newLog resumes the chain of s, a chain that does not verify is not extended
+func newLog(s sink) (*Log, error) {
+	log := &Log{sink: s}
+	result, last, err := verifyChain(s)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("audit: could not resume chain: %w", err)
+	}
+	if !result.Valid {
+		s.Close()
+		return nil, fmt.Errorf("audit: chain is broken at sequence %d: %s", result.Sequence, result.Error)
+	}
+	if last != nil {
+		log.sequence = last.Sequence
+		log.lastHash = last.Hash
+	}
+	return log, nil
+}
+
+func (log *Log) Record(event *Event) error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	event.Sequence = log.sequence + 1
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.PrevHash = log.lastHash
+	hash, err := event.computeHash()
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = log.sink.Append(event.Sequence, line)
+	if err != nil {
+		return err
+	}
+	log.sequence = event.Sequence
+	log.lastHash = event.Hash
+	return nil
+}
+
+func (log *Log) Close() error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	return log.sink.Close()
+}
+
+var current *Log
+
+// SetLog installs the log used by Record. A nil log disables auditing.
+func SetLog(log *Log) {
+	current = log
+}
+
+func Record(ctx context.Context, event *Event) {
+	if current == nil {
+		return
+	}
+	err := current.Record(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "audit:record", slog.String("target", event.Target), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogChain(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+	config := &Config{File: filename}
+
+	log, err := Open(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []Action{ActionPush, ActionOverwrite} {
+		err := log.Record(&Event{Action: action, Repository: "local-binaries", Target: "davidjspooner/tool", Size: 42})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+
+	// reopening must continue the chain rather than restart it
+	log, err = Open(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = log.Record(&Event{Action: ActionDelete, Repository: "local-binaries", Target: "davidjspooner/tool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := log.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Count != 3 {
+		t.Fatalf("Verify() = %+v, want 3 valid events", result)
+	}
+
+	events, err := log.Query(&Filter{Action: ActionDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Sequence != 3 || events[0].PrevHash == "" {
+		t.Fatalf("Query() = %+v, want the single chained delete event", events)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(content, []byte(`"size":42`), []byte(`"size":43`), 1)
+	if err := os.WriteFile(filename, tampered, 0640); err != nil {
+		t.Fatal(err)
+	}
+	result, err = log.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || result.Sequence != 1 {
+		t.Fatalf("Verify() = %+v, want tampering detected at sequence 1", result)
+	}
+	log.Close()
+
+	// a broken chain must not be extended
+	_, err = Open(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "sequence 1") {
+		t.Fatalf("Open() of a tampered log = %v, want a broken chain error", err)
+	}
+}
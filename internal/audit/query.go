@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Filter struct {
+	Repository  string
+	Action      Action
+	ClaimedUser string
+	Target      string
+	Since       time.Time
+	Limit       int
+}
+
+func (f *Filter) Match(event *Event) bool {
+	if f.Repository != "" && f.Repository != event.Repository {
+		return false
+	}
+	if f.Action != "" && f.Action != event.Action {
+		return false
+	}
+	if f.ClaimedUser != "" && f.ClaimedUser != event.ClaimedUser {
+		return false
+	}
+	if f.Target != "" && f.Target != event.Target {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Query returns the most recent events matching the filter, oldest first
+func (log *Log) Query(filter *Filter) ([]*Event, error) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	events := []*Event{}
+	err := log.sink.ReadAll(func(line []byte) error {
+		event := &Event{}
+		if err := json.Unmarshal(line, event); err != nil {
+			return err
+		}
+		if filter.Match(event) {
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Count    uint64 `json:"count"`
+	Sequence uint64 `json:"seq,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Verify walks the whole chain checking sequence numbers and hashes
+func (log *Log) Verify() (*VerifyResult, error) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	result, _, err := verifyChain(log.sink)
+	return result, err
+}
+
+// verifyChain also returns the last event of a valid chain
+func verifyChain(s sink) (*VerifyResult, *Event, error) {
+	result := &VerifyResult{Valid: true}
+	var last *Event
+	prevHash := ""
+	err := s.ReadAll(func(line []byte) error {
+		if !result.Valid {
+			return nil
+		}
+		event := &Event{}
+		if err := json.Unmarshal(line, event); err != nil {
+			return err
+		}
+		result.Count++
+		hash, err := event.computeHash()
+		if err != nil {
+			return err
+		}
+		switch {
+		case event.Sequence != result.Count:
+			result.Error = fmt.Sprintf("expected sequence %d", result.Count)
+		case event.PrevHash != prevHash:
+			result.Error = "previous hash does not match"
+		case event.Hash != hash:
+			result.Error = "hash does not match content"
+		default:
+			prevHash = event.Hash
+			last = event
+			return nil
+		}
+		result.Valid = false
+		result.Sequence = event.Sequence
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, last, nil
+}
+
+func (log *Log) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := &Filter{
+		Repository:  q.Get("repository"),
+		Action:      Action(q.Get("action")),
+		ClaimedUser: q.Get("user"),
+		Target:      q.Get("target"),
+		Limit:       100,
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	events, err := log.Query(filter)
+	if err != nil {
+		http.Error(w, "could not read audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func (log *Log) HandleVerify(w http.ResponseWriter, r *http.Request) {
+	result, err := log.Verify()
+	if err != nil {
+		http.Error(w, "could not read audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
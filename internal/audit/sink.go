@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+)
+
+type sink interface {
+	Append(seq uint64, line []byte) error
+	ReadAll(fn func(line []byte) error) error
+	Close() error
+}
+
+type fileSink struct {
+	path string
+	file *os.File
+}
+
+func openFileSink(filename string) (*fileSink, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: filename, file: f}, nil
+}
+
+func (fsink *fileSink) Append(seq uint64, line []byte) error {
+	_, err := fsink.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return fsink.file.Sync()
+}
+
+func (fsink *fileSink) ReadAll(fn func(line []byte) error) error {
+	f, err := os.Open(fsink.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (fsink *fileSink) Close() error {
+	return fsink.file.Close()
+}
+
+// storeSink writes one object per event since stores cannot append
+type storeSink struct {
+	store store.Interface
+}
+
+func (ssink *storeSink) Append(seq uint64, line []byte) error {
+	info := store.Info{
+		Size: int64(len(line)),
+		Mode: 0640,
+	}
+	wFile, err := ssink.store.Create(eventFilename(seq), info.FileInfo())
+	if err != nil {
+		return err
+	}
+	_, err = wFile.Write(line)
+	if err != nil {
+		wFile.Close()
+		return err
+	}
+	return wFile.Close()
+}
+
+func (ssink *storeSink) ReadAll(fn func(line []byte) error) error {
+	entries, err := fs.ReadDir(ssink.store, ".")
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && path.Ext(entry.Name()) == ".json" {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := ssink.store.Open(name)
+		if err != nil {
+			return err
+		}
+		line, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err := fn(bytes.TrimSpace(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ssink *storeSink) Close() error {
+	return nil
+}
+
+func eventFilename(seq uint64) string {
+	return fmt.Sprintf("%020d.json", seq)
+}
@@ -0,0 +1,167 @@
+package forest
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type AdminConfig struct {
+	Token string
+}
+
+// requireAdmin only lets requests through that carry the configured bearer token
+func (server *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected := server.config.Admin.Token
+		if !ok || expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dsrepo-admin"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type repositoryInfo struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Items    []string          `json:"items"`
+	Local    string            `json:"local,omitempty"`
+	Upstream string            `json:"upstream,omitempty"`
+	Members  []string          `json:"members,omitempty"`
+	Deploy   string            `json:"deploy,omitempty"`
+	Caches   map[string]int    `json:"caches"`
+	Actions  []string          `json:"actions"`
+	Usage    *repository.Usage `json:"usage,omitempty"`
+}
+
+func newRepositoryInfo(handler *repository.Handler) *repositoryInfo {
+	info := &repositoryInfo{
+		Name:    handler.Name,
+		Type:    handler.Type,
+		Items:   handler.Config.Items,
+		Local:   handler.Config.Local.Path,
+		Members: handler.Config.Members,
+		Deploy:  handler.Config.Deploy,
+		Caches:  handler.CacheCounts(),
+		Actions: []string{},
+	}
+	if handler.Upstream != nil {
+		info.Upstream = handler.Upstream.String()
+	}
+	if handler.CollectGarbage != nil {
+		info.Actions = append(info.Actions, "gc")
+	}
+	if handler.Reindex != nil {
+		info.Actions = append(info.Actions, "reindex")
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (server *Server) adminHandler(w http.ResponseWriter, r *http.Request) *repository.Handler {
+	handler := repository.LookupHandler(r.PathValue("name"))
+	if handler == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown repository"})
+	}
+	return handler
+}
+
+func (server *Server) setupAdminRoutes(auditLog *audit.Log) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		server.mux.HandleFunc(pattern, server.requireAdmin(handler))
+	}
+
+	handle("GET /admin/api/repositories", func(w http.ResponseWriter, r *http.Request) {
+		list := []*repositoryInfo{}
+		for _, handler := range repository.Handlers() {
+			list = append(list, newRepositoryInfo(handler))
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	handle("GET /admin/api/repositories/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handler := server.adminHandler(w, r)
+		if handler == nil {
+			return
+		}
+		info := newRepositoryInfo(handler)
+		usage, err := handler.Usage(r.Context())
+		if err != nil {
+			server.log.Error("admin:usage", slog.String("repository", handler.Name), slog.String("error", err.Error()))
+		}
+		info.Usage = usage
+		writeJSON(w, http.StatusOK, info)
+	})
+	handle("POST /admin/api/repositories/{name}/gc", func(w http.ResponseWriter, r *http.Request) {
+		handler := server.adminHandler(w, r)
+		if handler == nil {
+			return
+		}
+		if handler.CollectGarbage == nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "repository does not support gc"})
+			return
+		}
+		removed, err := handler.CollectGarbage(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"removed": removed, "error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"removed": removed})
+	})
+	handle("POST /admin/api/repositories/{name}/reindex", func(w http.ResponseWriter, r *http.Request) {
+		handler := server.adminHandler(w, r)
+		if handler == nil {
+			return
+		}
+		if handler.Reindex == nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "repository does not support reindex"})
+			return
+		}
+		err := handler.Reindex(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handle("DELETE /admin/api/repositories/{name}/caches/{cache}", func(w http.ResponseWriter, r *http.Request) {
+		handler := server.adminHandler(w, r)
+		if handler == nil {
+			return
+		}
+		cache, ok := handler.Caches[r.PathValue("cache")]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown cache"})
+			return
+		}
+		if key := r.URL.Query().Get("key"); key != "" {
+			cache.Purge(key)
+		} else {
+			cache.Clear()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handle("GET /admin/api/routes", func(w http.ResponseWriter, r *http.Request) {
+		buffer := bytes.Buffer{}
+		server.mux.WriteDebug(&buffer, 0)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buffer.Bytes())
+	})
+	if auditLog != nil {
+		handle("GET /admin/api/audit", auditLog.HandleQuery)
+		handle("GET /admin/api/audit/verify", auditLog.HandleVerify)
+	}
+}
@@ -0,0 +1,37 @@
+package forest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		configured string
+		header     string
+		status     int
+	}{
+		{configured: "", header: "", status: http.StatusUnauthorized},
+		{configured: "", header: "Bearer ", status: http.StatusUnauthorized},
+		{configured: "s3cret", header: "", status: http.StatusUnauthorized},
+		{configured: "s3cret", header: "Basic s3cret", status: http.StatusUnauthorized},
+		{configured: "s3cret", header: "Bearer wrong", status: http.StatusUnauthorized},
+		{configured: "s3cret", header: "Bearer s3cret", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		server := &Server{config: Config{Admin: AdminConfig{Token: test.configured}}}
+		handler := server.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		req := httptest.NewRequest("GET", "/admin/api/repositories", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("token %q, header %q: status = %d, want %d", test.configured, test.header, rec.Code, test.status)
+		}
+	}
+}
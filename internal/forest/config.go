@@ -3,6 +3,7 @@ package forest
 import (
 	"os"
 
+	"github.com/davidjspooner/dsrepo/internal/audit"
 	"github.com/davidjspooner/dsrepo/internal/repository"
 	"gopkg.in/yaml.v3"
 )
@@ -13,8 +14,16 @@ type ListenerConfig struct {
 	KeyFile  string
 }
 
+type WebhookConfig struct {
+	Queue string
+}
+
 type Config struct {
 	Listener     ListenerConfig
+	Tracing      TracingConfig
+	Audit        *audit.Config
+	Admin        AdminConfig
+	Webhooks     WebhookConfig
 	Repositories []*repository.Config
 }
 
@@ -13,10 +13,13 @@ import (
 	"github.com/davidjspooner/dshttp/pkg/logevent"
 	"github.com/davidjspooner/dshttp/pkg/middleware"
 	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/audit"
 	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var inflightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
@@ -39,10 +42,13 @@ var bytesWritten = promauto.NewCounterVec(
 )
 
 type Server struct {
-	config Config
-	ctx    context.Context
-	log    *slog.Logger
-	mux    *mux.ServeMux
+	config          Config
+	ctx             context.Context
+	log             *slog.Logger
+	mux             *mux.ServeMux
+	webhooks        *webhook.Queue
+	tracerProvider  trace.TracerProvider
+	shutdownTracing func(context.Context) error
 }
 
 type Option func(*Server) error
@@ -59,7 +65,11 @@ func NewServer(options ...Option) (*Server, error) {
 		}
 	}
 
-	err := group.initServers()
+	err := group.initTracing()
+	if err != nil {
+		return nil, err
+	}
+	err = group.initServers()
 	if err != nil {
 		return nil, err
 	}
@@ -82,23 +92,42 @@ func (server *Server) initServers() error {
 	server.mux.Handle("GET /health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
+	var auditLog *audit.Log
+	if server.config.Audit != nil {
+		var err error
+		auditLog, err = audit.Open(server.ctx, server.config.Audit)
+		if err != nil {
+			return err
+		}
+		audit.SetLog(auditLog)
+	}
+	webhooks, err := webhook.NewQueue(server.config.Webhooks.Queue)
+	if err != nil {
+		return err
+	}
+	webhooks.Logger = server.log
+	webhook.SetQueue(webhooks)
+	server.webhooks = webhooks
+
 	for _, repoConfig := range server.config.Repositories {
 		err := repository.NewRepo(server.ctx, repoConfig)
 		if err != nil {
 			return err
 		}
 	}
-	err := repository.SetupRoutes(server.mux)
+	err = repository.SetupRoutes(server.mux)
 	if err != nil {
 		return err
 	}
-	//dump the mux tree to the log
-	//server.mux.WriteDebug(os.Stdout, 0)
+	server.setupAdminRoutes(auditLog)
+	server.setupUIRoutes()
 
 	return nil
 }
 
 func (server *Server) ListenAndServe() error {
+	defer server.flushTracing()
+	go server.webhooks.Run(server.ctx)
 
 	pipeline := httphandler.MiddlewarePipeline{
 		&middleware.Observer{
@@ -138,11 +167,13 @@ func (server *Server) ListenAndServe() error {
 		&middleware.HeadMethodHelper{},
 	}
 
+	handler := server.traceHandler(pipeline.WrapHandler(server.mux))
+
 	addr := fmt.Sprintf(":%d", server.config.Listener.Port)
 
 	if server.config.Listener.CertFile == "" {
 		server.log.Info("listening", slog.String("addr", addr))
-		err := http.ListenAndServe(addr, server.mux)
+		err := http.ListenAndServe(addr, handler)
 		return err
 	}
 
@@ -161,7 +192,7 @@ func (server *Server) ListenAndServe() error {
 		addr,
 		server.config.Listener.CertFile,
 		server.config.Listener.KeyFile,
-		pipeline.WrapHandler(server.mux),
+		handler,
 	)
 	return err
 }
@@ -0,0 +1,78 @@
+package forest
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+}
+
+// WithTracerProvider overrides the OTLP exporter configured in the config file,
+// e.g. with an in-process recorder.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Server) error {
+		s.tracerProvider = tp
+		return nil
+	}
+}
+
+func (server *Server) initTracing() error {
+	if server.tracerProvider == nil {
+		if server.config.Tracing.Endpoint == "" {
+			return nil
+		}
+		exporter, err := otlptracehttp.New(server.ctx, otlptracehttp.WithEndpointURL(server.config.Tracing.Endpoint))
+		if err != nil {
+			return err
+		}
+		serviceName := server.config.Tracing.ServiceName
+		if serviceName == "" {
+			serviceName = "dsrepo"
+		}
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+		)
+		server.tracerProvider = tp
+		server.shutdownTracing = tp.Shutdown
+	}
+	otel.SetTracerProvider(server.tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+func (server *Server) traceHandler(next http.Handler) http.Handler {
+	if server.tracerProvider == nil {
+		return next
+	}
+	return otelhttp.NewHandler(next, "dsrepo",
+		otelhttp.WithTracerProvider(server.tracerProvider),
+		otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "HTTP " + r.Method
+		}),
+	)
+}
+
+func (server *Server) flushTracing() {
+	if server.shutdownTracing == nil {
+		return
+	}
+	err := server.shutdownTracing(context.Background())
+	if err != nil {
+		server.log.Error("tracing:shutdown", slog.String("error", err.Error()))
+	}
+}
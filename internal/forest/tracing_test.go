@@ -0,0 +1,59 @@
+package forest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	server := &Server{}
+	if err := WithTracerProvider(tp)(server); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.initTracing(); err != nil {
+		t.Fatal(err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var inner trace.SpanContext
+	handler := server.traceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "store.get")
+		inner = span.SpanContext()
+		span.End()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	parentID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/v2/library/alpine/manifests/latest", nil)
+	req.Header.Set("traceparent", "00-"+parentID+"-00f067aa0ba902b7-01")
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if span.SpanContext().TraceID().String() != parentID {
+			t.Errorf("span %q has trace id %s, want %s", span.Name(), span.SpanContext().TraceID(), parentID)
+		}
+	}
+	if spans[1].Name() != "HTTP GET" {
+		t.Errorf("server span name = %q, want %q", spans[1].Name(), "HTTP GET")
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("store span is not a child of the server span")
+	}
+	if inner.TraceID().String() != parentID {
+		t.Errorf("handler context was not propagated")
+	}
+}
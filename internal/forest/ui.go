@@ -0,0 +1,132 @@
+package forest
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+//go:embed ui/*.html
+var uiFiles embed.FS
+
+var uiFuncs = template.FuncMap{
+	"join": strings.Join,
+	"size": humanSize,
+}
+
+var uiRepositories = template.Must(template.New("").Funcs(uiFuncs).ParseFS(uiFiles, "ui/layout.html", "ui/repositories.html"))
+var uiListing = template.Must(template.New("").Funcs(uiFuncs).ParseFS(uiFiles, "ui/layout.html", "ui/listing.html"))
+
+type uiCrumb struct {
+	Name string
+	Link string
+}
+
+type uiPage struct {
+	Title        string
+	Crumbs       []uiCrumb
+	Repositories []*repositoryInfo
+	Repository   string
+	Entries      []repository.BrowseEntry
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func (server *Server) renderUI(w http.ResponseWriter, t *template.Template, page *uiPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := t.ExecuteTemplate(w, "layout", page)
+	if err != nil {
+		server.log.Error("ui:render", slog.String("error", err.Error()))
+	}
+}
+
+// uiVisible reports whether the caller may list anything in a repository,
+// either the repository as a whole or one of its top level entries
+func uiVisible(r *http.Request, handler *repository.Handler) bool {
+	if allowed, _ := handler.Allowed(r, "list", ""); allowed {
+		return true
+	}
+	entries, err := handler.List(r.Context(), "")
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if allowed, _ := handler.Allowed(r, "list", entry.Resource); allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *Server) setupUIRoutes() {
+	server.mux.HandleFunc("GET /ui/{$}", func(w http.ResponseWriter, r *http.Request) {
+		page := &uiPage{
+			Title:  "Repositories",
+			Crumbs: []uiCrumb{{Name: "repositories", Link: "/ui/"}},
+		}
+		for _, handler := range repository.Handlers() {
+			if uiVisible(r, handler) {
+				page.Repositories = append(page.Repositories, newRepositoryInfo(handler))
+			}
+		}
+		server.renderUI(w, uiRepositories, page)
+	})
+	server.mux.HandleFunc("GET /ui/{name}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		handler := repository.LookupHandler(r.PathValue("name"))
+		if handler == nil || !uiVisible(r, handler) {
+			http.NotFound(w, r)
+			return
+		}
+		p := strings.Trim(r.PathValue("path"), "/")
+		if p != "" {
+			if err := repository.ValidatePath("path", p); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		entries, err := handler.List(r.Context(), p)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		page := &uiPage{
+			Title:      handler.Name,
+			Repository: handler.Name,
+			Crumbs: []uiCrumb{
+				{Name: "repositories", Link: "/ui/"},
+				{Name: handler.Name, Link: "/ui/" + handler.Name + "/"},
+			},
+		}
+		if p != "" {
+			page.Title = handler.Name + ": " + p
+			link := "/ui/" + handler.Name
+			for _, part := range strings.Split(p, "/") {
+				link = path.Join(link, part)
+				page.Crumbs = append(page.Crumbs, uiCrumb{Name: part, Link: link})
+			}
+		}
+		for _, entry := range entries {
+			if allowed, _ := handler.Allowed(r, "list", entry.Resource); allowed {
+				page.Entries = append(page.Entries, entry)
+			}
+		}
+		server.renderUI(w, uiListing, page)
+	})
+}
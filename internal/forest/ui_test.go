@@ -0,0 +1,152 @@
+package forest
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestHumanSize(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		3 * 1024 * 1024: "3.0 MiB",
+		5 << 30:         "5.0 GiB",
+	}
+	for size, expected := range tests {
+		if got := humanSize(size); got != expected {
+			t.Errorf("humanSize(%d) = %q, want %q", size, got, expected)
+		}
+	}
+}
+
+func TestRenderListing(t *testing.T) {
+	server := &Server{log: slog.Default()}
+	rec := httptest.NewRecorder()
+	server.renderUI(rec, uiListing, &uiPage{
+		Title:      "local-docker: davidjspooner/tool",
+		Repository: "local-docker",
+		Entries: []repository.BrowseEntry{
+			{Name: "v1.0", Path: "davidjspooner/tool@sha256:abc", Size: 2048, Info: "sha256:abc"},
+			{Name: "<script>", Size: 1},
+		},
+	})
+	body := rec.Body.String()
+	for _, expected := range []string{`href="/ui/local-docker/davidjspooner/tool@sha256:abc"`, "2.0 KiB", "&lt;script&gt;"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("rendered listing does not contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestListingFollowsPolicies(t *testing.T) {
+	repotest.Mount(t)
+	config := &repository.Config{Name: "ui-binaries", Type: "binary"}
+	err := yaml.Unmarshal([]byte(`
+- name: list-public
+  actions: ["binary:list"]
+  resources: ["binary:public/*"]
+`), &config.Policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := repository.NewHandler(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.Browse = func(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+		return []repository.BrowseEntry{
+			{Name: "public-tool", Resource: "public/tool"},
+			{Name: "private-tool", Resource: "private/tool"},
+		}, nil
+	}
+	server := &Server{log: slog.Default(), mux: mux.NewServeMux()}
+	server.setupUIRoutes()
+
+	rec := httptest.NewRecorder()
+	server.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/ui/ui-binaries/", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "public-tool") || strings.Contains(body, "private-tool") {
+		t.Fatalf("listing should only show what the policies allow:\n%s", body)
+	}
+}
+
+func TestIndexAndListingFollowUser(t *testing.T) {
+	repotest.Mount(t)
+	configs := map[string]*repository.Config{}
+	for _, name := range []string{"ui-shared", "ui-hidden"} {
+		configs[name] = &repository.Config{Name: name, Type: "binary"}
+	}
+	configs["ui-shared"].Policies = repotest.Policies(t, `
+- name: list-all
+  actions: ["binary:list"]
+  resources: ["binary:*"]
+- name: list-public
+  actions: ["binary:list"]
+  resources: ["binary:public/*"]
+`)
+	err := yaml.Unmarshal([]byte(`
+roles:
+  - name: outsider
+    policies: ["list-public"]
+users:
+  guest: outsider
+`), configs["ui-shared"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs["ui-hidden"].Policies = repotest.Policies(t, `
+- name: list-nothing
+  actions: ["binary:list"]
+  resources: ["binary:nothing"]
+`)
+	for _, config := range configs {
+		handler, err := repository.NewHandler(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.Browse = func(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+			return []repository.BrowseEntry{
+				{Name: "public-tool", Resource: "public/tool"},
+				{Name: "private-tool", Resource: "private/tool"},
+			}, nil
+		}
+	}
+	server := &Server{log: slog.Default(), mux: mux.NewServeMux()}
+	server.setupUIRoutes()
+	get := func(target, user string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if user != "" {
+			r.SetBasicAuth(user, "")
+		}
+		rec := httptest.NewRecorder()
+		server.mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	index := get("/ui/", "").Body.String()
+	if !strings.Contains(index, "ui-shared") || strings.Contains(index, "ui-hidden") {
+		t.Errorf("index should only show repositories the caller may list:\n%s", index)
+	}
+	if rec := get("/ui/ui-hidden/", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("listing a hidden repository = %d, want 404", rec.Code)
+	}
+	if body := get("/ui/ui-shared/", "").Body.String(); !strings.Contains(body, "private-tool") {
+		t.Errorf("listing without a role should show every entry:\n%s", body)
+	}
+	if body := get("/ui/ui-shared/", "guest").Body.String(); !strings.Contains(body, "public-tool") || strings.Contains(body, "private-tool") {
+		t.Errorf("listing as guest should only show what the role allows:\n%s", body)
+	}
+	if rec := get("/ui/ui-shared/.checksums", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("browsing a reserved path = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+)
+
+const testPkginfo = `# Generated by abuild
+pkgname = dstool
+pkgver = 1.2.3-r0
+pkgdesc = a tool
+arch = x86_64
+size = 4096
+license = MIT
+depend = so:libc.musl-x86_64.so.1
+depend = ca-certificates
+`
+
+func makeAPK(t *testing.T) ([]byte, []byte) {
+	var streams [][]byte
+	for _, files := range [][]tarFile{
+		{{name: ".SIGN.RSA.someone.rsa.pub", content: []byte("signature")}},
+		{{name: ".PKGINFO", content: []byte(testPkginfo)}},
+		{{name: "usr/bin/dstool", content: []byte("binary")}},
+	} {
+		stream, err := gzipTar(files, len(streams) < 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, stream)
+	}
+	return bytes.Join(streams, nil), streams[1]
+}
+
+func TestReadPackage(t *testing.T) {
+	content, control := makeAPK(t)
+	e, err := readPackage(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(control)
+	if want := "Q1" + base64.StdEncoding.EncodeToString(sum[:]); e.get("C") != want {
+		t.Errorf("checksum %s, want %s", e.get("C"), want)
+	}
+	if e.filename() != "dstool-1.2.3-r0.apk" || e.get("D") != "so:libc.musl-x86_64.so.1 ca-certificates" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if name, _ := nameOf(e.filename()); name != "dstool" {
+		t.Errorf("nameOf returned %q", name)
+	}
+	if got := parseIndex(formatIndex([]entry{e})); len(got) != 1 || len(got[0]) != len(e) {
+		t.Errorf("index did not round trip: %v", got)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	config, key := repotest.RSAKey(t)
+	signer, err := signing.LoadRSA(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := makeAPK(t)
+	e, err := readPackage(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := buildIndex([]entry{e}, "test", signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := verifyIndex(t, index, key)
+	if !bytes.Contains(files["APKINDEX"], []byte("P:dstool\nV:1.2.3-r0\n")) {
+		t.Errorf("unexpected APKINDEX:\n%s", files["APKINDEX"])
+	}
+}
+
+// verifyIndex checks the signature of an APKINDEX.tar.gz and returns its files
+func verifyIndex(t *testing.T, index []byte, key *rsa.PrivateKey) map[string][]byte {
+	// apk reads the concatenated streams as a single tar archive
+	reader := bytes.NewReader(index)
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Multistream(false)
+	io.Copy(io.Discard, gz)
+	signed := index[len(index)-reader.Len():]
+	gz.Reset(bytes.NewReader(index))
+	archive := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			break
+		}
+		files[header.Name], _ = io.ReadAll(archive)
+	}
+	digest := sha1.Sum(signed)
+	if err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], files[".SIGN.RSA.packager.rsa.pub"]); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	return files
+}
@@ -0,0 +1,108 @@
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/signing"
+)
+
+func parseIndex(content []byte) []entry {
+	entries := []entry{}
+	current := entry{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			if len(current) > 0 {
+				entries = append(entries, current)
+				current = entry{}
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			current = append(current, field{Key: key, Value: value})
+		}
+	}
+	if len(current) > 0 {
+		entries = append(entries, current)
+	}
+	return entries
+}
+
+func formatIndex(entries []entry) []byte {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].filename() < entries[j].filename()
+	})
+	buffer := bytes.Buffer{}
+	for _, e := range entries {
+		for _, f := range e {
+			buffer.WriteString(f.Key + ":" + f.Value + "\n")
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.Bytes()
+}
+
+type tarFile struct {
+	name    string
+	content []byte
+}
+
+func gzipTar(files []tarFile, cut bool) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+	for _, file := range files {
+		err := archive.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(file.content)),
+			ModTime: time.Now(),
+			Format:  tar.FormatUSTAR,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err = archive.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+	// apk expects the signature archive without its end of archive blocks so
+	// the concatenated streams read as one tar
+	var err error
+	if cut {
+		err = archive.Flush()
+	} else {
+		err = archive.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	return buffer.Bytes(), err
+}
+
+// buildIndex returns APKINDEX.tar.gz, prefixed with a signature of the index
+// stream when a key is configured
+func buildIndex(entries []entry, description string, signer *signing.RSASigner) ([]byte, error) {
+	index, err := gzipTar([]tarFile{
+		{name: "DESCRIPTION", content: []byte(description)},
+		{name: "APKINDEX", content: formatIndex(entries)},
+	}, false)
+	if err != nil || signer == nil {
+		return index, err
+	}
+	signature, err := signer.SignSHA1(index)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := gzipTar([]tarFile{{name: ".SIGN.RSA." + signer.Name, content: signature}}, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(signed, index...), nil
+}
@@ -0,0 +1,147 @@
+package apk
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// field is one line of an APKINDEX entry, the key is a single letter
+type field struct {
+	Key   string
+	Value string
+}
+
+type entry []field
+
+func (e entry) get(key string) string {
+	for _, f := range e {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// filename is the name apk expects the package to have next to the index
+func (e entry) filename() string {
+	return e.get("P") + "-" + e.get("V") + ".apk"
+}
+
+// pkginfoKeys maps .PKGINFO keys to APKINDEX letters, repeated keys are joined
+var pkginfoKeys = []struct{ name, key string }{
+	{"pkgname", "P"},
+	{"pkgver", "V"},
+	{"arch", "A"},
+	{"size", "I"},
+	{"pkgdesc", "T"},
+	{"url", "U"},
+	{"license", "L"},
+	{"origin", "o"},
+	{"maintainer", "m"},
+	{"builddate", "t"},
+	{"commit", "c"},
+	{"provider_priority", "k"},
+	{"depend", "D"},
+	{"provides", "p"},
+	{"install_if", "i"},
+	{"replaces", "r"},
+}
+
+func parsePkginfo(content []byte) map[string][]string {
+	values := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, " = ")
+		if !found {
+			continue
+		}
+		values[name] = append(values[name], value)
+	}
+	return values
+}
+
+// readPackage builds the index entry of an apk, which is a concatenation of
+// gzip streams: an optional signature, the control data and the payload
+func readPackage(content []byte) (entry, error) {
+	reader := bytes.NewReader(content)
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("not an apk package: %w", err)
+	}
+	for start := 0; ; {
+		if start > 0 {
+			err = gz.Reset(reader)
+			if err != nil {
+				return nil, fmt.Errorf("apk package has no .PKGINFO")
+			}
+		}
+		gz.Multistream(false)
+		pkginfo, err := findPkginfo(tar.NewReader(gz))
+		if err != nil {
+			return nil, err
+		}
+		// reading from a bytes.Reader leaves it exactly at the end of the stream
+		_, err = io.Copy(io.Discard, gz)
+		if err != nil {
+			return nil, err
+		}
+		end := len(content) - reader.Len()
+		if pkginfo != nil {
+			return indexEntry(pkginfo, content[start:end], int64(len(content)))
+		}
+		start = end
+	}
+}
+
+func findPkginfo(archive *tar.Reader) ([]byte, error) {
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			// signature streams are tar archives without end of archive blocks
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if header.Name == ".PKGINFO" {
+			return io.ReadAll(archive)
+		}
+	}
+}
+
+func indexEntry(pkginfo, control []byte, size int64) (entry, error) {
+	values := parsePkginfo(pkginfo)
+	sum := sha1.Sum(control)
+	e := entry{
+		{Key: "C", Value: "Q1" + base64.StdEncoding.EncodeToString(sum[:])},
+	}
+	for _, k := range pkginfoKeys {
+		if len(values[k.name]) == 0 {
+			continue
+		}
+		e = append(e, field{Key: k.key, Value: strings.Join(values[k.name], " ")})
+		if k.key == "A" {
+			e = append(e, field{Key: "S", Value: strconv.FormatInt(size, 10)})
+		}
+	}
+	if e.get("P") == "" || e.get("V") == "" || e.get("A") == "" {
+		return nil, fmt.Errorf(".PKGINFO has no pkgname, pkgver or arch")
+	}
+	return e, nil
+}
@@ -0,0 +1,369 @@
+package apk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	signer  *signing.RSASigner
+	// when upstream indexes were last fetched
+	indexes *repository.Cache[time.Time]
+}
+
+const (
+	maxPackageSize   = 1024 * 1024 * 1024
+	upstreamIndexTTL = 5 * time.Minute
+	indexFile        = "APKINDEX.tar.gz"
+)
+
+var validSegment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		indexes: repository.NewCacheMap[time.Time](1000),
+	}
+	var err error
+	repo.signer, err = signing.LoadRSA(config.Signing)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	if repo.handler.Upstream != nil {
+		repo.handler.RegisterCache("indexes", repo.indexes)
+	} else {
+		repo.handler.Reindex = repo.resign
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+// validDir checks a <branch>/<arch> path
+func validDir(dir string) bool {
+	parts := strings.Split(dir, "/")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if !validSegment.MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// nameOf extracts the package name from a <name>-<version>-r<release>.apk file name
+func nameOf(filename string) (string, bool) {
+	base, found := strings.CutSuffix(filename, ".apk")
+	if !found || !validSegment.MatchString(base) {
+		return "", false
+	}
+	parts := strings.Split(base, "-")
+	if len(parts) < 3 {
+		return "", false
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), true
+}
+
+func (repo *repo) description(dir string) string {
+	return repo.handler.Name + " " + dir
+}
+
+func (repo *repo) get(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	dir, filename := path.Split(parsed.path)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case dir == "keys":
+		repo.getKey(filename, w)
+	case !validDir(dir):
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+	case filename == indexFile:
+		repo.getIndex(parsed, dir, w, r)
+	default:
+		repo.getPackage(parsed, dir, filename, w, r)
+	}
+}
+
+func (repo *repo) getKey(filename string, w http.ResponseWriter) {
+	if repo.signer == nil || filename != repo.signer.Name {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	key, err := repo.signer.PublicKey()
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(key)
+}
+
+func (repo *repo) getIndex(parsed *parsedRequest, dir string, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", dir) {
+		return
+	}
+	target := path.Join(dir, indexFile)
+	if repo.handler.Upstream != nil {
+		err := repo.refreshIndex(r.Context(), dir)
+		var upstreamErr *repository.UpstreamError
+		if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+			repo.handler.Fail(w, http.StatusNotFound, "", "")
+			return
+		}
+		if err != nil {
+			// a stored copy is better than nothing while the mirror is unreachable
+			parsed.logger.Warn("upstream:fetch", slog.String("target", target), slog.String("error", err.Error()))
+		}
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+// refreshIndex copies the upstream index when the stored copy is too old
+func (repo *repo) refreshIndex(ctx context.Context, dir string) error {
+	if _, age, hit := repo.indexes.Get(dir); hit && age < upstreamIndexTTL {
+		return nil
+	}
+	// fetched outside the cache lock so a slow upstream only delays this index
+	_, err := repo.handler.FetchToLocal(ctx, path.Join(dir, indexFile), repo.handler.UpstreamURL(dir, indexFile))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	repo.indexes.Set(dir, &now)
+	return nil
+}
+
+func (repo *repo) getPackage(parsed *parsedRequest, dir, filename string, w http.ResponseWriter, r *http.Request) {
+	name, ok := nameOf(filename)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", name) {
+		return
+	}
+	target := path.Join(dir, filename)
+	if repo.handler.Upstream != nil && !repo.handler.LocalFileExists(r.Context(), target) {
+		_, err := repo.handler.FetchToLocal(r.Context(), target, repo.handler.UpstreamURL(dir, filename))
+		if err != nil {
+			var upstreamErr *repository.UpstreamError
+			if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+				repo.handler.Fail(w, http.StatusNotFound, "", "")
+				return
+			}
+			parsed.logger.Error("upstream:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusBadGateway, "", "")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+func (repo *repo) readEntries(dir string) ([]entry, error) {
+	content, err := repo.handler.ReadLocal(path.Join(dir, "APKINDEX"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIndex(content), nil
+}
+
+// writeEntries keeps the plain index as state and publishes the signed archive
+func (repo *repo) writeEntries(dir string, entries []entry) error {
+	err := repo.handler.WriteLocal(path.Join(dir, "APKINDEX"), formatIndex(entries))
+	if err != nil {
+		return err
+	}
+	return repo.publish(dir, entries)
+}
+
+func (repo *repo) publish(dir string, entries []entry) error {
+	index, err := buildIndex(entries, repo.description(dir), repo.signer)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(path.Join(dir, indexFile), index)
+}
+
+// resign rebuilds every index archive, e.g. after the signing key changed
+func (repo *repo) resign(ctx context.Context) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	return fs.WalkDir(repo.handler.Local, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "APKINDEX" {
+			return err
+		}
+		dir := path.Dir(p)
+		entries, err := repo.readEntries(dir)
+		if err != nil {
+			return err
+		}
+		return repo.publish(dir, entries)
+	})
+}
+
+// readUpload accepts the package as the raw body or as the "file" field of a form
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(io.LimitReader(r.Body, maxPackageSize))
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxPackageSize))
+}
+
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if repo.handler.Upstream != nil {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "", "mirrors of an upstream are read only")
+		return
+	}
+	dir := parsed.path
+	if !validDir(dir) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid branch or architecture")
+		return
+	}
+	content, err := readUpload(r)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read package")
+		return
+	}
+	e, err := readPackage(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	name, arch := e.get("P"), e.get("A")
+	filename := e.filename()
+	if !validSegment.MatchString(name) || !validSegment.MatchString(strings.TrimSuffix(filename, ".apk")) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid package name or version")
+		return
+	}
+	if arch != path.Base(dir) && arch != "noarch" {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "package is built for "+arch)
+		return
+	}
+	if !repo.IsAllowed(w, r, "put", name) {
+		return
+	}
+	if !repo.handler.Serves(name) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "package "+name+" is not served by this repository")
+		return
+	}
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	target := path.Join(dir, filename)
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	existing, err := repo.handler.ReadLocal(target)
+	if err == nil {
+		if sha256.Sum256(existing) != sum {
+			repo.handler.Fail(w, http.StatusConflict, "", filename+" already exists with different content")
+			return
+		}
+	} else {
+		err = repo.handler.WriteLocal(target, content)
+		if err != nil {
+			parsed.logger.Error("package:write", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+	entries, err := repo.readEntries(dir)
+	if err == nil {
+		entries = slices.DeleteFunc(entries, func(existing entry) bool {
+			return existing.filename() == filename
+		})
+		err = repo.writeEntries(dir, append(entries, e))
+	}
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("dir", dir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+digest, int64(len(content)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.handler.Upstream != nil {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "", "mirrors of an upstream are read only")
+		return
+	}
+	dir, filename := path.Split(parsed.path)
+	dir = strings.TrimSuffix(dir, "/")
+	name, ok := nameOf(filename)
+	if !ok || !validDir(dir) {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "delete", name) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	entries, err := repo.readEntries(dir)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("dir", dir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	kept := slices.DeleteFunc(slices.Clone(entries), func(e entry) bool {
+		return e.filename() == filename
+	})
+	if len(kept) == len(entries) {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	err = repo.writeEntries(dir, kept)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("dir", dir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	target := path.Join(dir, filename)
+	err = repo.handler.HandleLocalDelete(target, parsed.logger, w, r)
+	if err != nil {
+		parsed.logger.Error("package:delete", slog.String("target", target), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,50 @@
+package apk
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestUploadSignsIndex(t *testing.T) {
+	config := &repository.Config{Name: "apk-index", Type: "apk", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "apk", "dstool")
+	signing, key := repotest.RSAKey(t)
+	config.Signing = signing
+	client := repotest.NewRepo(t, &Router{}, config, "/apk/apk-index/")
+	const arch = "v3.20/main/x86_64"
+
+	apk, _ := makeAPK(t)
+	if rec := client.Do("POST", arch, apk, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get(arch + "/dstool-1.2.3-r0.apk"); !bytes.Equal(rec.Body.Bytes(), apk) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	rec := client.Get(arch + "/APKINDEX.tar.gz")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("APKINDEX.tar.gz = %d", rec.Code)
+	}
+	files := verifyIndex(t, rec.Body.Bytes(), key)
+	if !bytes.Contains(files["APKINDEX"], []byte("P:dstool\n")) {
+		t.Errorf("APKINDEX does not list the package:\n%s", files["APKINDEX"])
+	}
+	// apk looks the key up by the name the signature file carries
+	if rec := client.Get("keys/packager.rsa.pub"); rec.Code != http.StatusOK {
+		t.Errorf("public key = %d", rec.Code)
+	}
+
+	if rec := client.Do("DELETE", arch+"/other-1.0-r0.apk", nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete of another package = %d, want 403", rec.Code)
+	}
+	if rec := client.Do("DELETE", arch+"/dstool-1.2.3-r0.apk", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	files = verifyIndex(t, client.Get(arch+"/APKINDEX.tar.gz").Body.Bytes(), key)
+	if bytes.Contains(files["APKINDEX"], []byte("P:dstool\n")) {
+		t.Errorf("APKINDEX after delete still lists the package:\n%s", files["APKINDEX"])
+	}
+}
@@ -0,0 +1,98 @@
+package apk
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	path   string
+	repo   *repo
+	logger slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("apk", &Router{})
+}
+
+/*
+GET    /apk/<repo>/keys/<key>.rsa.pub
+GET    /apk/<repo>/<branch>/<arch>/APKINDEX.tar.gz
+GET    /apk/<repo>/<branch>/<arch>/<package>-<version>.apk
+POST   /apk/<repo>/<branch>/<arch>                      (upload a .apk)
+DELETE /apk/<repo>/<branch>/<arch>/<package>-<version>.apk
+
+The branch may span several path segments, e.g. v3.20/main, so that a
+repository with an upstream mirrors the Alpine layout. Such a repository
+is read only, otherwise items restricts which packages may be uploaded.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		path: r.PathValue("path"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if parsed.path != "" {
+		if err := repository.ValidatePath("path", parsed.path); err != nil {
+			plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+			return nil
+		}
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /apk/{repo}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.get(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /apk/{repo}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /apk/{repo}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
@@ -0,0 +1,107 @@
+package apt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type field struct {
+	Name  string
+	Value string // continuation lines keep their leading space
+}
+
+// stanza is a paragraph of a control or Packages file, the field order is kept
+type stanza []field
+
+func (s stanza) get(name string) string {
+	for _, f := range s {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func (s stanza) set(name, value string) stanza {
+	for i, f := range s {
+		if strings.EqualFold(f.Name, name) {
+			s[i].Value = value
+			return s
+		}
+	}
+	return append(s, field{Name: name, Value: value})
+}
+
+func (s stanza) without(names ...string) stanza {
+	result := stanza{}
+	for _, f := range s {
+		drop := false
+		for _, name := range names {
+			if strings.EqualFold(f.Name, name) {
+				drop = true
+			}
+		}
+		if !drop {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// parseStanzas reads deb822 paragraphs separated by blank lines
+func parseStanzas(content []byte) ([]stanza, error) {
+	stanzas := []stanza{}
+	current := stanza{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(current) > 0 {
+				stanzas = append(stanzas, current)
+				current = stanza{}
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			if len(current) == 0 {
+				return nil, fmt.Errorf("continuation line without a field: %q", line)
+			}
+			current[len(current)-1].Value += "\n" + line
+		case line[0] == '#':
+		default:
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid line: %q", line)
+			}
+			current = append(current, field{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(current) > 0 {
+		stanzas = append(stanzas, current)
+	}
+	return stanzas, nil
+}
+
+func formatStanzas(stanzas []stanza) []byte {
+	buffer := bytes.Buffer{}
+	for i, s := range stanzas {
+		if i > 0 {
+			buffer.WriteByte('\n')
+		}
+		for _, f := range s {
+			buffer.WriteString(f.Name)
+			buffer.WriteByte(':')
+			if f.Value != "" && f.Value[0] != '\n' {
+				buffer.WriteByte(' ')
+			}
+			buffer.WriteString(f.Value)
+			buffer.WriteByte('\n')
+		}
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,104 @@
+package apt
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const arMagic = "!<arch>\n"
+
+// readArMember returns the first member of an ar archive whose name starts with prefix
+func readArMember(content []byte, prefix string) (name string, data []byte, err error) {
+	if !bytes.HasPrefix(content, []byte(arMagic)) {
+		return "", nil, fmt.Errorf("not a deb archive")
+	}
+	offset := len(arMagic)
+	for offset+60 <= len(content) {
+		header := content[offset : offset+60]
+		name = strings.TrimRight(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return "", nil, fmt.Errorf("invalid ar header for %q", name)
+		}
+		start := offset + 60
+		end := start + int(size)
+		if end > len(content) {
+			return "", nil, fmt.Errorf("truncated ar member %q", name)
+		}
+		if strings.HasPrefix(name, prefix) {
+			return name, content[start:end], nil
+		}
+		offset = end + int(size%2)
+	}
+	return "", nil, fmt.Errorf("deb archive has no %s member", prefix)
+}
+
+func decompress(name string, data []byte) (io.Reader, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewReader(bytes.NewReader(data))
+	case strings.HasSuffix(name, ".xz"):
+		return xz.NewReader(bytes.NewReader(data))
+	case strings.HasSuffix(name, ".zst"):
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case strings.HasSuffix(name, ".tar"):
+		return bytes.NewReader(data), nil
+	}
+	return nil, fmt.Errorf("unsupported compression for %s", name)
+}
+
+// readControl extracts the control paragraph of a .deb package
+func readControl(deb []byte) (stanza, error) {
+	name, data, err := readArMember(deb, "control.tar")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := decompress(name, data)
+	if err != nil {
+		return nil, err
+	}
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s has no control file", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(header.Name, "./") != "control" {
+			continue
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		stanzas, err := parseStanzas(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(stanzas) != 1 {
+			return nil, fmt.Errorf("control file has %d paragraphs", len(stanzas))
+		}
+		control := stanzas[0]
+		for _, required := range []string{"Package", "Version", "Architecture"} {
+			if control.get(required) == "" {
+				return nil, fmt.Errorf("control file has no %s", required)
+			}
+		}
+		return control, nil
+	}
+}
@@ -0,0 +1,96 @@
+package apt
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+const testControl = `Package: dstool
+Version: 1:1.2.3-1
+Architecture: amd64
+Maintainer: Someone <someone@example.com>
+Description: a tool
+ with a longer description
+ .
+ over several lines
+`
+
+func makeDeb(t *testing.T, control string) []byte {
+	tarBuffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&tarBuffer)
+	archive := tar.NewWriter(gz)
+	archive.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))})
+	archive.Write([]byte(control))
+	archive.Close()
+	gz.Close()
+
+	deb := bytes.Buffer{}
+	deb.WriteString(arMagic)
+	for _, member := range []struct {
+		name    string
+		content []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", tarBuffer.Bytes()},
+		{"data.tar.gz", nil},
+	} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.content))
+		deb.Write(member.content)
+		if len(member.content)%2 == 1 {
+			deb.WriteByte('\n')
+		}
+	}
+	return deb.Bytes()
+}
+
+func TestReadControl(t *testing.T) {
+	control, err := readControl(makeDeb(t, testControl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if control.get("Package") != "dstool" || control.get("Version") != "1:1.2.3-1" || control.get("Architecture") != "amd64" {
+		t.Errorf("unexpected control %v", control)
+	}
+	if got := string(formatStanzas([]stanza{control})); got != testControl {
+		t.Errorf("control did not round trip:\n%s", got)
+	}
+
+	if _, err := readControl(makeDeb(t, "Package: dstool\nVersion: 1.0\n")); err == nil {
+		t.Error("expected an error for a control file without Architecture")
+	}
+	if _, err := readControl([]byte("not a deb")); err == nil {
+		t.Error("expected an error for content that is not an ar archive")
+	}
+}
+
+func TestParseStanzas(t *testing.T) {
+	stanzas, err := parseStanzas([]byte("Package: a\nVersion: 1\n\n\nPackage: b\nConffiles:\n /etc/b.conf 0123\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stanzas) != 2 || stanzas[1].get("Conffiles") != "\n /etc/b.conf 0123" {
+		t.Fatalf("unexpected stanzas %v", stanzas)
+	}
+	if got := string(formatStanzas(stanzas)); got != "Package: a\nVersion: 1\n\nPackage: b\nConffiles:\n /etc/b.conf 0123\n" {
+		t.Errorf("unexpected formatting:\n%s", got)
+	}
+	stanzas = removePackage(stanzas, "a", "1")
+	if len(stanzas) != 1 || stanzas[0].get("Package") != "b" {
+		t.Errorf("removePackage left %v", stanzas)
+	}
+}
+
+func TestPoolPath(t *testing.T) {
+	tests := map[string]string{
+		poolPath("main", "dstool", "1:1.2.3-1", "amd64"): "pool/main/d/dstool/dstool_1.2.3-1_amd64.deb",
+		poolPath("main", "libfoo", "2.0", "all"):         "pool/main/libf/libfoo/libfoo_2.0_all.deb",
+	}
+	for got, want := range tests {
+		if got != want {
+			t.Errorf("poolPath = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package apt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type checksums struct {
+	MD5    string
+	SHA1   string
+	SHA256 string
+	SHA512 string
+	Size   int64
+}
+
+func checksumsOf(content []byte) checksums {
+	sum := func(h hash.Hash) string {
+		h.Write(content)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	return checksums{
+		MD5:    sum(md5.New()),
+		SHA1:   sum(sha1.New()),
+		SHA256: sum(sha256.New()),
+		SHA512: sum(sha512.New()),
+		Size:   int64(len(content)),
+	}
+}
+
+func distDir(dist string) string {
+	return "dists/" + dist
+}
+
+func packagesPath(dist, component, arch string) string {
+	return distDir(dist) + "/" + component + "/binary-" + arch + "/Packages"
+}
+
+func gzipped(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&buffer)
+	_, err := gz.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (repo *repo) readPackages(target string) ([]stanza, error) {
+	content, err := repo.handler.ReadLocal(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseStanzas(content)
+}
+
+// writePackages replaces one Packages index and its compressed copy
+func (repo *repo) writePackages(target string, stanzas []stanza) error {
+	sort.SliceStable(stanzas, func(i, j int) bool {
+		return stanzas[i].get("Package") < stanzas[j].get("Package")
+	})
+	content := formatStanzas(stanzas)
+	compressed, err := gzipped(content)
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(target, content)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(target+".gz", compressed)
+}
+
+// indexFiles lists the Packages files of a distribution relative to its directory
+func (repo *repo) indexFiles(dist string) ([]string, error) {
+	files := []string{}
+	dir := distDir(dist)
+	err := fs.WalkDir(repo.handler.Local, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && (d.Name() == "Packages" || d.Name() == "Packages.gz") {
+			files = append(files, strings.TrimPrefix(p, dir+"/"))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeRelease regenerates the Release file of a distribution from its
+// Packages files and signs it as InRelease and Release.gpg
+func (repo *repo) writeRelease(dist string) error {
+	files, err := repo.indexFiles(dist)
+	if err != nil {
+		return err
+	}
+	components := []string{}
+	archs := []string{}
+	sums := make(map[string]checksums, len(files))
+	for _, file := range files {
+		content, err := repo.handler.ReadLocal(distDir(dist) + "/" + file)
+		if err != nil {
+			return err
+		}
+		sums[file] = checksumsOf(content)
+		parts := strings.Split(file, "/")
+		if len(parts) != 3 {
+			continue
+		}
+		if !slices.Contains(components, parts[0]) {
+			components = append(components, parts[0])
+		}
+		if arch := strings.TrimPrefix(parts[1], "binary-"); !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+	}
+	sort.Strings(archs)
+
+	release := stanza{
+		{Name: "Origin", Value: repo.handler.Name},
+		{Name: "Label", Value: repo.handler.Name},
+		{Name: "Suite", Value: dist},
+		{Name: "Codename", Value: dist},
+		{Name: "Date", Value: time.Now().UTC().Format(time.RFC1123)},
+		{Name: "Architectures", Value: strings.Join(archs, " ")},
+		{Name: "Components", Value: strings.Join(components, " ")},
+	}
+	for _, algorithm := range []struct {
+		name string
+		sum  func(checksums) string
+	}{
+		{"MD5Sum", func(c checksums) string { return c.MD5 }},
+		{"SHA1", func(c checksums) string { return c.SHA1 }},
+		{"SHA256", func(c checksums) string { return c.SHA256 }},
+		{"SHA512", func(c checksums) string { return c.SHA512 }},
+	} {
+		lines := strings.Builder{}
+		for _, file := range files {
+			fmt.Fprintf(&lines, "\n %s %16d %s", algorithm.sum(sums[file]), sums[file].Size, file)
+		}
+		release = append(release, field{Name: algorithm.name, Value: lines.String()})
+	}
+	content := formatStanzas([]stanza{release})
+
+	dir := distDir(dist)
+	err = repo.handler.WriteLocal(path.Join(dir, "Release"), content)
+	if err != nil || repo.signer == nil {
+		return err
+	}
+	inRelease, err := repo.signer.ClearSign(content)
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(path.Join(dir, "InRelease"), inRelease)
+	if err != nil {
+		return err
+	}
+	signature, err := repo.signer.DetachSign(content)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(path.Join(dir, "Release.gpg"), signature)
+}
@@ -0,0 +1,313 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	signer  *signing.Signer
+}
+
+const maxPackageSize = 1024 * 1024 * 1024
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_-]*$`)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.signer, err = signing.Load(config.Signing)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.Reindex = repo.resign
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+// resign regenerates every Release file, e.g. after the signing key changed
+func (repo *repo) resign(ctx context.Context) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	entries, err := fs.ReadDir(repo.handler.Local, "dists")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		err = repo.writeRelease(entry.Name())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolPath follows the debian pool layout, pool/<component>/<prefix>/<package>/<file>
+func poolPath(component, pkg, version, arch string) string {
+	prefix := pkg[:1]
+	if strings.HasPrefix(pkg, "lib") && len(pkg) > 3 {
+		prefix = pkg[:4]
+	}
+	if _, after, found := strings.Cut(version, ":"); found {
+		version = after
+	}
+	return fmt.Sprintf("pool/%s/%s/%s/%s_%s_%s.deb", component, prefix, pkg, pkg, version, arch)
+}
+
+func (repo *repo) getKey(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.signer == nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	key, err := repo.signer.PublicKey()
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pgp-keys")
+	w.Write(key)
+}
+
+func (repo *repo) getIndex(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	dist, _, _ := strings.Cut(parsed.path, "/")
+	if !repo.IsAllowed(w, r, "list", dist) {
+		return
+	}
+	repo.handler.HandleLocalGet(distDir(parsed.path), parsed.logger, w, r)
+}
+
+func (repo *repo) getPackage(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(parsed.path, "/")
+	if len(parts) != 4 {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", parts[2]) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.debian.binary-package")
+	repo.handler.HandleLocalGet("pool/"+parsed.path, parsed.logger, w, r)
+}
+
+// readUpload accepts the package as the raw body or as the "file" field of a form
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(io.LimitReader(r.Body, maxPackageSize))
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxPackageSize))
+}
+
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if !validName.MatchString(parsed.dist) || !validName.MatchString(parsed.component) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid distribution or component")
+		return
+	}
+	content, err := readUpload(r)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read package")
+		return
+	}
+	control, err := readControl(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	pkg, version, arch := control.get("Package"), control.get("Version"), control.get("Architecture")
+	if !validName.MatchString(pkg) || !validName.MatchString(arch) || strings.ContainsAny(version, "/ ") {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid package, version or architecture")
+		return
+	}
+	if !repo.IsAllowed(w, r, "put", pkg) {
+		return
+	}
+	if !repo.handler.Serves(pkg) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "package "+pkg+" is not served by this repository")
+		return
+	}
+	sums := checksumsOf(content)
+	filename := poolPath(parsed.component, pkg, version, arch)
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	existing, err := repo.handler.ReadLocal(filename)
+	switch {
+	case err == nil && checksumsOf(existing).SHA256 != sums.SHA256:
+		repo.handler.Fail(w, http.StatusConflict, "", pkg+" "+version+" "+arch+" already exists with different content")
+		return
+	case err != nil:
+		err = repo.handler.WriteLocal(filename, content)
+		if err != nil {
+			parsed.logger.Error("package:write", slog.String("target", filename), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	entry := control.without("Filename", "Size", "MD5sum", "SHA1", "SHA256", "SHA512")
+	entry = append(entry,
+		field{Name: "Filename", Value: filename},
+		field{Name: "Size", Value: strconv.FormatInt(sums.Size, 10)},
+		field{Name: "MD5sum", Value: sums.MD5},
+		field{Name: "SHA1", Value: sums.SHA1},
+		field{Name: "SHA256", Value: sums.SHA256},
+		field{Name: "SHA512", Value: sums.SHA512},
+	)
+	target := packagesPath(parsed.dist, parsed.component, arch)
+	stanzas, err := repo.readPackages(target)
+	if err == nil {
+		stanzas = removePackage(stanzas, pkg, version)
+		err = repo.writePackages(target, append(stanzas, entry))
+	}
+	if err == nil {
+		err = repo.writeRelease(parsed.dist)
+	}
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("dist", parsed.dist), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, filename, "sha256:"+sums.SHA256, sums.Size)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func removePackage(stanzas []stanza, pkg, version string) []stanza {
+	kept := make([]stanza, 0, len(stanzas))
+	for _, s := range stanzas {
+		if s.get("Package") != pkg || s.get("Version") != version {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// referenced reports whether any distribution still lists a pool file
+func (repo *repo) referenced(filename string) (bool, error) {
+	found := false
+	err := fs.WalkDir(repo.handler.Local, "dists", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || found {
+			return err
+		}
+		if d.IsDir() || d.Name() != "Packages" {
+			return nil
+		}
+		stanzas, err := repo.readPackages(p)
+		if err != nil {
+			return err
+		}
+		for _, s := range stanzas {
+			if s.get("Filename") == filename {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "delete", parsed.pkg) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	componentDir := distDir(parsed.dist) + "/" + parsed.component
+	entries, err := fs.ReadDir(repo.handler.Local, componentDir)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	removed := []stanza{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "binary-") {
+			continue
+		}
+		target := componentDir + "/" + entry.Name() + "/Packages"
+		stanzas, err := repo.readPackages(target)
+		if err != nil {
+			parsed.logger.Error("index:read", slog.String("target", target), slog.String("error", err.Error()))
+			continue
+		}
+		kept := removePackage(stanzas, parsed.pkg, parsed.version)
+		if len(kept) == len(stanzas) {
+			continue
+		}
+		for _, s := range stanzas {
+			if s.get("Package") == parsed.pkg && s.get("Version") == parsed.version {
+				removed = append(removed, s)
+			}
+		}
+		err = repo.writePackages(target, kept)
+		if err != nil {
+			parsed.logger.Error("index:write", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+	if len(removed) == 0 {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	err = repo.writeRelease(parsed.dist)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("dist", parsed.dist), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	for _, s := range removed {
+		filename := s.get("Filename")
+		size, _ := strconv.ParseInt(s.get("Size"), 10, 64)
+		// the same file may still be listed by another distribution
+		if inUse, err := repo.referenced(filename); err != nil || inUse {
+			continue
+		}
+		err = repo.handler.RemoveLocal(filename)
+		if err != nil {
+			parsed.logger.Error("package:delete", slog.String("target", filename), slog.String("error", err.Error()))
+			continue
+		}
+		repo.handler.RecordWrite(r, audit.ActionDelete, filename, "sha256:"+s.get("SHA256"), size)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package apt
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestUploadSignsRelease(t *testing.T) {
+	config := &repository.Config{Name: "apt-release", Type: "apt", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "apt", "dstool")
+	var keyring openpgp.EntityList
+	config.Signing, keyring = repotest.SigningKey(t)
+	client := repotest.NewRepo(t, &Router{}, config, "/apt/apt-release/")
+
+	deb := makeDeb(t, testControl)
+	if rec := client.Do("POST", "dists/stable/main", deb, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	// the package name comes from the control file, not the url
+	other := makeDeb(t, strings.Replace(testControl, "Package: dstool", "Package: dsother", 1))
+	if rec := client.Do("POST", "dists/stable/main", other, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("upload of another package = %d, want 403", rec.Code)
+	}
+
+	rec := client.Get("dists/stable/main/binary-amd64/Packages")
+	if !strings.Contains(rec.Body.String(), "Filename: pool/main/d/dstool/dstool_1.2.3-1_amd64.deb") {
+		t.Fatalf("Packages = %d:\n%s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("pool/main/d/dstool/dstool_1.2.3-1_amd64.deb"); !bytes.Equal(rec.Body.Bytes(), deb) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	release := client.Get("dists/stable/Release").Body.Bytes()
+	if !bytes.Contains(release, []byte("main/binary-amd64/Packages")) {
+		t.Errorf("Release does not list Packages:\n%s", release)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(release), client.Get("dists/stable/Release.gpg").Body, nil); err != nil {
+		t.Errorf("Release.gpg does not verify: %v", err)
+	}
+	block, _ := clearsign.Decode(client.Get("dists/stable/InRelease").Body.Bytes())
+	if block == nil {
+		t.Fatal("InRelease is not clear signed")
+	}
+	if _, err := block.VerifySignature(keyring, nil); err != nil {
+		t.Errorf("InRelease does not verify: %v", err)
+	}
+	if rec := client.Get("key.gpg"); rec.Code != http.StatusOK {
+		t.Errorf("key.gpg = %d", rec.Code)
+	}
+
+	// deletion names the epoch qualified version and drops the package from the index
+	if rec := client.Do("DELETE", "dists/stable/main/dstool/1:1.2.3-1", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("dists/stable/main/binary-amd64/Packages"); strings.Contains(rec.Body.String(), "Package: dstool") {
+		t.Errorf("Packages after delete:\n%s", rec.Body)
+	}
+	if rec := client.Do("DELETE", "dists/stable/main/dstool/1:1.2.3-1", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package apt
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	dist      string
+	component string
+	pkg       string
+	version   string
+	path      string
+	repo      *repo
+	logger    slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("apt", &Router{})
+}
+
+/*
+GET    /apt/<repo>/key.gpg
+GET    /apt/<repo>/dists/<dist>/{Release,InRelease,Release.gpg}
+GET    /apt/<repo>/dists/<dist>/<component>/binary-<arch>/Packages[.gz]
+GET    /apt/<repo>/pool/<component>/<prefix>/<package>/<file>.deb
+POST   /apt/<repo>/dists/<dist>/<component>                       (upload a .deb)
+DELETE /apt/<repo>/dists/<dist>/<component>/<package>/<version>
+
+An apt source line is "deb <base>/apt/<repo> <dist> <component>", items
+restricts which package names may be uploaded.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		dist:      r.PathValue("dist"),
+		component: r.PathValue("component"),
+		pkg:       r.PathValue("package"),
+		version:   r.PathValue("version"),
+		path:      r.PathValue("path"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "dist", "component", "package", "version"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	if parsed.path != "" {
+		if err := repository.ValidatePath("path", parsed.path); err != nil {
+			plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+			return nil
+		}
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /apt/{repo}/key.gpg", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getKey(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /apt/{repo}/dists/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getIndex(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /apt/{repo}/pool/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getPackage(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /apt/{repo}/dists/{dist}/{component}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /apt/{repo}/dists/{dist}/{component}/{package}/{version}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
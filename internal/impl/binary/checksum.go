@@ -0,0 +1,94 @@
+package binary
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sumsFile lists the sha256 of every file of a directory
+const sumsFile = "SHA256SUMS"
+
+var checksumSuffixes = map[string]string{
+	".md5":    "md5",
+	".sha256": "sha256",
+	".sha512": "sha512",
+}
+
+// sidecar splits the name of a checksum file into the file it describes and
+// the algorithm
+func sidecar(filename string) (described, algorithm string, ok bool) {
+	ext := path.Ext(filename)
+	algorithm, ok = checksumSuffixes[ext]
+	if !ok {
+		return "", "", false
+	}
+	described = strings.TrimSuffix(filename, ext)
+	if described == "" || strings.HasSuffix(described, "/") {
+		return "", "", false
+	}
+	return described, algorithm, true
+}
+
+// writeSums answers in the format of sha256sum and friends, "checksum  name"
+func writeSums(w http.ResponseWriter, lines [][2]string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s  %s\n", line[0], line[1])
+	}
+}
+
+// checksum answers a request for <file>.sha256, .sha512 or .md5 from the
+// checksums stored when the file was uploaded
+func (repo *repo) checksum(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, filename, algorithm string) {
+	described := *parsed
+	described.filename = filename
+	if !repo.IsAllowed(&described, w, r, "get") {
+		return
+	}
+	target := path.Join(parsed.namespace, filename)
+	if !repo.handler.LocalFileExists(r.Context(), target) {
+		repo.handler.Fail(w, http.StatusNotFound, "", path.Base(parsed.filename)+" not found")
+		return
+	}
+	sums, err := repo.handler.Checksums(target)
+	if err != nil {
+		parsed.logger.Error("checksums:read", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read the checksums of "+path.Base(target))
+		return
+	}
+	writeSums(w, [][2]string{{sums.Get(algorithm), path.Base(target)}})
+}
+
+// sums answers a request for the SHA256SUMS of a directory
+func (repo *repo) sums(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	listed := *parsed
+	listed.filename = path.Dir(parsed.filename)
+	if !repo.IsAllowed(&listed, w, r, "list") {
+		return
+	}
+	dir := path.Join(parsed.namespace, listed.filename)
+	entries, err := fs.ReadDir(repo.handler.Local, dir)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", sumsFile+" not found")
+		return
+	}
+	lines := make([][2]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == sumsFile {
+			continue
+		}
+		target := path.Join(dir, entry.Name())
+		sums, err := repo.handler.Checksums(target)
+		if err != nil {
+			parsed.logger.Error("checksums:read", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read the checksums of "+entry.Name())
+			return
+		}
+		lines = append(lines, [2]string{sums.SHA256, entry.Name()})
+	}
+	writeSums(w, lines)
+}
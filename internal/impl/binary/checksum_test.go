@@ -0,0 +1,26 @@
+package binary
+
+import "testing"
+
+func TestSidecar(t *testing.T) {
+	tests := []struct {
+		filename  string
+		described string
+		algorithm string
+		ok        bool
+	}{
+		{filename: "tool.sha256", described: "tool", algorithm: "sha256", ok: true},
+		{filename: "v1.2/linux/tool.tar.gz.sha512", described: "v1.2/linux/tool.tar.gz", algorithm: "sha512", ok: true},
+		{filename: "tool.md5", described: "tool", algorithm: "md5", ok: true},
+		{filename: "tool.sha1"},
+		{filename: "tool"},
+		{filename: ".sha256"},
+		{filename: "v1.2/.sha256"},
+	}
+	for _, test := range tests {
+		described, algorithm, ok := sidecar(test.filename)
+		if ok != test.ok || described != test.described || algorithm != test.algorithm {
+			t.Errorf("sidecar(%q) = %q, %q, %v, want %q, %q, %v", test.filename, described, algorithm, ok, test.described, test.algorithm, test.ok)
+		}
+	}
+}
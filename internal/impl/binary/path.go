@@ -0,0 +1,38 @@
+package binary
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+var errNoNamespace = errors.New("no repository serves the path")
+
+// splitPath divides p into the longest prefix that isNamespace accepts and the
+// relative path of the file below it. A trailing slash, or a path that is a
+// namespace itself, names a directory whose relative path may be empty.
+func splitPath(p string, isNamespace func(namespace string) bool) (namespace, filename string, dir bool, err error) {
+	p, dir = strings.CutSuffix(p, "/")
+	if p == "" {
+		return "", "", dir, errNoNamespace
+	}
+	if err := repository.ValidatePath("path", p); err != nil {
+		return "", "", dir, err
+	}
+	parts := strings.Split(p, "/")
+	longest := len(parts) - 1
+	if dir {
+		longest = len(parts)
+	}
+	for i := longest; i > 0; i-- {
+		namespace = strings.Join(parts[:i], "/")
+		if isNamespace(namespace) {
+			return namespace, strings.Join(parts[i:], "/"), dir, nil
+		}
+	}
+	if !dir && isNamespace(p) {
+		return p, "", true, nil
+	}
+	return "", "", dir, errNoNamespace
+}
@@ -0,0 +1,70 @@
+package binary
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// namespaces stands in for the item glob "davidjspooner/*"
+func namespaces(namespace string) bool {
+	owner, name, ok := strings.Cut(namespace, "/")
+	return ok && owner == "davidjspooner" && name != "" && !strings.Contains(name, "/")
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		namespace string
+		filename  string
+		dir       bool
+		invalid   bool
+		err       error
+	}{
+		{path: "davidjspooner/tool/tool", namespace: "davidjspooner/tool", filename: "tool"},
+		{path: "davidjspooner/tool/v1.2/linux/tool", namespace: "davidjspooner/tool", filename: "v1.2/linux/tool"},
+		{path: "davidjspooner/tool/v1.2/", namespace: "davidjspooner/tool", filename: "v1.2", dir: true},
+		{path: "davidjspooner/tool/", namespace: "davidjspooner/tool", filename: "", dir: true},
+		{path: "davidjspooner/tool", namespace: "davidjspooner/tool", filename: "", dir: true},
+		{path: "davidjspooner/tool/../../etc/passwd", invalid: true},
+		{path: "davidjspooner/tool/v1.2/../tool", invalid: true},
+		{path: "davidjspooner/tool/./tool", invalid: true},
+		{path: "davidjspooner/tool//tool", invalid: true},
+		{path: "davidjspooner/tool/..\\tool", invalid: true},
+		{path: "davidjspooner/tool/v1.2\x00/tool", invalid: true},
+		{path: "someoneelse/tool/tool", err: errNoNamespace},
+		{path: "davidjspooner", err: errNoNamespace},
+		{path: "", err: errNoNamespace},
+	}
+	for _, test := range tests {
+		namespace, filename, dir, err := splitPath(test.path, namespaces)
+		var invalid *repository.InvalidError
+		if test.invalid {
+			if !errors.As(err, &invalid) {
+				t.Errorf("%q: got error %v, expected it to be invalid", test.path, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: got error %v, expected %v", test.path, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if namespace != test.namespace || filename != test.filename || dir != test.dir {
+			t.Errorf("%q: got %q %q %v, expected %q %q %v", test.path, namespace, filename, dir, test.namespace, test.filename, test.dir)
+		}
+	}
+}
+
+func TestSplitPathLongestPrefix(t *testing.T) {
+	// with both "davidjspooner/*" and "davidjspooner/**" style namespaces the longest wins
+	prefixed := func(namespace string) bool { return strings.HasPrefix(namespace, "davidjspooner/") }
+	namespace, filename, _, err := splitPath("davidjspooner/tool/v1.2/linux/tool", prefixed)
+	if err != nil || namespace != "davidjspooner/tool/v1.2/linux" || filename != "tool" {
+		t.Errorf("got %q %q %v", namespace, filename, err)
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 type repo struct {
 	handler *repository.Handler
-	order   int
+	virtual *repository.Virtual[*repo]
 }
 
 func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
@@ -21,12 +21,13 @@ func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
 	if err != nil {
 		return nil, err
 	}
+	repo.handler.ErrorFormat = repository.JSONError
 
 	return repo, nil
 }
 
 func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
-	return true
+	return repo.handler.Authorize(w, r, operation, path.Join(parsed.namespace, parsed.filename))
 }
 
 func (repo *repo) List(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
@@ -34,14 +35,26 @@ func (repo *repo) List(parsed *parsedRequest, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	w.WriteHeader(http.StatusNotImplemented)
+	repo.handler.Fail(w, http.StatusNotImplemented, "", "listing is not supported")
 }
 
 func (repo *repo) Download(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	//the existence of a file is only revealed to callers allowed to get it
 	if !repo.IsAllowed(parsed, w, r, "get") {
 		return
 	}
 	target := path.Join(parsed.namespace, parsed.filename)
+	//checksum files that were uploaded are served as they are
+	if !repo.handler.LocalFileExists(r.Context(), target) {
+		if filename, algorithm, ok := sidecar(parsed.filename); ok {
+			repo.checksum(parsed, w, r, filename, algorithm)
+			return
+		}
+		if path.Base(parsed.filename) == sumsFile {
+			repo.sums(parsed, w, r)
+			return
+		}
+	}
 	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
 }
 
@@ -0,0 +1,40 @@
+package binary
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestDownloadAuthorizesFirst(t *testing.T) {
+	config := &repository.Config{Name: "download-binaries", Type: "binary", Items: []string{"tools/*"}}
+	config.Policies = repotest.Policies(t, `
+- name: list-tools
+  actions: ["binary:list"]
+  resources: ["binary:tools/*"]
+- name: get-public
+  actions: ["binary:get"]
+  resources: ["binary:tools/public/*"]
+`)
+	router := &Router{named: make(map[string]*repo)}
+	client := repotest.NewRepo(t, router, config, "/binary/tools/")
+	local := repotest.Local(t, router.named[config.Name].handler)
+	local.Put("tools/public/tool", []byte("public"))
+	local.Put("tools/secret/tool", []byte("secret"))
+
+	tests := map[string]int{
+		"public/tool":       http.StatusOK,
+		"public/SHA256SUMS": http.StatusOK,
+		"public/missing":    http.StatusNotFound,
+		"secret/tool":       http.StatusForbidden,
+		"secret/SHA256SUMS": http.StatusForbidden,
+		"secret/missing":    http.StatusForbidden,
+	}
+	for target, status := range tests {
+		if rec := client.Get(target); rec.Code != status {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, status)
+		}
+	}
+}
@@ -2,78 +2,66 @@ package binary
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
-	"path"
 
-	"github.com/davidjspooner/dshttp/pkg/httphandler"
 	"github.com/davidjspooner/dshttp/pkg/mux"
-	"github.com/davidjspooner/dsmatch/pkg/matcher"
 	"github.com/davidjspooner/dsrepo/internal/repository"
 )
 
 type Router struct {
-	repos matcher.Tree[*repo]
-	count int
+	routes   repository.Routes[*repo]
+	named    map[string]*repo
+	virtuals []*repo
 }
 
+// jsonError answers requests that fail before a repository is selected
+var jsonError = repository.ErrorFormat(repository.JSONError)
+
 type parsedRequest struct {
 	namespace string
-	filename  string
+	filename  string // relative to the namespace, may hold directories
+	dir       bool
 	repo      *repo
 	logger    slog.Logger
 }
 
 func init() {
-	repository.RegisterRouter("binary", &Router{})
-}
-
-func (router *Router) GetRepo(filename string) []matcher.Leaf[*repo] {
-	leaves := router.repos.FindLeaves([]byte(filename))
-	for n := 0; n < len(leaves); {
-		if leaves[n].Payload == nil {
-			leaves = append(leaves[:n], leaves[n+1:]...)
-		} else {
-			n++
-		}
-	}
-	return leaves
+	repository.RegisterRouter("binary", &Router{named: make(map[string]*repo)})
 }
 
 func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
-	namespace := r.PathValue("filename")
-	filename := ""
+	pr := &parsedRequest{}
+	pr.logger = repository.RequestLogger(r)
 
-	leaves := router.GetRepo(filename)
-	if len(leaves) == 0 {
-		namespace, filename = path.Split(namespace)
-		leaves = router.GetRepo(namespace)
-	}
-	if len(leaves) == 0 {
-		w.WriteHeader(http.StatusNotFound)
+	var route *repository.Route[*repo]
+	namespace, filename, dir, err := splitPath(r.PathValue("filename"), func(namespace string) bool {
+		route = router.routes.Select(namespace, &pr.logger)
+		return route != nil
+	})
+	var invalid *repository.InvalidError
+	if errors.As(err, &invalid) {
+		jsonError.Fail(w, http.StatusBadRequest, "", err.Error())
 		return nil
 	}
-	if len(leaves) > 1 {
-		w.WriteHeader(http.StatusConflict)
-		w.Write([]byte("ambiguous request"))
+	if err != nil {
+		jsonError.Fail(w, http.StatusNotFound, "", err.Error())
 		return nil
 	}
 
-	pr := &parsedRequest{
-		namespace: namespace,
-		filename:  filename,
-		repo:      leaves[0].Payload,
-	}
-
-	obs, _ := httphandler.GetObservation(r)
-	if obs != nil {
-		pr.logger = obs.Logger
-	}
+	pr.namespace = namespace
+	pr.filename = filename
+	pr.dir = dir
+	pr.repo = route.Repo
 	return pr
 }
 
 func (router *Router) SetupRoutes(mux mux.Mux) error {
-	if router.repos.IsEmpty() {
+	if err := router.resolveVirtuals(); err != nil {
+		return err
+	}
+	if router.routes.IsEmpty() {
 		return nil
 	}
 	mux.HandleFunc("GET /binary/{filename...}", func(w http.ResponseWriter, r *http.Request) {
@@ -81,25 +69,33 @@ func (router *Router) SetupRoutes(mux mux.Mux) error {
 		if parsed == nil {
 			return
 		}
-		if parsed.filename == "" {
-			parsed.repo.List(parsed, w, r)
+		if parsed.dir {
+			parsed.repo.read(parsed, w, r, "list", (*repo).List)
 			return
 		}
-		parsed.repo.Download(parsed, w, r)
+		parsed.repo.read(parsed, w, r, "get", (*repo).Download)
 	})
 	mux.HandleFunc("PUT /binary/{filename...}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.Upload(parsed, w, r)
+		if parsed.dir {
+			parsed.repo.handler.Fail(w, http.StatusMethodNotAllowed, "", r.PathValue("filename")+" is a directory")
+			return
+		}
+		parsed.repo.write(parsed, w, r, "put", (*repo).Upload)
 	})
 	mux.HandleFunc("DELETE /binary/{filename...}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.Delete(parsed, w, r)
+		if parsed.dir {
+			parsed.repo.handler.Fail(w, http.StatusMethodNotAllowed, "", r.PathValue("filename")+" is a directory")
+			return
+		}
+		parsed.repo.write(parsed, w, r, "delete", (*repo).Delete)
 	})
 	return nil
 }
@@ -109,19 +105,15 @@ func (router *Router) NewRepo(ctx context.Context, config *repository.Config) er
 	if err != nil {
 		return err
 	}
-	router.count++
-	repo.order = router.count
-	for _, item := range config.Items {
-		seq, err := repository.NewGlob([]byte(item), '/')
-		if err != nil {
-			return err
-		}
-		leaf, err := router.repos.Add(seq)
-		if err != nil {
-			return err
-		}
-		leaf.Payload = repo
-	}
+	router.named[config.Name] = repo
+	return router.routes.Add(config, repo)
+}
 
-	return nil
+func (router *Router) NewVirtual(ctx context.Context, config *repository.Config) error {
+	repo, err := newVirtual(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.virtuals = append(router.virtuals, repo)
+	return router.routes.Add(config, repo)
 }
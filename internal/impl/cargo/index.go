@@ -0,0 +1,202 @@
+package cargo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+
+// indexPath is where the sparse protocol expects the index file of a crate
+func indexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	}
+	return name[:2] + "/" + name[2:4] + "/" + name
+}
+
+func cratePath(name, version string) string {
+	name = strings.ToLower(name)
+	return "crates/" + name + "/" + name + "-" + version + ".crate"
+}
+
+type dependency struct {
+	Name            string   `json:"name"`
+	Req             string   `json:"req"`
+	Features        []string `json:"features"`
+	Optional        bool     `json:"optional"`
+	DefaultFeatures bool     `json:"default_features"`
+	Target          *string  `json:"target"`
+	Kind            string   `json:"kind"`
+	Registry        *string  `json:"registry,omitempty"`
+	Package         *string  `json:"package,omitempty"`
+}
+
+// entry is one line of an index file
+type entry struct {
+	Name        string              `json:"name"`
+	Vers        string              `json:"vers"`
+	Deps        []dependency        `json:"deps"`
+	Cksum       string              `json:"cksum"`
+	Features    map[string][]string `json:"features"`
+	Features2   map[string][]string `json:"features2,omitempty"`
+	Yanked      bool                `json:"yanked"`
+	Links       *string             `json:"links,omitempty"`
+	V           int                 `json:"v,omitempty"`
+	RustVersion *string             `json:"rust_version,omitempty"`
+}
+
+// metadata is the json document cargo publish sends in front of the crate
+type metadata struct {
+	Name     string              `json:"name"`
+	Vers     string              `json:"vers"`
+	Features map[string][]string `json:"features"`
+	Links    *string             `json:"links"`
+	Deps     []struct {
+		Name               string   `json:"name"`
+		VersionReq         string   `json:"version_req"`
+		Features           []string `json:"features"`
+		Optional           bool     `json:"optional"`
+		DefaultFeatures    bool     `json:"default_features"`
+		Target             *string  `json:"target"`
+		Kind               string   `json:"kind"`
+		Registry           *string  `json:"registry"`
+		ExplicitNameInToml *string  `json:"explicit_name_in_toml"`
+	} `json:"deps"`
+	RustVersion *string `json:"rust_version"`
+}
+
+// parsePublish splits a publish body into its metadata and the .crate file,
+// each is preceded by its length as a little endian uint32
+func parsePublish(body []byte) (*metadata, []byte, error) {
+	next := func() ([]byte, error) {
+		if len(body) < 4 {
+			return nil, fmt.Errorf("truncated publish request")
+		}
+		size := binary.LittleEndian.Uint32(body)
+		if uint64(len(body)-4) < uint64(size) {
+			return nil, fmt.Errorf("truncated publish request")
+		}
+		part := body[4 : 4+size]
+		body = body[4+size:]
+		return part, nil
+	}
+	raw, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	crate, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := &metadata{}
+	err = json.Unmarshal(raw, meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid publish metadata: %w", err)
+	}
+	if !validName.MatchString(meta.Name) {
+		return nil, nil, fmt.Errorf("invalid crate name %q", meta.Name)
+	}
+	if err := repository.ValidateSemver(meta.Vers); err != nil {
+		return nil, nil, err
+	}
+	return meta, crate, nil
+}
+
+// entryOf converts publish metadata to an index entry, renamed dependencies
+// are listed under their name in Cargo.toml with the real crate as package
+func entryOf(meta *metadata, cksum string) *entry {
+	e := &entry{
+		Name:        meta.Name,
+		Vers:        meta.Vers,
+		Deps:        []dependency{},
+		Cksum:       cksum,
+		Features:    map[string][]string{},
+		Links:       meta.Links,
+		RustVersion: meta.RustVersion,
+	}
+	for _, dep := range meta.Deps {
+		d := dependency{
+			Name:            dep.Name,
+			Req:             dep.VersionReq,
+			Features:        dep.Features,
+			Optional:        dep.Optional,
+			DefaultFeatures: dep.DefaultFeatures,
+			Target:          dep.Target,
+			Kind:            dep.Kind,
+			Registry:        dep.Registry,
+		}
+		if d.Features == nil {
+			d.Features = []string{}
+		}
+		if dep.ExplicitNameInToml != nil {
+			pkg := dep.Name
+			d.Package = &pkg
+			d.Name = *dep.ExplicitNameInToml
+		}
+		e.Deps = append(e.Deps, d)
+	}
+	// features using the "dep:" or "?/" syntax need version 2 of the index
+	for name, values := range meta.Features {
+		if values == nil {
+			values = []string{}
+		}
+		extended := false
+		for _, value := range values {
+			if strings.HasPrefix(value, "dep:") || strings.Contains(value, "?/") {
+				extended = true
+			}
+		}
+		if extended {
+			if e.Features2 == nil {
+				e.Features2 = map[string][]string{}
+			}
+			e.Features2[name] = values
+			e.V = 2
+		} else {
+			e.Features[name] = values
+		}
+	}
+	return e
+}
+
+func parseEntries(content []byte) ([]*entry, error) {
+	entries := []*entry{}
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		e := &entry{}
+		err := json.Unmarshal(line, e)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func formatEntries(entries []*entry) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package cargo
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestIndexPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"a":     "1/a",
+		"ab":    "2/ab",
+		"abc":   "3/a/abc",
+		"Serde": "se/rd/serde",
+		"cargo": "ca/rg/cargo",
+	} {
+		if got := indexPath(name); got != want {
+			t.Errorf("indexPath(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func publishBody(meta string, crate []byte) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(meta)))
+	body = append(body, meta...)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(crate)))
+	return append(body, crate...)
+}
+
+func TestParsePublish(t *testing.T) {
+	body := publishBody(`{
+		"name": "dstool", "vers": "1.2.3",
+		"deps": [
+			{"name": "serde", "version_req": "^1", "kind": "normal", "default_features": true},
+			{"name": "tokio", "version_req": "^1", "kind": "normal", "optional": true, "explicit_name_in_toml": "rt"}
+		],
+		"features": {"default": ["std"], "std": [], "async": ["dep:rt"]}
+	}`, []byte("crate"))
+	meta, crate, err := parsePublish(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(crate) != "crate" {
+		t.Errorf("unexpected crate %q", crate)
+	}
+	e := entryOf(meta, "sum")
+	if len(e.Deps) != 2 || e.Deps[0].Req != "^1" || e.Deps[0].Features == nil {
+		t.Errorf("unexpected deps %+v", e.Deps)
+	}
+	if e.Deps[1].Name != "rt" || e.Deps[1].Package == nil || *e.Deps[1].Package != "tokio" {
+		t.Errorf("renamed dependency not recorded %+v", e.Deps[1])
+	}
+	if e.V != 2 || len(e.Features2["async"]) != 1 || len(e.Features["default"]) != 1 {
+		t.Errorf("unexpected features %v %v", e.Features, e.Features2)
+	}
+
+	content, err := formatEntries([]*entry{e, e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := parseEntries(content)
+	if err != nil || len(entries) != 2 || entries[1].Vers != "1.2.3" {
+		t.Errorf("entries did not round trip: %v %v", entries, err)
+	}
+
+	for _, bad := range [][]byte{
+		publishBody(`{"name": "dstool", "vers": "1.2"}`, nil),
+		publishBody(`{"name": "../dstool", "vers": "1.2.3"}`, nil),
+		publishBody(`{"name": "dstool", "vers": "1.2.3"}`, nil)[:10],
+	} {
+		if _, _, err := parsePublish(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
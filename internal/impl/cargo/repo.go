@@ -0,0 +1,246 @@
+package cargo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+}
+
+const maxPublishSize = 64 * 1024 * 1024
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = cargoError
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+func baseURL(r *http.Request, name string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/cargo/" + name
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// cargoError is the error format cargo shows to the user
+func cargoError(w http.ResponseWriter, e *repository.Error) {
+	writeJSON(w, e.Status, map[string]any{
+		"errors": []map[string]string{{"detail": e.Message}},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	repository.ErrorFormat(cargoError).Fail(w, status, "", message)
+}
+
+func (repo *repo) getConfig(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r, repo.handler.Name)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dl":  base + "/api/v1/crates",
+		"api": base,
+	})
+}
+
+func (repo *repo) readEntries(name string) ([]*entry, error) {
+	content, err := repo.handler.ReadLocal("index/" + indexPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(content)
+}
+
+func (repo *repo) writeEntries(name string, entries []*entry) error {
+	content, err := formatEntries(entries)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal("index/"+indexPath(name), content)
+}
+
+func (repo *repo) getIndex(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	name := path.Base(parsed.path)
+	if !validName.MatchString(name) || indexPath(name) != parsed.path {
+		writeError(w, http.StatusNotFound, "no such crate")
+		return
+	}
+	if !repo.IsAllowed(w, r, "list", strings.ToLower(name)) {
+		return
+	}
+	content, err := repo.handler.ReadLocal("index/" + parsed.path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no such crate")
+		return
+	}
+	// cargo revalidates index files with If-None-Match
+	sum := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(content)
+}
+
+func (repo *repo) download(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !validName.MatchString(parsed.crate) || repository.ValidateSemver(parsed.version) != nil {
+		writeError(w, http.StatusNotFound, "no such crate")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", strings.ToLower(parsed.crate)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	repo.handler.HandleLocalGet(cratePath(parsed.crate, parsed.version), parsed.logger, w, r)
+}
+
+func (repo *repo) publish(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPublishSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read request")
+		return
+	}
+	if len(body) > maxPublishSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "crate is too large")
+		return
+	}
+	meta, crate, err := parsePublish(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := strings.ToLower(meta.Name)
+	if !repo.IsAllowed(w, r, "put", name) {
+		return
+	}
+	if !repo.handler.Serves(name) {
+		writeError(w, http.StatusForbidden, "crate "+meta.Name+" is not served by this registry")
+		return
+	}
+	sum := sha256.Sum256(crate)
+	cksum := hex.EncodeToString(sum[:])
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	entries, err := repo.readEntries(name)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("crate", name), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	for _, e := range entries {
+		if e.Name != meta.Name {
+			writeError(w, http.StatusConflict, "crate was published as "+e.Name)
+			return
+		}
+		if e.Vers == meta.Vers {
+			writeError(w, http.StatusConflict, "crate version "+meta.Vers+" is already uploaded")
+			return
+		}
+	}
+
+	target := cratePath(name, meta.Vers)
+	err = repo.handler.WriteLocal(target, crate)
+	if err == nil {
+		err = repo.writeEntries(name, append(entries, entryOf(meta, cksum)))
+	}
+	if err != nil {
+		parsed.logger.Error("crate:write", slog.String("target", target), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not store crate")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+cksum, int64(len(crate)))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"warnings": map[string][]string{
+			"invalid_categories": {},
+			"invalid_badges":     {},
+			"other":              {},
+		},
+	})
+}
+
+func (repo *repo) setYanked(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, yanked bool) {
+	if !validName.MatchString(parsed.crate) {
+		writeError(w, http.StatusNotFound, "no such crate")
+		return
+	}
+	name := strings.ToLower(parsed.crate)
+	operation := "put"
+	if yanked {
+		operation = "delete"
+	}
+	if !repo.IsAllowed(w, r, operation, name) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	entries, err := repo.readEntries(name)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("crate", name), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	var found *entry
+	for _, e := range entries {
+		if e.Vers == parsed.version {
+			found = e
+		}
+	}
+	if found == nil {
+		writeError(w, http.StatusNotFound, "no such crate version")
+		return
+	}
+	if found.Yanked != yanked {
+		found.Yanked = yanked
+		err = repo.writeEntries(name, entries)
+		if err != nil {
+			parsed.logger.Error("index:write", slog.String("crate", name), slog.String("error", err.Error()))
+			writeError(w, http.StatusInternalServerError, "could not write index")
+			return
+		}
+		repo.handler.RecordWrite(r, audit.ActionOverwrite, "index/"+indexPath(name), "", 0)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
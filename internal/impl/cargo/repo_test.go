@@ -0,0 +1,42 @@
+package cargo
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestPublishAndYankSparseIndex(t *testing.T) {
+	config := &repository.Config{Name: "cargo-sparse", Type: "cargo", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "cargo", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/cargo/cargo-sparse/")
+
+	if rec := client.Get("index/config.json"); !strings.Contains(rec.Body.String(), `"dl":"http://example.com/cargo/cargo-sparse/api/v1/crates"`) {
+		t.Errorf("config.json = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("PUT", "api/v1/crates/new", publishBody(`{"name": "dstool", "vers": "1.2.3"}`, []byte("crate")), nil); rec.Code != http.StatusOK {
+		t.Fatalf("publish = %d %s", rec.Code, rec.Body)
+	}
+	// cargo only shows errors in the body it expects
+	rec := client.Do("PUT", "api/v1/crates/new", publishBody(`{"name": "dsother", "vers": "1.0.0"}`, []byte("crate")), nil)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"detail"`) {
+		t.Errorf("publish of another crate = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("api/v1/crates/dstool/1.2.3/download"); rec.Body.String() != "crate" {
+		t.Errorf("download = %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "api/v1/crates/dstool/1.2.3/yank", nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("yank = %d %s", rec.Code, rec.Body)
+	}
+	rec = client.Get("index/ds/to/dstool")
+	if !strings.Contains(rec.Body.String(), `"yanked":true`) {
+		t.Errorf("index after yank = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("GET", "index/ds/to/dstool", nil, http.Header{"If-None-Match": {rec.Header().Get("ETag")}}); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidated index = %d, want 304", rec.Code)
+	}
+}
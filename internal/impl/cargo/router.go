@@ -0,0 +1,121 @@
+package cargo
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+type parsedRequest struct {
+	crate   string
+	version string
+	path    string
+	repo    *repo
+	logger  slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("cargo", &Router{})
+}
+
+/*
+GET    /cargo/<repo>/index/config.json
+GET    /cargo/<repo>/index/<prefix>/<crate>
+PUT    /cargo/<repo>/api/v1/crates/new                        (cargo publish)
+DELETE /cargo/<repo>/api/v1/crates/<crate>/<version>/yank
+PUT    /cargo/<repo>/api/v1/crates/<crate>/<version>/unyank
+GET    /cargo/<repo>/api/v1/crates/<crate>/<version>/download
+
+Cargo is configured with index = "sparse+<base>/cargo/<repo>/index/",
+items restricts which crate names may be published.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		crate:   r.PathValue("crate"),
+		version: r.PathValue("version"),
+		path:    r.PathValue("path"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		writeError(w, http.StatusNotFound, "no such registry")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "crate", "version"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if parsed.path != "" {
+		if err := repository.ValidatePath("path", parsed.path); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /cargo/{repo}/index/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		if parsed.path == "config.json" {
+			parsed.repo.getConfig(parsed, w, r)
+			return
+		}
+		parsed.repo.getIndex(parsed, w, r)
+	})
+	aMux.HandleFunc("PUT /cargo/{repo}/api/v1/crates/new", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.publish(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /cargo/{repo}/api/v1/crates/{crate}/{version}/yank", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.setYanked(parsed, w, r, true)
+	})
+	aMux.HandleFunc("PUT /cargo/{repo}/api/v1/crates/{crate}/{version}/unyank", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.setYanked(parsed, w, r, false)
+	})
+	aMux.HandleFunc("GET /cargo/{repo}/api/v1/crates/{crate}/{version}/download", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.download(parsed, w, r)
+	})
+	return nil
+}
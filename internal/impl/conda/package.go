@@ -0,0 +1,117 @@
+package conda
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	validSubdir = regexp.MustCompile(`^[a-z0-9_]+(-[a-z0-9_]+)?$`)
+	validField  = regexp.MustCompile(`^[A-Za-z0-9_.+!]+$`)
+	validName   = regexp.MustCompile(`^[a-z0-9_][a-z0-9_.-]*$`)
+)
+
+const (
+	formatCondaV1 = ".tar.bz2"
+	formatCondaV2 = ".conda"
+)
+
+// record is the repodata entry of a package, info/index.json plus checksums
+type record map[string]any
+
+func (rec record) get(key string) string {
+	value, _ := rec[key].(string)
+	return value
+}
+
+// filename is the canonical <name>-<version>-<build> file name of the package
+func (rec record) filename(format string) string {
+	return rec.get("name") + "-" + rec.get("version") + "-" + rec.get("build") + format
+}
+
+// readIndex extracts info/index.json from a .tar.bz2 or .conda package and
+// reports which of the two formats it is
+func readIndex(content []byte) (record, string, error) {
+	var raw []byte
+	var format string
+	var err error
+	switch {
+	case bytes.HasPrefix(content, []byte("BZh")):
+		format = formatCondaV1
+		raw, err = findInTar(bzip2.NewReader(bytes.NewReader(content)), "info/index.json")
+	case bytes.HasPrefix(content, []byte("PK")):
+		format = formatCondaV2
+		raw, err = readCondaV2(content)
+	default:
+		return nil, "", fmt.Errorf("not a conda package")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	rec := record{}
+	err = json.Unmarshal(raw, &rec)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid info/index.json: %w", err)
+	}
+	if !validName.MatchString(rec.get("name")) || !validField.MatchString(rec.get("version")) || !validField.MatchString(rec.get("build")) {
+		return nil, "", fmt.Errorf("info/index.json has an invalid name, version or build")
+	}
+	if rec.get("subdir") == "" {
+		rec["subdir"] = "noarch"
+	}
+	if !validSubdir.MatchString(rec.get("subdir")) {
+		return nil, "", fmt.Errorf("info/index.json has an invalid subdir")
+	}
+	return rec, format, nil
+}
+
+// readCondaV2 reads the zstd compressed info-*.tar.zst member of a .conda zip
+func readCondaV2(content []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if !strings.HasPrefix(file.Name, "info-") || !strings.HasSuffix(file.Name, ".tar.zst") {
+			continue
+		}
+		rFile, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rFile.Close()
+		decoder, err := zstd.NewReader(rFile)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return findInTar(decoder, "info/index.json")
+	}
+	return nil, fmt.Errorf("conda package has no info archive")
+}
+
+func findInTar(r io.Reader, name string) ([]byte, error) {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("conda package has no %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(header.Name, "./") == name {
+			return io.ReadAll(io.LimitReader(archive, 10*1024*1024))
+		}
+	}
+}
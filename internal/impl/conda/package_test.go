@@ -0,0 +1,81 @@
+package conda
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// a .tar.bz2 package holding only info/index.json for a noarch python package
+const testCondaV1 = "QlpoOTFBWSZTWfoXGMsAAJ5boMyAUAX90yAK/3ffahAACAgwALrMQhDQAAAA0AAA1NA1TxTTIBkGj1AGhsiCRVDQaaaNMQDQNAGgepyjg2CD7cECJe818nw4LyBDCnGmNjLdqRzpmRk8ZDaFC7TnAPCDYQZQBklEbne5zgKCwmAQvKISrsMgVtpR4xe42uQjpQ0lTsXvv0iV+QcByCTuJLJQZNLfwyiAuw6nqqmDkoCpfkkiM6Q2HoHS5yHrUkFRswzKN9gykl/RR51CGxJB/F3JFOFCQ+hcYyw="
+
+func makeCondaV2(t *testing.T, index string) []byte {
+	tarBuffer := bytes.Buffer{}
+	archive := tar.NewWriter(&tarBuffer)
+	archive.WriteHeader(&tar.Header{Name: "info/index.json", Mode: 0644, Size: int64(len(index))})
+	archive.Write([]byte(index))
+	archive.Close()
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := encoder.EncodeAll(tarBuffer.Bytes(), nil)
+
+	buffer := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&buffer)
+	w, _ := zipWriter.Create("metadata.json")
+	w.Write([]byte(`{"conda_pkg_format_version": 2}`))
+	w, _ = zipWriter.Create("info-dstool-1.2.3-h123_0.tar.zst")
+	w.Write(compressed)
+	zipWriter.Close()
+	return buffer.Bytes()
+}
+
+func TestReadIndex(t *testing.T) {
+	v1, _ := base64.StdEncoding.DecodeString(testCondaV1)
+	rec, format, err := readIndex(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != formatCondaV1 || rec.filename(format) != "dstool-1.2.3-py_0.tar.bz2" || rec.get("subdir") != "noarch" {
+		t.Errorf("unexpected record %v %s", rec, format)
+	}
+
+	v2 := makeCondaV2(t, `{"name": "dstool", "version": "1.2.3", "build": "h123_0", "build_number": 0, "subdir": "linux-64"}`)
+	rec, format, err = readIndex(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != formatCondaV2 || rec.filename(format) != "dstool-1.2.3-h123_0.conda" || rec.get("subdir") != "linux-64" {
+		t.Errorf("unexpected record %v %s", rec, format)
+	}
+	name, format, ok := nameOf(rec.filename(format))
+	if !ok || name != "dstool" || format != formatCondaV2 {
+		t.Errorf("nameOf returned %q %q", name, format)
+	}
+
+	if _, _, err = readIndex(makeCondaV2(t, `{"name": "../x", "version": "1", "build": "0"}`)); err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+}
+
+func TestRepodata(t *testing.T) {
+	data := newRepodata("linux-64")
+	data.packages(formatCondaV2)["dstool-1.2.3-h123_0.conda"] = record{"name": "dstool"}
+	content, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"packages":{}`, `"packages.conda":{"dstool-1.2.3-h123_0.conda"`, `"subdir":"linux-64"`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("repodata %s does not contain %s", content, want)
+		}
+	}
+}
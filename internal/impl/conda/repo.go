@@ -0,0 +1,275 @@
+package conda
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// when upstream repodata was last fetched
+	indexes *repository.Cache[time.Time]
+}
+
+const (
+	maxPackageSize   = 2 * 1024 * 1024 * 1024
+	upstreamIndexTTL = 5 * time.Minute
+)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		indexes: repository.NewCacheMap[time.Time](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	if repo.handler.Upstream != nil {
+		repo.handler.RegisterCache("repodata", repo.indexes)
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+// nameOf extracts the package name from a <name>-<version>-<build> file name
+func nameOf(filename string) (string, string, bool) {
+	format, ok := formatOf(filename)
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(filename, format), "-")
+	if len(parts) < 3 || !validName.MatchString(strings.Join(parts[:len(parts)-2], "-")) {
+		return "", "", false
+	}
+	for _, part := range parts[len(parts)-2:] {
+		if !validField.MatchString(part) {
+			return "", "", false
+		}
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), format, true
+}
+
+func (repo *repo) get(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(parsed.file, ".json") {
+		repo.getRepodata(parsed, w, r)
+		return
+	}
+	repo.getPackage(parsed, w, r)
+}
+
+func (repo *repo) getRepodata(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", parsed.subdir) {
+		return
+	}
+	target := parsed.subdir + "/" + parsed.file
+	w.Header().Set("Content-Type", "application/json")
+	if repo.handler.Upstream == nil {
+		if parsed.file != "repodata.json" {
+			repo.handler.Fail(w, http.StatusNotFound, "", "")
+			return
+		}
+		// conda expects every subdir to exist, noarch in particular
+		if !repo.handler.LocalFileExists(r.Context(), target) {
+			json.NewEncoder(w).Encode(newRepodata(parsed.subdir))
+			return
+		}
+		repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+		return
+	}
+	err := repo.refreshRepodata(r.Context(), target)
+	var upstreamErr *repository.UpstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if err != nil {
+		// a stored copy is better than nothing while the upstream is unreachable
+		parsed.logger.Warn("upstream:fetch", slog.String("target", target), slog.String("error", err.Error()))
+	}
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+// refreshRepodata copies the upstream file when the stored copy is too old
+func (repo *repo) refreshRepodata(ctx context.Context, target string) error {
+	if _, age, hit := repo.indexes.Get(target); hit && age < upstreamIndexTTL {
+		return nil
+	}
+	// the lock is not held while fetching, other subdirs must not wait on a slow channel
+	_, err := repo.handler.FetchToLocal(ctx, target, repo.handler.UpstreamURL(target))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	repo.indexes.Set(target, &now)
+	return nil
+}
+
+func (repo *repo) getPackage(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	name, _, ok := nameOf(parsed.file)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", name) {
+		return
+	}
+	target := parsed.subdir + "/" + parsed.file
+	if repo.handler.Upstream != nil && !repo.handler.LocalFileExists(r.Context(), target) {
+		_, err := repo.handler.FetchToLocal(r.Context(), target, repo.handler.UpstreamURL(target))
+		if err != nil {
+			var upstreamErr *repository.UpstreamError
+			if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+				repo.handler.Fail(w, http.StatusNotFound, "", "")
+				return
+			}
+			parsed.logger.Error("upstream:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusBadGateway, "", "")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+// readUpload accepts the package as the raw body or as the "file" field of a form
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(io.LimitReader(r.Body, maxPackageSize))
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxPackageSize))
+}
+
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if repo.handler.Upstream != nil {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "", "mirrors of an upstream are read only")
+		return
+	}
+	content, err := readUpload(r)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read package")
+		return
+	}
+	rec, format, err := readIndex(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	name, subdir := rec.get("name"), rec.get("subdir")
+	if !repo.IsAllowed(w, r, "put", name) {
+		return
+	}
+	if !repo.handler.Serves(name) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "package "+name+" is not served by this channel")
+		return
+	}
+	md5sum := md5.Sum(content)
+	sha256sum := sha256.Sum256(content)
+	rec["md5"] = hex.EncodeToString(md5sum[:])
+	rec["sha256"] = hex.EncodeToString(sha256sum[:])
+	rec["size"] = len(content)
+	filename := rec.filename(format)
+	target := subdir + "/" + filename
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	existing, err := repo.handler.ReadLocal(target)
+	if err == nil {
+		if sha256.Sum256(existing) != sha256sum {
+			repo.handler.Fail(w, http.StatusConflict, "", filename+" already exists with different content")
+			return
+		}
+	} else {
+		err = repo.handler.WriteLocal(target, content)
+		if err != nil {
+			parsed.logger.Error("package:write", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+	data, err := repo.readRepodata(subdir)
+	if err == nil {
+		data.packages(format)[filename] = rec
+		data.Removed = slices.DeleteFunc(data.Removed, func(removed string) bool { return removed == filename })
+		err = repo.writeRepodata(data)
+	}
+	if err != nil {
+		parsed.logger.Error("repodata:write", slog.String("subdir", subdir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+rec.get("sha256"), int64(len(content)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.handler.Upstream != nil {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "", "mirrors of an upstream are read only")
+		return
+	}
+	name, format, ok := nameOf(parsed.file)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "delete", name) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	data, err := repo.readRepodata(parsed.subdir)
+	if err != nil {
+		parsed.logger.Error("repodata:read", slog.String("subdir", parsed.subdir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	packages := data.packages(format)
+	if _, found := packages[parsed.file]; !found {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	delete(packages, parsed.file)
+	data.Removed = append(data.Removed, parsed.file)
+	err = repo.writeRepodata(data)
+	if err != nil {
+		parsed.logger.Error("repodata:write", slog.String("subdir", parsed.subdir), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	target := parsed.subdir + "/" + parsed.file
+	err = repo.handler.HandleLocalDelete(target, parsed.logger, w, r)
+	if err != nil {
+		parsed.logger.Error("package:delete", slog.String("target", target), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,57 @@
+package conda
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+type testRepodata struct {
+	PackagesConda map[string]json.RawMessage `json:"packages.conda"`
+	Removed       []string                   `json:"removed"`
+}
+
+func getRepodata(t *testing.T, client *repotest.Client, subdir string) testRepodata {
+	var repodata testRepodata
+	rec := client.Get(subdir + "/repodata.json")
+	if err := json.Unmarshal(rec.Body.Bytes(), &repodata); err != nil {
+		t.Fatalf("repodata = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	return repodata
+}
+
+func TestUploadAndDeleteUpdateRepodata(t *testing.T) {
+	config := &repository.Config{Name: "conda-repodata", Type: "conda", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "conda", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/conda/conda-repodata")
+	const file = "dstool-1.2.3-h123_0.conda"
+
+	// the subdir and file name come from info/index.json inside the package
+	pkg := makeCondaV2(t, `{"name": "dstool", "version": "1.2.3", "build": "h123_0", "build_number": 0, "subdir": "linux-64"}`)
+	if rec := client.Do("POST", "", pkg, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	other := makeCondaV2(t, `{"name": "other", "version": "1.0", "build": "0", "build_number": 0, "subdir": "linux-64"}`)
+	if rec := client.Do("POST", "", other, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("upload of another package = %d, want 403", rec.Code)
+	}
+	if rec := client.Get("/linux-64/" + file); !bytes.Equal(rec.Body.Bytes(), pkg) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if repodata := getRepodata(t, client, "/linux-64"); repodata.PackagesConda[file] == nil {
+		t.Errorf("repodata does not list %s: %v", file, repodata.PackagesConda)
+	}
+
+	if rec := client.Do("DELETE", "/linux-64/"+file, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	// conda drops a cached package that repodata lists as removed
+	repodata := getRepodata(t, client, "/linux-64")
+	if repodata.PackagesConda[file] != nil || len(repodata.Removed) != 1 || repodata.Removed[0] != file {
+		t.Errorf("repodata after delete = %+v", repodata)
+	}
+}
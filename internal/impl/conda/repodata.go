@@ -0,0 +1,77 @@
+package conda
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+type repodata struct {
+	Info struct {
+		Subdir string `json:"subdir"`
+	} `json:"info"`
+	Packages        map[string]record `json:"packages"`
+	PackagesConda   map[string]record `json:"packages.conda"`
+	Removed         []string          `json:"removed"`
+	RepodataVersion int               `json:"repodata_version"`
+}
+
+func newRepodata(subdir string) *repodata {
+	data := &repodata{
+		Packages:        map[string]record{},
+		PackagesConda:   map[string]record{},
+		Removed:         []string{},
+		RepodataVersion: 1,
+	}
+	data.Info.Subdir = subdir
+	return data
+}
+
+// packages returns the map holding files of the given format
+func (data *repodata) packages(format string) map[string]record {
+	if format == formatCondaV2 {
+		return data.PackagesConda
+	}
+	return data.Packages
+}
+
+func formatOf(filename string) (string, bool) {
+	for _, format := range []string{formatCondaV1, formatCondaV2} {
+		if strings.HasSuffix(filename, format) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func repodataPath(subdir string) string {
+	return subdir + "/repodata.json"
+}
+
+func (repo *repo) readRepodata(subdir string) (*repodata, error) {
+	content, err := repo.handler.ReadLocal(repodataPath(subdir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return newRepodata(subdir), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := newRepodata(subdir)
+	err = json.Unmarshal(content, data)
+	if data.Packages == nil {
+		data.Packages = map[string]record{}
+	}
+	if data.PackagesConda == nil {
+		data.PackagesConda = map[string]record{}
+	}
+	return data, err
+}
+
+func (repo *repo) writeRepodata(data *repodata) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(repodataPath(data.Info.Subdir), content)
+}
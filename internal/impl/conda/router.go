@@ -0,0 +1,101 @@
+package conda
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	subdir string
+	file   string
+	repo   *repo
+	logger slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("conda", &Router{})
+}
+
+/*
+GET    /conda/<repo>/<subdir>/repodata.json
+GET    /conda/<repo>/<subdir>/<name>-<version>-<build>.{conda,tar.bz2}
+POST   /conda/<repo>                                          (upload a package)
+DELETE /conda/<repo>/<subdir>/<name>-<version>-<build>.{conda,tar.bz2}
+
+A channel is added with "conda config --add channels <base>/conda/<repo>".
+A repository with an upstream such as https://conda.anaconda.org/conda-forge
+mirrors it read only, otherwise items restricts which packages may be uploaded.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		subdir: r.PathValue("subdir"),
+		file:   r.PathValue("file"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "subdir", "file"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	if parsed.subdir != "" && !validSubdir.MatchString(parsed.subdir) {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /conda/{repo}/{subdir}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.get(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /conda/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /conda/{repo}/{subdir}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
@@ -0,0 +1,73 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// Artifact is a tagged manifest of a non image artifact such as a helm chart
+type Artifact struct {
+	Name   string
+	Tag    string
+	Digest string
+	Config []byte
+	Layers []Layer
+}
+
+type Layer struct {
+	MediaType string
+	Digest    string
+	Size      int64
+}
+
+// Artifacts lists the tagged manifests in a container repository whose config
+// has the given media type, along with the content of their config blob
+func Artifacts(ctx context.Context, handler *repository.Handler, configMediaType string) ([]Artifact, error) {
+	if handler.Local == nil {
+		return nil, nil
+	}
+	repo := &repo{handler: handler}
+	names, err := repo.names(ctx)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := []Artifact{}
+	for _, name := range names {
+		tags, err := repo.tags(name)
+		if err != nil {
+			continue
+		}
+		for _, tag := range tags {
+			digest, content, err := repo.readManifest(name, tag)
+			if err != nil {
+				continue
+			}
+			var manifest manifestDescriptors
+			if json.Unmarshal(content, &manifest) != nil || manifest.Config.MediaType != configMediaType {
+				continue
+			}
+			config, err := repo.readLocal(blobPath(name, manifest.Config.Digest))
+			if err != nil {
+				continue
+			}
+			artifact := Artifact{Name: name, Tag: tag, Digest: digest, Config: config}
+			for _, layer := range manifest.Layers {
+				artifact.Layers = append(artifact.Layers, Layer{MediaType: layer.MediaType, Digest: layer.Digest, Size: layer.Size})
+			}
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
+
+// OpenBlob opens a blob stored in a container repository
+func OpenBlob(handler *repository.Handler, name, digest string) (io.ReadCloser, error) {
+	if handler.Local == nil {
+		return nil, fs.ErrNotExist
+	}
+	return handler.Local.Open(blobPath(name, digest))
+}
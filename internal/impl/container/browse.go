@@ -0,0 +1,135 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+type manifestDescriptors struct {
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// browse lists image names at the top level, tags below a name and the
+// blobs of a manifest below "<name>@<digest>"
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	if p == "" {
+		return repo.browseNames(ctx)
+	}
+	name, digest, found := strings.Cut(p, "@")
+	if found {
+		return repo.browseManifest(name, digest)
+	}
+	return repo.browseTags(name)
+}
+
+func (repo *repo) browseNames(ctx context.Context) ([]repository.BrowseEntry, error) {
+	names, err := repo.names(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]repository.BrowseEntry, 0, len(names))
+	for _, name := range names {
+		list = append(list, repository.BrowseEntry{Name: name, Path: name, Resource: name})
+	}
+	return list, nil
+}
+
+func (repo *repo) browseTags(name string) ([]repository.BrowseEntry, error) {
+	entries, err := fs.ReadDir(repo.handler.Local, path.Join(name, "tags"))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]repository.BrowseEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		digest, content, err := repo.readManifest(name, entry.Name())
+		if err != nil {
+			continue
+		}
+		be := repository.BrowseEntry{
+			Name:     entry.Name(),
+			Path:     name + "@" + digest,
+			Resource: name,
+			Info:     digest,
+		}
+		if info, err := entry.Info(); err == nil {
+			be.ModTime = info.ModTime()
+		}
+		var manifest manifestDescriptors
+		if json.Unmarshal(content, &manifest) == nil {
+			be.Size = manifest.Config.Size
+			for _, layer := range manifest.Layers {
+				be.Size += layer.Size
+			}
+		}
+		list = append(list, be)
+	}
+	return list, nil
+}
+
+func (repo *repo) browseManifest(name, digest string) ([]repository.BrowseEntry, error) {
+	_, content, err := repo.readManifest(name, digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest manifestDescriptors
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	list := []repository.BrowseEntry{}
+	for _, m := range manifest.Manifests {
+		be := repository.BrowseEntry{
+			Name:     m.Digest,
+			Path:     name + "@" + m.Digest,
+			Resource: name,
+			Size:     m.Size,
+			Info:     m.MediaType,
+		}
+		if m.Platform != nil {
+			be.Info = fmt.Sprintf("%s/%s", m.Platform.OS, m.Platform.Architecture)
+			if m.Platform.Variant != "" {
+				be.Info += "/" + m.Platform.Variant
+			}
+		}
+		list = append(list, be)
+	}
+	if manifest.Config.Digest != "" {
+		list = append(list, repository.BrowseEntry{
+			Name:     "config " + manifest.Config.Digest,
+			Resource: name,
+			Size:     manifest.Config.Size,
+			Info:     manifest.Config.MediaType,
+		})
+	}
+	for n, layer := range manifest.Layers {
+		list = append(list, repository.BrowseEntry{
+			Name:     fmt.Sprintf("layer %d %s", n+1, layer.Digest),
+			Resource: name,
+			Size:     layer.Size,
+			Info:     layer.MediaType,
+		})
+	}
+	return list, nil
+}
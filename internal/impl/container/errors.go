@@ -0,0 +1,38 @@
+package container
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// ociError answers requests that fail before a repository is selected
+var ociError = repository.ErrorFormat(repository.OCIError)
+
+// validate checks the name, digest and reference of a request, a reference is
+// a tag, a digest or an upload session id
+func (parsed *parsedRequest) validate(w http.ResponseWriter) bool {
+	if err := repository.ValidateOCIName(parsed.name); err != nil {
+		ociError.Fail(w, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return false
+	}
+	if parsed.digest != "" {
+		if err := repository.ValidateDigest(parsed.digest); err != nil {
+			ociError.Fail(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+			return false
+		}
+	}
+	if strings.Contains(parsed.reference, ":") {
+		if err := repository.ValidateDigest(parsed.reference); err != nil {
+			ociError.Fail(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+			return false
+		}
+	} else if parsed.reference != "" {
+		if err := repository.ValidateOCITag(parsed.reference); err != nil {
+			ociError.Fail(w, http.StatusBadRequest, "TAG_INVALID", err.Error())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type manifestReferences struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+	} `json:"layers"`
+	// the platform manifests of an image index
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// blobGracePeriod protects the blobs of a push in progress, they are uploaded
+// before the manifest that refers to them
+const blobGracePeriod = 24 * time.Hour
+
+// collectGarbage removes blobs that no locally stored manifest refers to. Blobs
+// are kept per image name so the references are tracked the same way.
+func (repo *repo) collectGarbage(ctx context.Context) (int, error) {
+	_, span := repository.StartSpan(ctx, "container.gc")
+	var err error
+	defer func() { repository.EndSpan(span, err) }()
+
+	if shared := repo.handler.SharingStore(); len(shared) > 0 {
+		err = fmt.Errorf("the store is shared with %s", strings.Join(shared, ", "))
+		return 0, err
+	}
+	cutoff := time.Now().Add(-blobGracePeriod)
+	referenced := make(map[string]bool)
+	blobs := []string{}
+	// blob paths of the platform manifests image indexes refer to
+	children := []string{}
+	mark := func(name string, content []byte) {
+		var refs manifestReferences
+		if json.Unmarshal(content, &refs) != nil {
+			return
+		}
+		if refs.Config.Digest != "" {
+			referenced[name+"/blob/"+refs.Config.Digest] = true
+		}
+		for _, layer := range refs.Layers {
+			referenced[name+"/blob/"+layer.Digest] = true
+		}
+		for _, child := range refs.Manifests {
+			referenced[name+"/blob/"+child.Digest] = true
+			children = append(children, name+"/blob/"+child.Digest)
+		}
+	}
+	err = fs.WalkDir(repo.handler.Local, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == repository.ChecksumDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		dir, _ := path.Split(p)
+		switch {
+		case strings.HasSuffix(dir, "/blob/"):
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			//a store without modification times can not tell a fresh upload apart
+			if !info.ModTime().IsZero() && info.ModTime().Before(cutoff) {
+				blobs = append(blobs, p)
+			}
+		case strings.HasSuffix(dir, "/manifests/"):
+			name := strings.TrimSuffix(dir, "/manifests/")
+			content, err := repo.readLocal(p)
+			if err != nil {
+				return err
+			}
+			mark(name, content)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// platform manifests pushed by digest were marked by the walk, the ones
+	// stored as blobs refer to blobs of their own that must be kept as well
+	followed := make(map[string]bool)
+	for len(children) > 0 {
+		child := children[0]
+		children = children[1:]
+		if followed[child] {
+			continue
+		}
+		followed[child] = true
+		content, err := repo.readLocal(child)
+		if err != nil {
+			continue
+		}
+		mark(strings.TrimSuffix(path.Dir(child), "/blob"), content)
+	}
+	removed := 0
+	for _, blob := range blobs {
+		if referenced[blob] {
+			continue
+		}
+		err = repo.handler.RemoveLocal(blob)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,87 @@
+package container
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	repotest.Mount(t)
+	config := &repository.Config{Name: "gc-docker", Type: "container"}
+	config.Local.Path = "mem://gc/docker/"
+	repo, err := newRepo(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := repotest.Local(t, repo.handler)
+
+	old := 2 * blobGracePeriod
+	local.Put(blobPath("lib/app", "sha256:layer"), []byte("layer"))
+	local.Put(blobPath("lib/app", "sha256:orphan"), []byte("orphan"))
+	local.Put(blobPath("lib/app", "sha256:pushing"), []byte("pushing"))
+	local.Put(manifestPath("lib/app", "sha256:manifest"), []byte(`{"layers":[{"digest":"sha256:layer"}]}`))
+	local.Put(repository.ChecksumDir+"/lib/app/blob/sha256:gone.json", []byte(`{}`))
+	for _, name := range []string{"sha256:layer", "sha256:orphan"} {
+		local.Age(blobPath("lib/app", name), old)
+	}
+	local.Age(repository.ChecksumDir+"/lib/app/blob/sha256:gone.json", old)
+
+	removed, err := repo.collectGarbage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := local.Names("")
+	slices.Sort(remaining)
+	want := []string{
+		repository.ChecksumDir + "/lib/app/blob/sha256:gone.json",
+		blobPath("lib/app", "sha256:layer"),
+		blobPath("lib/app", "sha256:pushing"),
+		manifestPath("lib/app", "sha256:manifest"),
+	}
+	slices.Sort(want)
+	if removed != 1 || !slices.Equal(remaining, want) {
+		t.Fatalf("removed %d, remaining %v, want 1 and %v", removed, remaining, want)
+	}
+
+	// a multi-arch image keeps the platform manifests of its index and their blobs
+	local.Put(manifestPath("lib/multi", "sha256:index"), []byte(`{"manifests":[{"digest":"sha256:amd64"},{"digest":"sha256:arm64"}]}`))
+	local.Put(manifestPath("lib/multi", "sha256:amd64"), []byte(`{"layers":[{"digest":"sha256:amd64-layer"}]}`))
+	local.Put(blobPath("lib/multi", "sha256:arm64"), []byte(`{"config":{"digest":"sha256:arm64-config"},"layers":[{"digest":"sha256:arm64-layer"}]}`))
+	multi := []string{"sha256:arm64", "sha256:arm64-config", "sha256:arm64-layer", "sha256:amd64-layer"}
+	for _, name := range append(multi[1:], "sha256:unused") {
+		local.Put(blobPath("lib/multi", name), []byte(name))
+	}
+	for _, name := range append(multi, "sha256:unused") {
+		local.Age(blobPath("lib/multi", name), old)
+	}
+	removed, err = repo.collectGarbage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining = local.Names("lib/multi/blob/")
+	slices.Sort(remaining)
+	want = []string{}
+	for _, name := range multi {
+		want = append(want, blobPath("lib/multi", name))
+	}
+	slices.Sort(want)
+	if removed != 1 || !slices.Equal(remaining, want) {
+		t.Fatalf("multi-arch: removed %d, remaining %v, want 1 and %v", removed, remaining, want)
+	}
+
+	// a second repository inside the same store makes gc unsafe
+	shared := &repository.Config{Name: "gc-docker-cache", Type: "container"}
+	shared.Local.Path = "mem://gc/docker/cache"
+	if _, err := newRepo(context.Background(), shared); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.collectGarbage(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "gc-docker-cache") {
+		t.Fatalf("collectGarbage() on a shared store = %v, want a refusal", err)
+	}
+}
@@ -0,0 +1,162 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+const maxManifestSize = 4 * 1024 * 1024
+
+const defaultManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+func isDigest(reference string) bool {
+	return strings.HasPrefix(reference, "sha256:")
+}
+
+func manifestPath(name, digest string) string {
+	return name + "/manifests/" + digest
+}
+
+func tagPath(name, tag string) string {
+	return name + "/tags/" + tag
+}
+
+func manifestMediaType(content []byte) string {
+	var header struct {
+		MediaType string `json:"mediaType"`
+	}
+	if json.Unmarshal(content, &header) == nil && header.MediaType != "" {
+		return header.MediaType
+	}
+	return defaultManifestMediaType
+}
+
+func (repo *repo) readLocal(target string) ([]byte, error) {
+	f, err := repo.handler.Local.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxManifestSize+1))
+}
+
+func (repo *repo) writeLocal(target string, content []byte) error {
+	info := store.Info{
+		Size: int64(len(content)),
+		Mode: 0644,
+	}
+	wFile, err := repo.handler.Local.Create(target, info.FileInfo())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wFile, bytes.NewReader(content))
+	if err != nil {
+		wFile.Close()
+		return err
+	}
+	return wFile.Close()
+}
+
+// resolveManifest returns the digest a tag or digest reference points at
+func (repo *repo) resolveManifest(name, reference string) (string, error) {
+	if isDigest(reference) {
+		return reference, nil
+	}
+	content, err := repo.readLocal(tagPath(name, reference))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (repo *repo) readManifest(name, reference string) (digest string, content []byte, err error) {
+	digest, err = repo.resolveManifest(name, reference)
+	if err != nil {
+		return "", nil, err
+	}
+	content, err = repo.readLocal(manifestPath(name, digest))
+	if err != nil {
+		return "", nil, err
+	}
+	return digest, content, nil
+}
+
+func (repo *repo) storeManifest(name, reference string, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if isDigest(reference) && reference != digest {
+		return "", fmt.Errorf("digest mismatch: %s != %s", reference, digest)
+	}
+	err := repo.writeLocal(manifestPath(name, digest), content)
+	if err != nil {
+		return "", err
+	}
+	if !isDigest(reference) {
+		err = repo.writeLocal(tagPath(name, reference), []byte(digest))
+		if err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
+
+// names lists the image names that have tags in the local store
+func (repo *repo) names(ctx context.Context) ([]string, error) {
+	_, span := repository.StartSpan(ctx, "store.walk")
+	names := []string{}
+	err := fs.WalkDir(repo.handler.Local, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "tags" {
+			names = append(names, path.Dir(p))
+			return fs.SkipDir
+		}
+		if d.IsDir() && (d.Name() == "manifests" || d.Name() == "blob") {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	repository.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (repo *repo) tags(name string) ([]string, error) {
+	entries, err := fs.ReadDir(repo.handler.Local, path.Join(name, "tags"))
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			tags = append(tags, entry.Name())
+		}
+	}
+	return tags, nil
+}
+
+func writeManifest(w http.ResponseWriter, digest string, content []byte) {
+	w.Header().Set("Content-Type", manifestMediaType(content))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
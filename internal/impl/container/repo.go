@@ -4,19 +4,26 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 
 	"github.com/davidjspooner/dsfile/pkg/store"
 	"github.com/davidjspooner/dshttp/pkg/httpclient"
 	"github.com/davidjspooner/dshttp/pkg/middleware"
+	"github.com/davidjspooner/dsrepo/internal/audit"
 	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type repo struct {
 	handler *repository.Handler
-	order   int
 	client  httpclient.Interface
+	uploads uploads
+	virtual *repository.Virtual[*repo]
 }
 
 func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
@@ -27,15 +34,24 @@ func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
 		return nil, err
 	}
 
+	repo.handler.Webhooks.Envelope = webhook.DockerEnvelope
+	repo.handler.ErrorFormat = repository.OCIError
+	repo.handler.Browse = repo.browse
+	if repo.handler.Upstream == nil {
+		//pull-through blobs have no local manifests so would all look unreferenced
+		repo.handler.CollectGarbage = repo.collectGarbage
+	}
+
 	if repo.handler.Upstream != nil {
-		repo.client = httpclient.NewClient(http.DefaultClient, &middleware.BearerAuthenticator{})
+		tracedClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+		repo.client = httpclient.NewClient(tracedClient, &middleware.BearerAuthenticator{})
 	}
 
 	return repo, nil
 }
 
 func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
-	return true
+	return repo.handler.Authorize(w, r, operation, parsed.name)
 }
 
 func (repo *repo) getBlobByDigest(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
@@ -43,9 +59,10 @@ func (repo *repo) getBlobByDigest(parsed *parsedRequest, w http.ResponseWriter,
 		return
 	}
 	if repo.handler.Local != nil {
-		path := parsed.name + "/blob/" + parsed.digest
-		if repo.handler.LocalFileExists(path) {
+		path := blobPath(parsed.name, parsed.digest)
+		if repo.handler.LocalFileExists(r.Context(), path) {
 			repo.handler.HandleLocalGet(path, parsed.logger, w, r)
+			return
 		}
 		if repo.handler.Upstream != nil {
 			//fetch and cache the blob
@@ -53,6 +70,10 @@ func (repo *repo) getBlobByDigest(parsed *parsedRequest, w http.ResponseWriter,
 			repo.ProxyUpstream(parsed, &brw, r)
 			if brw.status == http.StatusOK {
 				//store the blob
+				_, span := repository.StartSpan(r.Context(), "blob.cache",
+					attribute.String("store.target", path),
+					attribute.Int("store.size", brw.body.Len()),
+				)
 				etag := r.Header.Get("ETag")
 				if etag == "" {
 					hmac := md5.New()
@@ -68,13 +89,15 @@ func (repo *repo) getBlobByDigest(parsed *parsedRequest, w http.ResponseWriter,
 
 				rFile, err := repo.handler.Local.Create(path, info.FileInfo())
 				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
+					repository.EndSpan(span, err)
+					repo.handler.Fail(w, http.StatusInternalServerError, "", "could not cache blob")
 					return
 				}
 				defer rFile.Close()
 				_, err = io.Copy(rFile, &brw.body)
+				repository.EndSpan(span, err)
 				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
+					repo.handler.Fail(w, http.StatusInternalServerError, "", "could not cache blob")
 					return
 				}
 			}
@@ -85,77 +108,146 @@ func (repo *repo) getBlobByDigest(parsed *parsedRequest, w http.ResponseWriter,
 			io.Copy(w, &brw.body)
 			return
 		}
+		repo.handler.Fail(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
 	}
 
 	if repo.handler.Upstream != nil {
 		repo.ProxyUpstream(parsed, w, r)
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
-}
-
-func (repo *repo) uploadBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
-	if !repo.IsAllowed(parsed, w, r, "PUT") {
-		return
-	}
-	w.WriteHeader(http.StatusNotImplemented)
-}
-
-func (repo *repo) updateBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
-	if !repo.IsAllowed(parsed, w, r, "PUT") {
-		return
-	}
-	w.WriteHeader(http.StatusNotImplemented)
+	repo.handler.Fail(w, http.StatusNotImplemented, "", "")
 }
 
 func (repo *repo) deleteBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "DELETE") {
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+	repo.handler.Fail(w, http.StatusNotImplemented, "UNSUPPORTED", "blob deletion is not supported")
 }
 
 func (repo *repo) getManifest(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "GET") {
 		return
 	}
+	if repo.handler.Local != nil {
+		digest, content, err := repo.readManifest(parsed.name, parsed.reference)
+		if err == nil {
+			writeManifest(w, digest, content)
+			repo.handler.Notify(r, webhook.ActionPull, webhook.Target{
+				Name:      parsed.name,
+				Tag:       tagOf(parsed.reference),
+				Digest:    digest,
+				Size:      int64(len(content)),
+				MediaType: manifestMediaType(content),
+			})
+			return
+		}
+	}
 	if repo.handler.Upstream != nil {
 		repo.ProxyUpstream(parsed, w, r)
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+	repo.handler.Fail(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown to registry")
 }
 
 func (repo *repo) putManifest(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "PUT") {
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+	defer r.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read manifest")
+		return
+	}
+	if len(content) > maxManifestSize {
+		repo.handler.Fail(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", "manifest is too large")
+		return
+	}
+	target := manifestPath(parsed.name, parsed.reference)
+	if !isDigest(parsed.reference) {
+		target = tagPath(parsed.name, parsed.reference)
+	}
+	action := audit.ActionPush
+	if repo.handler.LocalFileExists(r.Context(), target) {
+		action = audit.ActionOverwrite
+	}
+	digest, err := repo.storeManifest(parsed.name, parsed.reference, content)
+	if err != nil {
+		parsed.logger.Error("manifest:store", slog.String("name", parsed.name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+	repo.handler.AuditWrite(r, action, target, digest, int64(len(content)))
+	mediaType := r.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = manifestMediaType(content)
+	}
+	repo.handler.Notify(r, webhook.ActionPush, webhook.Target{
+		Name:      parsed.name,
+		Tag:       tagOf(parsed.reference),
+		Digest:    digest,
+		Size:      int64(len(content)),
+		MediaType: mediaType,
+	})
+	w.Header().Set("Location", "/v2/"+parsed.name+"/manifests/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func tagOf(reference string) string {
+	if isDigest(reference) {
+		return ""
+	}
+	return reference
 }
 
 func (repo *repo) deleteManifest(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "DELETE") {
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+	repo.handler.Fail(w, http.StatusNotImplemented, "UNSUPPORTED", "manifest deletion is not supported")
 }
 
 func (repo *repo) getTags(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "LIST") {
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+	tags, err := repo.tags(parsed.name)
+	if err != nil && repo.handler.Upstream != nil {
+		repo.ProxyUpstream(parsed, w, r)
+		return
+	}
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tagList{Name: parsed.name, Tags: tags})
+}
+
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
 }
 
 func (repo *repo) ProxyUpstream(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if repo.handler.Upstream == nil {
-		w.WriteHeader(http.StatusNotImplemented)
+		repo.handler.Fail(w, http.StatusNotImplemented, "", "")
 		return
 	}
 
-	proxyRequest, err := http.NewRequest(r.Method, repo.handler.Upstream.String()+r.URL.Path, r.Body)
+	ctx, span := repository.StartSpan(r.Context(), "upstream.proxy",
+		attribute.String("upstream.url", repo.handler.Upstream.String()),
+		attribute.String("container.name", parsed.name),
+	)
+	var err error
+	defer func() { repository.EndSpan(span, err) }()
+
+	proxyRequest, err := http.NewRequestWithContext(ctx, r.Method, repo.handler.Upstream.String()+r.URL.Path, r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
 		return
 	}
 	proxyRequest.Header = r.Header
@@ -163,9 +255,10 @@ func (repo *repo) ProxyUpstream(parsed *parsedRequest, w http.ResponseWriter, r
 
 	response, err := repo.client.Do(proxyRequest)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		repo.handler.Fail(w, http.StatusBadGateway, "", "could not reach upstream")
 		return
 	}
+	span.SetAttributes(attribute.Int("upstream.status", response.StatusCode))
 	defer response.Body.Close()
 	wh := w.Header()
 	for k, v := range response.Header {
@@ -0,0 +1,66 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+type handlerFunc func(*parsedRequest, http.ResponseWriter, *http.Request)
+
+// call serves one request with a handler of the repository. The routes of the
+// type have wildcards inside the path, so tests hand the parsed request in.
+func call(handle handlerFunc, parsed *parsedRequest, method, target string, body []byte) *httptest.ResponseRecorder {
+	parsed.logger = *slog.Default()
+	rec := httptest.NewRecorder()
+	handle(parsed, rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+	return rec
+}
+
+func TestManifestPushIsAudited(t *testing.T) {
+	repotest.Mount(t)
+	log := repotest.Audit(t)
+	repo, err := newRepo(context.Background(), &repository.Config{Name: "container-audit", Type: "container", Items: []string{"lib/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method string, handle handlerFunc, body []byte) *httptest.ResponseRecorder {
+		return call(handle, &parsedRequest{name: "lib/app", reference: "v1", repo: repo}, method, "/v2/lib/app/manifests/v1", body)
+	}
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`)
+	sum := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	for range 2 {
+		if rec := do("PUT", repo.putManifest, manifest); rec.Code != http.StatusCreated {
+			t.Fatalf("put manifest = %d %s", rec.Code, rec.Body)
+		}
+	}
+	if rec := do("GET", repo.getManifest, nil); rec.Header().Get("Docker-Content-Digest") != digest {
+		t.Fatalf("get manifest = %d, digest %q", rec.Code, rec.Header().Get("Docker-Content-Digest"))
+	}
+
+	events, err := log.Query(&audit.Filter{Repository: "container-audit", Target: tagPath("lib/app", "v1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []audit.Action
+	for _, event := range events {
+		if event.Digest != digest || event.Size != int64(len(manifest)) {
+			t.Errorf("event %+v does not describe the manifest", event)
+		}
+		actions = append(actions, event.Action)
+	}
+	if len(actions) != 2 || actions[0] != audit.ActionPush || actions[1] != audit.ActionOverwrite {
+		t.Fatalf("audited %v, want a push then an overwrite", actions)
+	}
+}
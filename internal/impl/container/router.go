@@ -5,15 +5,14 @@ import (
 	"log/slog"
 	"net/http"
 
-	"github.com/davidjspooner/dshttp/pkg/httphandler"
 	"github.com/davidjspooner/dshttp/pkg/mux"
-	"github.com/davidjspooner/dsmatch/pkg/matcher"
 	"github.com/davidjspooner/dsrepo/internal/repository"
 )
 
 type Router struct {
-	repos matcher.Tree[*repo]
-	count int
+	routes   repository.Routes[*repo]
+	named    map[string]*repo
+	virtuals []*repo
 }
 
 type parsedRequest struct {
@@ -25,7 +24,7 @@ type parsedRequest struct {
 }
 
 func init() {
-	repository.RegisterRouter("container", &Router{})
+	repository.RegisterRouter("container", &Router{named: make(map[string]*repo)})
 }
 
 /*
@@ -49,21 +48,17 @@ func (router *Router) NewRepo(ctx context.Context, config *repository.Config) er
 	if err != nil {
 		return err
 	}
-	router.count++
-	repo.order = router.count
-	for _, item := range config.Items {
-		seq, err := repository.NewGlob([]byte(item), '/')
-		if err != nil {
-			return err
-		}
-		leaf, err := router.repos.Add(seq)
-		if err != nil {
-			return err
-		}
-		leaf.Payload = repo
-	}
+	router.named[config.Name] = repo
+	return router.routes.Add(config, repo)
+}
 
-	return nil
+func (router *Router) NewVirtual(ctx context.Context, config *repository.Config) error {
+	repo, err := newVirtual(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.virtuals = append(router.virtuals, repo)
+	return router.routes.Add(config, repo)
 }
 
 func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
@@ -71,26 +66,24 @@ func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *pars
 	parsed.name = r.PathValue("name")
 	parsed.digest = r.PathValue("digest")
 	parsed.reference = r.PathValue("reference")
-	leaves := router.repos.FindLeaves([]byte(parsed.name))
-	if len(leaves) == 0 {
-		w.WriteHeader(http.StatusNotFound)
+	if !parsed.validate(w) {
 		return nil
 	}
-	if len(leaves) > 1 {
-		w.WriteHeader(http.StatusConflict)
-		w.Write([]byte("ambiguous request"))
+	parsed.logger = repository.RequestLogger(r)
+	route := router.routes.Select(parsed.name, &parsed.logger)
+	if route == nil {
+		ociError.Fail(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
 		return nil
 	}
-	parsed.repo = leaves[0].Payload
-	obs, _ := httphandler.GetObservation(r)
-	if obs != nil {
-		parsed.logger = obs.Logger
-	}
+	parsed.repo = route.Repo
 	return parsed
 }
 
 func (router *Router) SetupRoutes(aMux mux.Mux) error {
-	if router.repos.IsEmpty() {
+	if err := router.resolveVirtuals(); err != nil {
+		return err
+	}
+	if router.routes.IsEmpty() {
 		return nil
 	}
 	aMux.HandleFunc("GET /v2/{$}", func(w http.ResponseWriter, r *http.Request) {
@@ -98,70 +91,70 @@ func (router *Router) SetupRoutes(aMux mux.Mux) error {
 		w.WriteHeader(http.StatusOK)
 	})
 	aMux.HandleFunc("GET /v2/_catalog", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		ociError.Fail(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "the catalog is not served")
 	})
 	aMux.HandleFunc("GET /v2/{name...}/blobs/{digest}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.getBlobByDigest(parsed, w, r)
+		parsed.repo.read(parsed, w, r, "GET", (*repo).getBlobByDigest)
 	})
 	aMux.HandleFunc("POST /v2/{name...}/blobs/uploads/{$}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.uploadBlob(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "PUT", (*repo).uploadBlob)
 	})
 	aMux.HandleFunc("PATCH /v2/{name...}/blobs/uploads/{reference}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.updateBlob(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "PUT", (*repo).updateBlob)
 	})
 	aMux.HandleFunc("PUT /v2/{name...}/blobs/uploads/{reference}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.updateBlob(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "PUT", (*repo).finishBlob)
 	})
 	aMux.HandleFunc("DELETE /v2/{name...}/blobs/{$}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.deleteBlob(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "DELETE", (*repo).deleteBlob)
 	})
 	aMux.HandleFunc("GET /v2/{name...}/manifests/{reference}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.getManifest(parsed, w, r)
+		parsed.repo.read(parsed, w, r, "GET", (*repo).getManifest)
 	})
 	aMux.HandleFunc("PUT /v2/{name...}/manifests/{reference}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.putManifest(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "PUT", (*repo).putManifest)
 	})
 	aMux.HandleFunc("DELETE /v2/{name...}/manifests/{reference}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.deleteManifest(parsed, w, r)
+		parsed.repo.write(parsed, w, r, "DELETE", (*repo).deleteManifest)
 	})
 	aMux.HandleFunc("GET /v2/{name...}/tags/list", func(w http.ResponseWriter, r *http.Request) {
 		parsed := router.ParseRequest(w, r)
 		if parsed == nil {
 			return
 		}
-		parsed.repo.getTags(parsed, w, r)
+		parsed.repo.listTags(parsed, w, r)
 	})
 
 	// sm, _ := aMux.(*mux.ServeMux)
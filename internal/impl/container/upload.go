@@ -0,0 +1,259 @@
+package container
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+	"github.com/davidjspooner/dsrepo/internal/audit"
+)
+
+const (
+	// uploadIdleTimeout drops sessions a client abandoned, their temporary
+	// file is removed with them
+	uploadIdleTimeout = time.Hour
+	// maxUploads bounds the sessions open at once
+	maxUploads = 1024
+)
+
+var errTooManyUploads = errors.New("too many uploads in progress")
+
+// upload is a blob upload session, chunks are spooled to a temporary file
+// until the final PUT names the digest
+type upload struct {
+	name    string
+	file    *os.File
+	size    int64
+	touched time.Time
+	busy    int // requests using the session, it is not expired while busy
+}
+
+type uploads struct {
+	lock     sync.Mutex
+	sessions map[string]*upload
+}
+
+func blobPath(name, digest string) string {
+	return name + "/blob/" + digest
+}
+
+func newUploadID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (session *upload) discard() {
+	session.file.Close()
+	os.Remove(session.file.Name())
+}
+
+// expire drops the idle sessions, the caller holds the lock
+func (u *uploads) expire(now time.Time) {
+	for id, session := range u.sessions {
+		if session.busy == 0 && now.Sub(session.touched) > uploadIdleTimeout {
+			delete(u.sessions, id)
+			session.discard()
+		}
+	}
+}
+
+// start opens a session, it is busy until released
+func (u *uploads) start(name string) (string, *upload, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	now := time.Now()
+	u.expire(now)
+	if len(u.sessions) >= maxUploads {
+		return "", nil, errTooManyUploads
+	}
+	file, err := os.CreateTemp("", "dsrepo-upload-*")
+	if err != nil {
+		return "", nil, err
+	}
+	id := newUploadID()
+	session := &upload{name: name, file: file, touched: now, busy: 1}
+	if u.sessions == nil {
+		u.sessions = make(map[string]*upload)
+	}
+	u.sessions[id] = session
+	return id, session, nil
+}
+
+// get returns a session of name, it is busy until released
+func (u *uploads) get(name, id string) *upload {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	now := time.Now()
+	u.expire(now)
+	session := u.sessions[id]
+	if session == nil || session.name != name {
+		return nil
+	}
+	session.busy++
+	session.touched = now
+	return session
+}
+
+func (u *uploads) release(session *upload) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	session.busy--
+	session.touched = time.Now()
+}
+
+func (u *uploads) finish(id string) {
+	u.lock.Lock()
+	session := u.sessions[id]
+	delete(u.sessions, id)
+	u.lock.Unlock()
+	if session != nil {
+		session.discard()
+	}
+}
+
+func (session *upload) append(r io.Reader) error {
+	n, err := io.Copy(session.file, r)
+	session.size += n
+	return err
+}
+
+func writeUploadStatus(w http.ResponseWriter, name, id string, size int64, status int) {
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", max(size-1, 0)))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+func (repo *repo) uploadBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "PUT") {
+		return
+	}
+	defer r.Body.Close()
+	id, session, err := repo.uploads.start(parsed.name)
+	if errors.Is(err, errTooManyUploads) {
+		repo.handler.Fail(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", err.Error())
+		return
+	}
+	if err != nil {
+		parsed.logger.Error("upload:start", slog.String("name", parsed.name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not start upload")
+		return
+	}
+	defer repo.uploads.release(session)
+	digest := r.URL.Query().Get("digest")
+	if digest == "" {
+		writeUploadStatus(w, parsed.name, id, 0, http.StatusAccepted)
+		return
+	}
+	// monolithic upload, the blob is the body of the POST
+	defer repo.uploads.finish(id)
+	err = session.append(r.Body)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not spool upload")
+		return
+	}
+	repo.commitBlob(parsed, session, digest, w, r)
+}
+
+func (repo *repo) updateBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "PUT") {
+		return
+	}
+	defer r.Body.Close()
+	session := repo.uploads.get(parsed.name, parsed.reference)
+	if session == nil {
+		repo.handler.Fail(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	defer repo.uploads.release(session)
+	err := session.append(r.Body)
+	if err != nil {
+		parsed.logger.Error("upload:append", slog.String("name", parsed.name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not spool upload")
+		return
+	}
+	writeUploadStatus(w, parsed.name, parsed.reference, session.size, http.StatusAccepted)
+}
+
+func (repo *repo) finishBlob(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "PUT") {
+		return
+	}
+	defer r.Body.Close()
+	session := repo.uploads.get(parsed.name, parsed.reference)
+	if session == nil {
+		repo.handler.Fail(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	defer repo.uploads.finish(parsed.reference)
+	err := session.append(r.Body)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not spool upload")
+		return
+	}
+	repo.commitBlob(parsed, session, r.URL.Query().Get("digest"), w, r)
+}
+
+// commitBlob verifies the spooled content against digest and moves it into the store
+func (repo *repo) commitBlob(parsed *parsedRequest, session *upload, digest string, w http.ResponseWriter, r *http.Request) {
+	if !isDigest(digest) {
+		repo.handler.Fail(w, http.StatusBadRequest, "DIGEST_INVALID", "a sha256 digest is required")
+		return
+	}
+	_, err := session.file.Seek(0, io.SeekStart)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read upload")
+		return
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, session.file)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read upload")
+		return
+	}
+	actual := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if actual != digest {
+		repo.handler.Fail(w, http.StatusBadRequest, "DIGEST_INVALID", "digest mismatch")
+		return
+	}
+	_, err = session.file.Seek(0, io.SeekStart)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read upload")
+		return
+	}
+	target := blobPath(parsed.name, digest)
+	info := store.Info{
+		Size:      session.size,
+		Mode:      0644,
+		EntityTag: digest,
+	}
+	wFile, err := repo.handler.Local.Create(target, info.FileInfo())
+	if err == nil {
+		_, err = io.Copy(wFile, session.file)
+		if closeErr := wFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		parsed.logger.Error("blob:write", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not store blob")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, digest, session.size)
+	w.Header().Set("Location", "/v2/"+parsed.name+"/blobs/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(0))
+	w.WriteHeader(http.StatusCreated)
+}
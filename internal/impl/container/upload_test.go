@@ -0,0 +1,114 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestUploadsExpire(t *testing.T) {
+	var u uploads
+	idle, session, err := u.start("lib/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.release(session)
+	busy, _, err := u.start("lib/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.touched = session.touched.Add(-2 * uploadIdleTimeout)
+	u.sessions[busy].touched = session.touched
+
+	if u.get("lib/app", idle) != nil {
+		t.Fatal("an idle session outlived uploadIdleTimeout")
+	}
+	if _, err := os.Stat(session.file.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("the spool file of an expired session is left behind: %v", err)
+	}
+	if u.get("lib/app", busy) == nil {
+		t.Fatal("a busy session was expired")
+	}
+	u.finish(busy)
+
+	for len(u.sessions) < maxUploads {
+		id, _, err := u.start("lib/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer u.finish(id)
+	}
+	if _, _, err := u.start("lib/app"); !errors.Is(err, errTooManyUploads) {
+		t.Fatalf("start() past maxUploads = %v, want errTooManyUploads", err)
+	}
+}
+
+func TestBlobUpload(t *testing.T) {
+	repotest.Mount(t)
+	config := &repository.Config{Name: "container-upload", Type: "container", Items: []string{"lib/*"}}
+	config.Policies = repotest.Policies(t, `
+- name: read
+  actions: ["container:get"]
+  resources: ["container:*"]
+- name: push-app
+  actions: ["container:put"]
+  resources: ["container:lib/app"]
+`)
+	repo, err := newRepo(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := func() *parsedRequest { return &parsedRequest{name: "lib/app", repo: repo} }
+	content := []byte("layer content")
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	// chunked: POST opens the session, PATCH appends, PUT commits
+	rec := call(repo.uploadBlob, app(), "POST", "/v2/lib/app/blobs/uploads/", nil)
+	id := rec.Header().Get("Docker-Upload-UUID")
+	if rec.Code != http.StatusAccepted || id == "" {
+		t.Fatalf("start = %d, upload %q", rec.Code, id)
+	}
+	session := app()
+	session.reference = id
+	for _, chunk := range [][]byte{content[:5], content[5:]} {
+		if rec := call(repo.updateBlob, session, "PATCH", "/v2/lib/app/blobs/uploads/"+id, chunk); rec.Code != http.StatusAccepted {
+			t.Fatalf("patch = %d %s", rec.Code, rec.Body)
+		}
+	}
+	if rec := call(repo.finishBlob, session, "PUT", "/v2/lib/app/blobs/uploads/"+id+"?digest="+digest, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("commit = %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(repo.updateBlob, session, "PATCH", "/v2/lib/app/blobs/uploads/"+id, content); rec.Code != http.StatusNotFound {
+		t.Errorf("patch after commit = %d, want 404", rec.Code)
+	}
+	blob := app()
+	blob.digest = digest
+	if rec := call(repo.getBlobByDigest, blob, "GET", "/v2/lib/app/blobs/"+digest, nil); !bytes.Equal(rec.Body.Bytes(), content) {
+		t.Fatalf("get blob = %d %q", rec.Code, rec.Body)
+	}
+
+	// monolithic: the blob is the body of the POST and must match the digest
+	if rec := call(repo.uploadBlob, app(), "POST", "/v2/lib/app/blobs/uploads/?digest="+digest, []byte("other content")); rec.Code != http.StatusBadRequest {
+		t.Errorf("mismatched monolithic upload = %d, want 400", rec.Code)
+	}
+	if rec := call(repo.uploadBlob, app(), "POST", "/v2/lib/app/blobs/uploads/?digest="+digest, content); rec.Code != http.StatusCreated {
+		t.Errorf("monolithic upload = %d %s", rec.Code, rec.Body)
+	}
+	if len(repo.uploads.sessions) != 0 {
+		t.Errorf("%d upload sessions left open", len(repo.uploads.sessions))
+	}
+
+	other := &parsedRequest{name: "lib/other", repo: repo}
+	if rec := call(repo.uploadBlob, other, "POST", "/v2/lib/other/blobs/uploads/", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("upload without permission = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+)
+
+type handleFunc func(repo *repo, parsed *parsedRequest, w http.ResponseWriter, r *http.Request)
+
+func newVirtual(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.Webhooks.Envelope = webhook.DockerEnvelope
+	repo.handler.ErrorFormat = repository.OCIError
+	return repo, nil
+}
+
+func memberHandler(member *repo) *repository.Handler {
+	return member.handler
+}
+
+func (router *Router) resolveVirtuals() error {
+	for _, virtual := range router.virtuals {
+		members, err := repository.ResolveVirtual(virtual.handler.Config, router.named, memberHandler)
+		if err != nil {
+			return err
+		}
+		virtual.virtual = members
+		virtual.handler.Browse = repository.BrowseMembers(members.Handlers)
+	}
+	router.virtuals = nil
+	return nil
+}
+
+// read answers from the first member of a virtual repository that has the item
+func (repo *repo) read(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string, handle handleFunc) {
+	if repo.virtual == nil {
+		handle(repo, parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, operation) {
+		return
+	}
+	repository.FirstFound(w, len(repo.virtual.Members), func(n int, w http.ResponseWriter) {
+		member := *parsed
+		member.repo = repo.virtual.Members[n]
+		handle(member.repo, &member, w, r)
+	})
+}
+
+// write hands a request for a virtual repository to its deploy member
+func (repo *repo) write(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string, handle handleFunc) {
+	if repo.virtual == nil {
+		handle(repo, parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, operation) {
+		return
+	}
+	deploy, ok := repo.virtual.Deploy()
+	if !ok {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "UNSUPPORTED", repo.handler.Name+" has no deploy member")
+		return
+	}
+	member := *parsed
+	member.repo = deploy
+	handle(deploy, &member, w, r)
+}
+
+// listTags merges the tag lists of the members of a virtual repository
+func (repo *repo) listTags(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.virtual == nil {
+		repo.getTags(parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, "LIST") {
+		return
+	}
+	bodies, ok := repository.Gather(w, len(repo.virtual.Members), func(n int, w http.ResponseWriter) {
+		member := *parsed
+		member.repo = repo.virtual.Members[n]
+		member.repo.getTags(&member, w, r)
+	})
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	merged := tagList{Name: parsed.name, Tags: []string{}}
+	for _, body := range bodies {
+		var list tagList
+		if json.Unmarshal(body, &list) != nil {
+			continue
+		}
+		for _, tag := range list.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+	}
+	sort.Strings(merged.Tags)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
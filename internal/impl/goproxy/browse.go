@@ -0,0 +1,57 @@
+package goproxy
+
+import (
+	"context"
+	"io/fs"
+	"path"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// browse lists the stored modules at the top level and their versions below a module
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	if p == "" {
+		list := []repository.BrowseEntry{}
+		err := fs.WalkDir(repo.handler.Local, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() || path.Base(name) != "@v" {
+				return nil
+			}
+			escaped := path.Dir(name)
+			modulePath, err := module.UnescapePath(escaped)
+			if err != nil {
+				return fs.SkipDir
+			}
+			list = append(list, repository.BrowseEntry{Name: modulePath, Path: escaped, Resource: modulePath})
+			return fs.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	modulePath, err := module.UnescapePath(p)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := repo.localVersions(p)
+	if err != nil {
+		return nil, err
+	}
+	semver.Sort(versions)
+	list := make([]repository.BrowseEntry, 0, len(versions))
+	for _, version := range versions {
+		entry := repository.BrowseEntry{Name: version, Resource: modulePath}
+		target, _ := versionPath(p, version, ".zip")
+		if stat, err := fs.Stat(repo.handler.Local, target); err == nil {
+			entry.Size = stat.Size()
+			entry.ModTime = stat.ModTime()
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
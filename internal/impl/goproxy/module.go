@@ -0,0 +1,92 @@
+package goproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// info is the body of a .info or @latest answer
+type info struct {
+	Version string
+	Time    time.Time
+}
+
+func versionDir(escaped string) string {
+	return escaped + "/@v"
+}
+
+func versionPath(escaped, version, ext string) (string, error) {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return versionDir(escaped) + "/" + escapedVersion + ext, nil
+}
+
+// modFromZip checks the layout of a module zip and returns its go.mod,
+// synthesizing one for modules that do not have one.
+func modFromZip(content []byte, modulePath, version string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	prefix := modulePath + "@" + version + "/"
+	var goMod []byte
+	for _, f := range reader.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return nil, fmt.Errorf("zip entry %q is not below %q", f.Name, prefix)
+		}
+		if f.Name != prefix+"go.mod" {
+			continue
+		}
+		rFile, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		goMod, err = io.ReadAll(rFile)
+		rFile.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if goMod == nil {
+		return []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(modulePath))), nil
+	}
+	declared := modfile.ModulePath(goMod)
+	if declared != modulePath {
+		return nil, fmt.Errorf("go.mod declares module %q, expected %q", declared, modulePath)
+	}
+	return goMod, nil
+}
+
+func encodeInfo(version string, t time.Time) ([]byte, error) {
+	return json.Marshal(info{Version: version, Time: t.UTC()})
+}
+
+// latestOf picks the highest release, falling back to the highest pre-release
+func latestOf(versions []string) string {
+	latest := ""
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" && semver.Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	if latest != "" {
+		return latest
+	}
+	for _, v := range versions {
+		if semver.Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
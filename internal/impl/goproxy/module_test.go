@@ -0,0 +1,81 @@
+package goproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestLatestOf(t *testing.T) {
+	tests := []struct {
+		versions []string
+		latest   string
+	}{
+		{versions: nil, latest: ""},
+		{versions: []string{"v1.0.0", "v1.2.0", "v1.10.0"}, latest: "v1.10.0"},
+		{versions: []string{"v1.0.0", "v2.0.0-rc.1"}, latest: "v1.0.0"},
+		{versions: []string{"v0.1.0-alpha", "v0.1.0-beta"}, latest: "v0.1.0-beta"},
+	}
+	for _, test := range tests {
+		if got := latestOf(test.versions); got != test.latest {
+			t.Errorf("latestOf(%v) = %q, want %q", test.versions, got, test.latest)
+		}
+	}
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestModFromZip(t *testing.T) {
+	const mod = "example.com/Acme/tool"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+		err   bool
+	}{
+		{
+			name:  "with go.mod",
+			files: map[string]string{mod + "@v1.0.0/go.mod": "module example.com/Acme/tool\n\ngo 1.22\n", mod + "@v1.0.0/main.go": "package main\n"},
+			want:  "module example.com/Acme/tool\n\ngo 1.22\n",
+		},
+		{
+			name:  "without go.mod",
+			files: map[string]string{mod + "@v1.0.0/main.go": "package main\n"},
+			want:  "module example.com/Acme/tool\n",
+		},
+		{
+			name:  "wrong prefix",
+			files: map[string]string{"example.com/other@v1.0.0/main.go": "package main\n"},
+			err:   true,
+		},
+		{
+			name:  "wrong module",
+			files: map[string]string{mod + "@v1.0.0/go.mod": "module example.com/other\n"},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		got, err := modFromZip(makeZip(t, test.files), mod, "v1.0.0")
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, wantErr %v", test.name, err, test.err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
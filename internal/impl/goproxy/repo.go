@@ -0,0 +1,369 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// upstream version lists
+	lists   *repository.Cache[[]string]
+	virtual *repository.Virtual[*repo]
+}
+
+const listCacheTTL = 5 * time.Minute
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		lists: repository.NewCacheMap[[]string](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.RegisterCache("lists", repo.lists)
+	repo.handler.Browse = repo.browse
+	repo.handler.Reindex = func(ctx context.Context) error {
+		repo.lists.Clear()
+		return nil
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
+	return repo.handler.Authorize(w, r, operation, parsed.module)
+}
+
+var contentTypes = map[string]string{
+	".info": "application/json",
+	".mod":  "text/plain; charset=utf-8",
+	".zip":  "application/zip",
+}
+
+// notFound answers with the status the go command treats as "try the next proxy"
+func notFound(w http.ResponseWriter, message string) {
+	plainError.Fail(w, http.StatusNotFound, "", message)
+}
+
+func (repo *repo) localVersions(escaped string) ([]string, error) {
+	entries, err := fs.ReadDir(repo.handler.Local, versionDir(escaped))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		version, err := module.UnescapeVersion(name)
+		if err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// upstreamVersions fetches outside the cache lock so a slow upstream only
+// delays the lookups of the module being fetched
+func (repo *repo) upstreamVersions(ctx context.Context, escaped string) ([]string, error) {
+	if cached, age, hit := repo.lists.Get(escaped); hit && age < listCacheTTL {
+		return *cached, nil
+	}
+	fetched, err := repo.fetchUpstreamVersions(ctx, escaped)
+	if err != nil {
+		return nil, err
+	}
+	repo.lists.Set(escaped, &fetched)
+	return fetched, nil
+}
+
+func (repo *repo) fetchUpstreamVersions(ctx context.Context, escaped string) ([]string, error) {
+	listURL := repo.handler.UpstreamURL(escaped, "@v", "list")
+	response, err := repo.handler.FetchUpstream(ctx, listURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	fetched := []string{}
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		// unknown upstream, remember that there is nothing there
+		return fetched, nil
+	default:
+		return nil, &repository.UpstreamError{URL: listURL, Status: response.StatusCode}
+	}
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fetched = append(fetched, line)
+		}
+	}
+	return fetched, scanner.Err()
+}
+
+// versions merges the local and upstream version lists
+func (repo *repo) versions(ctx context.Context, escaped string) ([]string, error) {
+	versions, err := repo.localVersions(escaped)
+	if err != nil {
+		return nil, err
+	}
+	if repo.handler.Upstream != nil {
+		upstream, err := repo.upstreamVersions(ctx, escaped)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range upstream {
+			if !slices.Contains(versions, v) {
+				versions = append(versions, v)
+			}
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+func (repo *repo) getList(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "list") {
+		return
+	}
+	versions, err := repo.versions(r.Context(), parsed.escaped)
+	if err != nil {
+		parsed.logger.Error("list:read", slog.String("module", parsed.module), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusBadGateway, "", "could not list versions")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, v := range versions {
+		io.WriteString(w, v+"\n")
+	}
+}
+
+func (repo *repo) getLatest(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "list") {
+		return
+	}
+	local, err := repo.localVersions(parsed.escaped)
+	if err != nil {
+		parsed.logger.Error("list:read", slog.String("module", parsed.module), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not list versions")
+		return
+	}
+	var latest []byte
+	latestVersion := latestOf(local)
+	if latestVersion != "" {
+		target, _ := versionPath(parsed.escaped, latestVersion, ".info")
+		latest, err = repo.handler.ReadLocal(target)
+		if err != nil {
+			parsed.logger.Error("info:read", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "could not read version info")
+			return
+		}
+	}
+	if repo.handler.Upstream != nil {
+		upstream, err := repo.upstreamLatest(r.Context(), parsed.escaped)
+		if err != nil {
+			parsed.logger.Error("latest:fetch", slog.String("module", parsed.module), slog.String("error", err.Error()))
+		}
+		if upstream != nil {
+			decoded := info{}
+			if json.Unmarshal(upstream, &decoded) == nil && latestOf([]string{latestVersion, decoded.Version}) == decoded.Version {
+				latest = upstream
+			}
+		}
+	}
+	if latest == nil {
+		notFound(w, "no versions of "+parsed.module)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(latest)
+}
+
+func (repo *repo) upstreamLatest(ctx context.Context, escaped string) ([]byte, error) {
+	latestURL := repo.handler.UpstreamURL(escaped, "@latest")
+	response, err := repo.handler.FetchUpstream(ctx, latestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(response.Body)
+	case http.StatusNotFound, http.StatusGone:
+		return nil, nil
+	default:
+		return nil, &repository.UpstreamError{URL: latestURL, Status: response.StatusCode}
+	}
+}
+
+func (repo *repo) getFile(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	if module.CanonicalVersion(parsed.version) != parsed.version {
+		// a query such as a branch name, only upstream can resolve it and the answer is not stable
+		repo.proxyUpstream(parsed, w, r)
+		return
+	}
+	target, err := versionPath(parsed.escaped, parsed.version, parsed.ext)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if !repo.handler.LocalFileExists(r.Context(), target) {
+		if repo.handler.Upstream == nil {
+			notFound(w, parsed.module+"@"+parsed.version+" not found")
+			return
+		}
+		escapedVersion, _ := module.EscapeVersion(parsed.version)
+		_, err = repo.handler.FetchToLocal(r.Context(), target, repo.handler.UpstreamURL(parsed.escaped, "@v", escapedVersion+parsed.ext))
+		if err != nil {
+			var upstreamErr *repository.UpstreamError
+			if errors.As(err, &upstreamErr) && (upstreamErr.Status == http.StatusNotFound || upstreamErr.Status == http.StatusGone) {
+				notFound(w, parsed.module+"@"+parsed.version+" not found")
+				return
+			}
+			parsed.logger.Error("file:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusBadGateway, "", "could not fetch from upstream")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentTypes[parsed.ext])
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+func (repo *repo) proxyUpstream(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.handler.Upstream == nil {
+		notFound(w, "unknown version "+parsed.version)
+		return
+	}
+	escapedVersion, err := module.EscapeVersion(parsed.version)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	response, err := repo.handler.FetchUpstream(r.Context(), repo.handler.UpstreamURL(parsed.escaped, "@v", escapedVersion+parsed.ext), nil)
+	if err != nil {
+		parsed.logger.Error("file:proxy", slog.String("module", parsed.module), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusBadGateway, "", "could not fetch from upstream")
+		return
+	}
+	defer response.Body.Close()
+	w.Header().Set("Content-Type", response.Header.Get("Content-Type"))
+	w.WriteHeader(response.StatusCode)
+	io.Copy(w, response.Body)
+}
+
+// upload publishes a private module version from its zip
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	if module.CanonicalVersion(parsed.version) != parsed.version {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "version must be a canonical semantic version")
+		return
+	}
+	err := module.Check(parsed.module, parsed.version)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	defer r.Body.Close()
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read content")
+		return
+	}
+	goMod, err := modFromZip(content, parsed.module, parsed.version)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	infoContent, err := encodeInfo(parsed.version, time.Now())
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	zipTarget, _ := versionPath(parsed.escaped, parsed.version, ".zip")
+	infoTarget, _ := versionPath(parsed.escaped, parsed.version, ".info")
+	modTarget, _ := versionPath(parsed.escaped, parsed.version, ".mod")
+	if repo.handler.LocalFileExists(r.Context(), infoTarget) {
+		// module versions are immutable, go.sum entries would break otherwise
+		repo.handler.Fail(w, http.StatusConflict, "", parsed.module+"@"+parsed.version+" already exists")
+		return
+	}
+	// the .info file is written last as it is what makes the version visible
+	for _, file := range []struct {
+		target  string
+		content []byte
+	}{{zipTarget, content}, {modTarget, goMod}, {infoTarget, infoContent}} {
+		err = repo.handler.WriteLocal(file.target, file.content)
+		if err != nil {
+			parsed.logger.Error("file:write", slog.String("target", file.target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "could not store module")
+			return
+		}
+	}
+	digest := sha256.Sum256(content)
+	repo.handler.RecordWrite(r, audit.ActionPush, zipTarget, "sha256:"+hex.EncodeToString(digest[:]), int64(len(content)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	infoTarget, err := versionPath(parsed.escaped, parsed.version, ".info")
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	// hide the version first so a partial delete does not leave a broken version listed
+	if repo.handler.LocalFileExists(r.Context(), infoTarget) {
+		err = repo.handler.RemoveLocal(infoTarget)
+		if err != nil {
+			parsed.logger.Error("file:deletion", slog.String("target", infoTarget), slog.String("error", err.Error()))
+		}
+	}
+	modTarget, _ := versionPath(parsed.escaped, parsed.version, ".mod")
+	if repo.handler.LocalFileExists(r.Context(), modTarget) {
+		repo.handler.RemoveLocal(modTarget)
+	}
+	zipTarget, _ := versionPath(parsed.escaped, parsed.version, ".zip")
+	repo.handler.HandleLocalDelete(zipTarget, parsed.logger, w, r)
+}
@@ -0,0 +1,67 @@
+package goproxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestUploadServesModuleVersions(t *testing.T) {
+	config := &repository.Config{Name: "goproxy-versions", Type: "goproxy", Items: []string{"*.example.com/*"}}
+	// module paths hold slashes, so publishing is granted on a path prefix
+	config.Policies = repotest.Policies(t, `
+- name: read
+  actions: ["goproxy:list", "goproxy:get"]
+  resources: ["goproxy:*"]
+- name: publish-dstool
+  actions: ["goproxy:put", "goproxy:delete"]
+  resources: ["goproxy:dstool.example.com/*"]
+`)
+	// the proxy serves every repository under one path, so the url names the module
+	client := repotest.NewRepo(t, &Router{named: make(map[string]*repo)}, config, "/goproxy/")
+	// the upper case letter checks the case encoding of module paths
+	const module = "dstool.example.com/!cli/"
+
+	content := makeZip(t, map[string]string{
+		"dstool.example.com/Cli@v1.2.3/go.mod":  "module dstool.example.com/Cli\n\ngo 1.22\n",
+		"dstool.example.com/Cli@v1.2.3/main.go": "package main\n",
+	})
+	if rec := client.Do("PUT", module+"@v/v1.2.3.zip", content, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("PUT", module+"@v/v1.2.3.zip", content, nil); rec.Code != http.StatusConflict {
+		t.Errorf("second upload = %d, want 409", rec.Code)
+	}
+	other := makeZip(t, map[string]string{"other.example.com/cli@v1.0.0/main.go": "package main\n"})
+	if rec := client.Do("PUT", "other.example.com/cli/@v/v1.0.0.zip", other, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("upload of another module = %d, want 403", rec.Code)
+	}
+
+	if rec := client.Get(module + "@v/v1.2.3.zip"); !bytes.Equal(rec.Body.Bytes(), content) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	// go reads the go.mod on its own before it downloads the zip
+	if rec := client.Get(module + "@v/v1.2.3.mod"); !strings.HasPrefix(rec.Body.String(), "module dstool.example.com/Cli") {
+		t.Errorf("mod = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get(module + "@v/list"); rec.Body.String() != "v1.2.3\n" {
+		t.Errorf("list = %d %q", rec.Code, rec.Body)
+	}
+	if rec := client.Get(module + "@latest"); !strings.Contains(rec.Body.String(), `"v1.2.3"`) {
+		t.Errorf("latest = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", module+"@v/v1.2.3.zip", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get(module + "@v/v1.2.3.info"); rec.Code != http.StatusNotFound {
+		t.Errorf("info after delete = %d, want 404", rec.Code)
+	}
+	if rec := client.Get(module + "@v/list"); rec.Body.String() != "" {
+		t.Errorf("list after delete = %d %q", rec.Code, rec.Body)
+	}
+}
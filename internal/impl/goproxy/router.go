@@ -0,0 +1,164 @@
+package goproxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"golang.org/x/mod/module"
+)
+
+type Router struct {
+	routes   repository.Routes[*repo]
+	named    map[string]*repo
+	virtuals []*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	module  string // decoded module path, used for matching and policies
+	escaped string // case encoded module path, used for storage and upstream
+	version string
+	ext     string // .info, .mod or .zip
+	list    bool
+	latest  bool
+	repo    *repo
+	logger  slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("goproxy", &Router{named: make(map[string]*repo)})
+}
+
+/*
+GET    /goproxy/<module>/@v/list
+GET    /goproxy/<module>/@v/<version>.info
+GET    /goproxy/<module>/@v/<version>.mod
+GET    /goproxy/<module>/@v/<version>.zip
+GET    /goproxy/<module>/@latest
+PUT    /goproxy/<module>/@v/<version>.zip
+DELETE /goproxy/<module>/@v/<version>.zip
+
+<module> and <version> use the case encoding of the go module proxy protocol
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.named[config.Name] = repo
+	return router.routes.Add(config, repo)
+}
+
+func (router *Router) NewVirtual(ctx context.Context, config *repository.Config) error {
+	repo, err := newVirtual(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.virtuals = append(router.virtuals, repo)
+	return router.routes.Add(config, repo)
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{}
+	p := r.PathValue("path")
+	if escaped, ok := strings.CutSuffix(p, "/@latest"); ok {
+		parsed.escaped = escaped
+		parsed.latest = true
+	} else {
+		escaped, rest, ok := strings.Cut(p, "/@v/")
+		if !ok {
+			plainError.Fail(w, http.StatusNotFound, "", "")
+			return nil
+		}
+		parsed.escaped = escaped
+		if rest == "list" {
+			parsed.list = true
+		} else {
+			for _, ext := range []string{".info", ".mod", ".zip"} {
+				if version, ok := strings.CutSuffix(rest, ext); ok {
+					parsed.ext = ext
+					parsed.version = version
+					break
+				}
+			}
+			if parsed.ext == "" || parsed.version == "" || strings.Contains(parsed.version, "/") {
+				plainError.Fail(w, http.StatusNotFound, "", "")
+				return nil
+			}
+			version, err := module.UnescapeVersion(parsed.version)
+			if err != nil {
+				plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+				return nil
+			}
+			parsed.version = version
+		}
+	}
+	var err error
+	parsed.module, err = module.UnescapePath(parsed.escaped)
+	if err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+
+	parsed.logger = repository.RequestLogger(r)
+	route := router.routes.Select(parsed.module, &parsed.logger)
+	if route == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	parsed.repo = route.Repo
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if err := router.resolveVirtuals(); err != nil {
+		return err
+	}
+	if router.routes.IsEmpty() {
+		return nil
+	}
+	aMux.HandleFunc("GET /goproxy/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.list:
+			parsed.repo.listVersions(parsed, w, r)
+		case parsed.latest:
+			parsed.repo.latestVersion(parsed, w, r)
+		default:
+			parsed.repo.read(parsed, w, r, "get", (*repo).getFile)
+		}
+	})
+	aMux.HandleFunc("PUT /goproxy/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		if parsed.ext != ".zip" {
+			plainError.Fail(w, http.StatusMethodNotAllowed, "", "")
+			return
+		}
+		parsed.repo.write(parsed, w, r, "put", (*repo).upload)
+	})
+	aMux.HandleFunc("DELETE /goproxy/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		if parsed.ext != ".zip" {
+			plainError.Fail(w, http.StatusMethodNotAllowed, "", "")
+			return
+		}
+		parsed.repo.write(parsed, w, r, "delete", (*repo).delete)
+	})
+	return nil
+}
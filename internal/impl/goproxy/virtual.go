@@ -0,0 +1,149 @@
+package goproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"golang.org/x/mod/semver"
+)
+
+type handleFunc func(repo *repo, parsed *parsedRequest, w http.ResponseWriter, r *http.Request)
+
+func newVirtual(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	return repo, nil
+}
+
+func memberHandler(member *repo) *repository.Handler {
+	return member.handler
+}
+
+func (router *Router) resolveVirtuals() error {
+	for _, virtual := range router.virtuals {
+		members, err := repository.ResolveVirtual(virtual.handler.Config, router.named, memberHandler)
+		if err != nil {
+			return err
+		}
+		virtual.virtual = members
+		virtual.handler.Browse = repository.BrowseMembers(members.Handlers)
+	}
+	router.virtuals = nil
+	return nil
+}
+
+// read answers from the first member of a virtual repository that has the file
+func (repo *repo) read(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string, handle handleFunc) {
+	if repo.virtual == nil {
+		handle(repo, parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, operation) {
+		return
+	}
+	repository.FirstFound(w, len(repo.virtual.Members), func(n int, w http.ResponseWriter) {
+		member := *parsed
+		member.repo = repo.virtual.Members[n]
+		handle(member.repo, &member, w, r)
+	})
+}
+
+// write hands a request for a virtual repository to its deploy member
+func (repo *repo) write(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string, handle handleFunc) {
+	if repo.virtual == nil {
+		handle(repo, parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, operation) {
+		return
+	}
+	deploy, ok := repo.virtual.Deploy()
+	if !ok {
+		repo.handler.Fail(w, http.StatusMethodNotAllowed, "", "")
+		return
+	}
+	member := *parsed
+	member.repo = deploy
+	handle(deploy, &member, w, r)
+}
+
+// listVersions merges the version lists of the members of a virtual repository
+func (repo *repo) listVersions(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.virtual == nil {
+		repo.getList(parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, "list") {
+		return
+	}
+	bodies, ok := repository.Gather(w, len(repo.virtual.Members), func(n int, w http.ResponseWriter) {
+		member := *parsed
+		member.repo = repo.virtual.Members[n]
+		member.repo.getList(&member, w, r)
+	})
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	versions := []string{}
+	for _, body := range bodies {
+		for _, v := range strings.Fields(string(body)) {
+			if !seen[v] {
+				seen[v] = true
+				versions = append(versions, v)
+			}
+		}
+	}
+	semver.Sort(versions)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, v := range versions {
+		io.WriteString(w, v+"\n")
+	}
+}
+
+// latestVersion answers with the latest version any member of a virtual
+// repository knows, ties go to the earlier member
+func (repo *repo) latestVersion(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if repo.virtual == nil {
+		repo.getLatest(parsed, w, r)
+		return
+	}
+	if !repo.IsAllowed(parsed, w, r, "list") {
+		return
+	}
+	bodies, ok := repository.Gather(w, len(repo.virtual.Members), func(n int, w http.ResponseWriter) {
+		member := *parsed
+		member.repo = repo.virtual.Members[n]
+		member.repo.getLatest(&member, w, r)
+	})
+	if !ok {
+		return
+	}
+	var latest []byte
+	latestVersion := ""
+	for _, body := range bodies {
+		decoded := info{}
+		if json.Unmarshal(body, &decoded) != nil {
+			continue
+		}
+		if latest == nil || (decoded.Version != latestVersion && latestOf([]string{latestVersion, decoded.Version}) == decoded.Version) {
+			latest = body
+			latestVersion = decoded.Version
+		}
+	}
+	if latest == nil {
+		notFound(w, "no versions of "+parsed.module)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(latest)
+}
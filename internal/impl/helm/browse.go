@@ -0,0 +1,37 @@
+package helm
+
+import (
+	"context"
+	"sort"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// browse lists chart names at the top level and their versions below a name
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	index, err := repo.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p == "" {
+		names := make([]string, 0, len(index.Entries))
+		for name := range index.Entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]repository.BrowseEntry, 0, len(names))
+		for _, name := range names {
+			list = append(list, repository.BrowseEntry{Name: name, Path: name, Resource: name})
+		}
+		return list, nil
+	}
+	list := []repository.BrowseEntry{}
+	for _, cv := range index.Entries[p] {
+		entry := repository.BrowseEntry{Name: cv.version(), Resource: p}
+		if appVersion, ok := cv["appVersion"].(string); ok {
+			entry.Info = "app " + appVersion
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
@@ -0,0 +1,154 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// media types helm uses when a chart is pushed to an OCI registry
+const (
+	ociConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	ociChartMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// chartVersion is an index entry, the fields of Chart.yaml plus urls, created and digest
+type chartVersion map[string]any
+
+func (cv chartVersion) name() string {
+	name, _ := cv["name"].(string)
+	return name
+}
+
+func (cv chartVersion) version() string {
+	version, _ := cv["version"].(string)
+	return version
+}
+
+type indexFile struct {
+	APIVersion string                    `yaml:"apiVersion"`
+	Entries    map[string][]chartVersion `yaml:"entries"`
+	Generated  time.Time                 `yaml:"generated"`
+}
+
+func newIndexFile() *indexFile {
+	return &indexFile{APIVersion: "v1", Entries: map[string][]chartVersion{}}
+}
+
+func parseIndex(content []byte) (*indexFile, error) {
+	index := newIndexFile()
+	err := yaml.Unmarshal(content, index)
+	if err != nil {
+		return nil, err
+	}
+	if index.Entries == nil {
+		index.Entries = map[string][]chartVersion{}
+	}
+	return index, nil
+}
+
+func (index *indexFile) encode() ([]byte, error) {
+	return yaml.Marshal(index)
+}
+
+func (index *indexFile) find(name, version string) int {
+	for i, cv := range index.Entries[name] {
+		if cv.version() == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// add puts a chart version in front of the other versions of the chart
+func (index *indexFile) add(cv chartVersion) {
+	name := cv.name()
+	if i := index.find(name, cv.version()); i >= 0 {
+		index.Entries[name] = append(index.Entries[name][:i], index.Entries[name][i+1:]...)
+	}
+	index.Entries[name] = append([]chartVersion{cv}, index.Entries[name]...)
+}
+
+func (index *indexFile) remove(name, version string) bool {
+	i := index.find(name, version)
+	if i < 0 {
+		return false
+	}
+	index.Entries[name] = append(index.Entries[name][:i], index.Entries[name][i+1:]...)
+	if len(index.Entries[name]) == 0 {
+		delete(index.Entries, name)
+	}
+	return true
+}
+
+func chartFilename(name, version string) string {
+	return name + "-" + version + ".tgz"
+}
+
+// validChartName rejects names that would escape the charts directory
+func validChartName(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "/\\") && !strings.HasPrefix(s, ".")
+}
+
+// readChart extracts Chart.yaml from a packaged chart and returns it as an
+// index entry that still needs its urls
+func readChart(content []byte) (chartVersion, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("chart archive has no Chart.yaml")
+		}
+		if err != nil {
+			return nil, err
+		}
+		dir, file := path.Split(strings.TrimPrefix(header.Name, "./"))
+		if file != "Chart.yaml" || strings.Count(dir, "/") != 1 {
+			continue
+		}
+		metadata, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		cv := chartVersion{}
+		err = yaml.Unmarshal(metadata, &cv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Chart.yaml: %w", err)
+		}
+		err = validateChart(cv)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		cv["digest"] = hex.EncodeToString(sum[:])
+		return cv, nil
+	}
+}
+
+func validateChart(cv chartVersion) error {
+	if !validChartName(cv.name()) {
+		return fmt.Errorf("invalid chart name %q", cv.name())
+	}
+	if !validChartName(cv.version()) {
+		return fmt.Errorf("invalid chart version %q", cv.version())
+	}
+	if cv["apiVersion"] == nil {
+		return fmt.Errorf("chart %s has no apiVersion", cv.name())
+	}
+	return nil
+}
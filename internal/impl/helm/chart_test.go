@@ -0,0 +1,85 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func makeChart(t *testing.T, files map[string]string) []byte {
+	buffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestReadChart(t *testing.T) {
+	content := makeChart(t, map[string]string{
+		"web/charts/db/Chart.yaml": "apiVersion: v2\nname: db\nversion: 9.9.9\n",
+		"web/Chart.yaml":           "apiVersion: v2\nname: web\nversion: 1.2.3\nappVersion: \"4.5\"\ndependencies:\n  - name: db\n    version: 9.9.9\n",
+		"web/values.yaml":          "replicas: 1\n",
+	})
+	cv, err := readChart(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv.name() != "web" || cv.version() != "1.2.3" || cv["appVersion"] != "4.5" {
+		t.Errorf("unexpected chart %v", cv)
+	}
+	if digest, _ := cv["digest"].(string); len(digest) != 64 {
+		t.Errorf("expected a sha256 digest, got %q", digest)
+	}
+
+	for name, files := range map[string]map[string]string{
+		"no chart":      {"web/values.yaml": "replicas: 1\n"},
+		"bad name":      {"web/Chart.yaml": "apiVersion: v2\nname: ../web\nversion: 1.0.0\n"},
+		"no version":    {"web/Chart.yaml": "apiVersion: v2\nname: web\n"},
+		"no apiVersion": {"web/Chart.yaml": "name: web\nversion: 1.0.0\n"},
+	} {
+		if _, err := readChart(makeChart(t, files)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	index := newIndexFile()
+	index.add(chartVersion{"apiVersion": "v2", "name": "web", "version": "1.0.0", "urls": []string{"charts/web-1.0.0.tgz"}})
+	index.add(chartVersion{"apiVersion": "v2", "name": "web", "version": "1.1.0", "urls": []string{"charts/web-1.1.0.tgz"}})
+	index.add(chartVersion{"apiVersion": "v2", "name": "api", "version": "0.1.0", "urls": []string{"charts/api-0.1.0.tgz"}})
+
+	content, err := index.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := parseIndex(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Entries["web"]) != 2 || decoded.Entries["web"][0].version() != "1.1.0" {
+		t.Fatalf("unexpected entries %v", decoded.Entries["web"])
+	}
+	if cv := decoded.findURL("charts/api-0.1.0.tgz"); cv == nil || cv.name() != "api" {
+		t.Errorf("findURL after decoding = %v", cv)
+	}
+	if !decoded.remove("api", "0.1.0") || decoded.remove("api", "0.1.0") {
+		t.Error("remove should succeed exactly once")
+	}
+	if _, ok := decoded.Entries["api"]; ok {
+		t.Error("removing the last version should remove the chart")
+	}
+}
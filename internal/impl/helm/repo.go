@@ -0,0 +1,404 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/impl/container"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// the served index, local charts merged with the OCI charts
+	indexes *repository.Cache[indexFile]
+}
+
+const (
+	indexTarget   = "index.yaml"
+	chartsDir     = "charts"
+	indexCacheTTL = time.Minute
+	maxChartSize  = 64 * 1024 * 1024
+)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		indexes: repository.NewCacheMap[indexFile](1),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.RegisterCache("index", repo.indexes)
+	repo.handler.Browse = repo.browse
+	repo.handler.ErrorFormat = repository.JSONError
+	repo.handler.Reindex = repo.rebuildIndex
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
+	return repo.handler.Authorize(w, r, operation, parsed.chart)
+}
+
+func chartTarget(filename string) string {
+	return chartsDir + "/" + filename
+}
+
+func (repo *repo) readLocalIndex() (*indexFile, error) {
+	content, err := repo.handler.ReadLocal(indexTarget)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newIndexFile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIndex(content)
+}
+
+func (repo *repo) writeLocalIndex(index *indexFile) error {
+	index.Generated = time.Now().UTC()
+	content, err := index.encode()
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(indexTarget, content)
+	repo.indexes.Clear()
+	return err
+}
+
+// rebuildIndex recreates index.yaml from the stored chart archives
+func (repo *repo) rebuildIndex(ctx context.Context) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	index := newIndexFile()
+	entries, err := fs.ReadDir(repo.handler.Local, chartsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tgz") {
+			continue
+		}
+		content, err := repo.handler.ReadLocal(chartTarget(entry.Name()))
+		if err != nil {
+			return err
+		}
+		cv, err := readChart(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		cv["urls"] = []string{chartTarget(entry.Name())}
+		if info, err := entry.Info(); err == nil {
+			cv["created"] = info.ModTime().UTC()
+		}
+		index.add(cv)
+	}
+	return repo.writeLocalIndex(index)
+}
+
+// index returns the local index merged with the charts in the configured
+// container repositories, limited to what the policies allow to be fetched
+func (repo *repo) index(ctx context.Context) (*indexFile, error) {
+	var result *indexFile
+	var err error
+	repo.indexes.Use(indexTarget, func(key string, cached *indexFile, age time.Duration) (*indexFile, bool) {
+		if cached != nil && age < indexCacheTTL {
+			result = cached
+			return cached, false
+		}
+		result, err = repo.readLocalIndex()
+		if err != nil {
+			return cached, false
+		}
+		for _, name := range repo.handler.Config.Containers {
+			repo.addOCICharts(ctx, result, name)
+		}
+		for name := range result.Entries {
+			if allowed, _ := repo.handler.Check("get", name); !allowed {
+				delete(result.Entries, name)
+			}
+		}
+		result.Generated = time.Now().UTC()
+		return result, true
+	})
+	return result, err
+}
+
+func (repo *repo) addOCICharts(ctx context.Context, index *indexFile, containerRepo string) {
+	handler := repository.LookupHandler(containerRepo)
+	if handler == nil || handler.Type != "container" {
+		return
+	}
+	artifacts, err := container.Artifacts(ctx, handler, ociConfigMediaType)
+	if err != nil {
+		return
+	}
+	for _, artifact := range artifacts {
+		if allowed, _ := handler.Check("get", artifact.Name); !allowed {
+			continue
+		}
+		i := slices.IndexFunc(artifact.Layers, func(layer container.Layer) bool { return layer.MediaType == ociChartMediaType })
+		if i < 0 {
+			continue
+		}
+		cv := chartVersion{}
+		if json.Unmarshal(artifact.Config, &cv) != nil || validateChart(cv) != nil {
+			continue
+		}
+		// a chart stored locally with the same version wins
+		if index.find(cv.name(), cv.version()) >= 0 {
+			continue
+		}
+		cv["urls"] = []string{path.Join("oci", containerRepo, artifact.Name, artifact.Tag+".tgz")}
+		cv["digest"] = strings.TrimPrefix(artifact.Layers[i].Digest, "sha256:")
+		index.Entries[cv.name()] = append(index.Entries[cv.name()], cv)
+	}
+}
+
+// findURL looks up the index entry that is served at url
+func (index *indexFile) findURL(url string) chartVersion {
+	for _, versions := range index.Entries {
+		for _, cv := range versions {
+			urls, _ := cv["urls"].([]any)
+			for _, u := range urls {
+				if u == url {
+					return cv
+				}
+			}
+			if stringURLs, ok := cv["urls"].([]string); ok && slices.Contains(stringURLs, url) {
+				return cv
+			}
+		}
+	}
+	return nil
+}
+
+func (repo *repo) getIndex(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	index, err := repo.index(r.Context())
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	content, err := index.encode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not encode index")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(content)
+}
+
+func (repo *repo) getChart(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	index, err := repo.index(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	cv := index.findURL(chartTarget(strings.TrimSuffix(parsed.filename, ".prov")))
+	if cv == nil {
+		writeError(w, http.StatusNotFound, "chart not found")
+		return
+	}
+	parsed.chart = cv.name()
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	repo.handler.HandleLocalGet(chartTarget(parsed.filename), parsed.logger, w, r)
+}
+
+func (repo *repo) getOCIChart(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	containerRepo := r.PathValue("container")
+	url := path.Join("oci", containerRepo, r.PathValue("path"))
+	index, err := repo.index(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	cv := index.findURL(url)
+	if cv == nil {
+		writeError(w, http.StatusNotFound, "chart not found")
+		return
+	}
+	parsed.chart = cv.name()
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	handler := repository.LookupHandler(containerRepo)
+	if handler == nil {
+		writeError(w, http.StatusNotFound, "chart not found")
+		return
+	}
+	name := path.Dir(r.PathValue("path"))
+	digest, _ := cv["digest"].(string)
+	blob, err := container.OpenBlob(handler, name, "sha256:"+digest)
+	if err != nil {
+		parsed.logger.Error("chart:open", slog.String("url", url), slog.String("error", err.Error()))
+		writeError(w, http.StatusNotFound, "chart not found")
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+chartFilename(cv.name(), cv.version()))
+	io.Copy(w, blob)
+}
+
+// readUpload returns the chart and the optional provenance file of an upload,
+// either a raw archive or a chartmuseum style multipart form
+func readUpload(r *http.Request) (chart, prov []byte, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		chart, err = io.ReadAll(io.LimitReader(r.Body, maxChartSize))
+		return chart, nil, err
+	}
+	err = r.ParseMultipartForm(maxChartSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	for field, target := range map[string]*[]byte{"chart": &chart, "prov": &prov} {
+		file, _, err := r.FormFile(field)
+		if errors.Is(err, http.ErrMissingFile) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		*target, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if chart == nil {
+		return nil, nil, fmt.Errorf("missing chart")
+	}
+	return chart, prov, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	repository.ErrorFormat(repository.JSONError).Fail(w, status, "", message)
+}
+
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	content, prov, err := readUpload(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cv, err := readChart(content)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	parsed.chart = cv.name()
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	if !repo.handler.Serves(parsed.chart) {
+		writeError(w, http.StatusBadRequest, "chart "+parsed.chart+" is not served by this repository")
+		return
+	}
+	filename := chartFilename(cv.name(), cv.version())
+	if parsed.filename != "" && parsed.filename != filename {
+		writeError(w, http.StatusBadRequest, "chart should be uploaded as "+filename)
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	index, err := repo.readLocalIndex()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	if index.find(cv.name(), cv.version()) >= 0 {
+		writeError(w, http.StatusConflict, filename+" already exists")
+		return
+	}
+	target := chartTarget(filename)
+	err = repo.handler.WriteLocal(target, content)
+	if err == nil && prov != nil {
+		err = repo.handler.WriteLocal(target+".prov", prov)
+	}
+	if err != nil {
+		parsed.logger.Error("chart:write", slog.String("target", target), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not store chart")
+		return
+	}
+	cv["urls"] = []string{target}
+	cv["created"] = time.Now().UTC()
+	index.add(cv)
+	err = repo.writeLocalIndex(index)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not update index")
+		return
+	}
+	digest, _ := cv["digest"].(string)
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+digest, int64(len(content)))
+	writeJSON(w, http.StatusCreated, map[string]bool{"saved": true})
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	index, err := repo.readLocalIndex()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read index")
+		return
+	}
+	if parsed.filename != "" {
+		cv := index.findURL(chartTarget(parsed.filename))
+		if cv == nil {
+			writeError(w, http.StatusNotFound, parsed.filename+" not found")
+			return
+		}
+		parsed.chart, parsed.version = cv.name(), cv.version()
+	}
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+	if !index.remove(parsed.chart, parsed.version) {
+		writeError(w, http.StatusNotFound, parsed.chart+" "+parsed.version+" not found")
+		return
+	}
+	target := chartTarget(chartFilename(parsed.chart, parsed.version))
+	err = repo.handler.HandleLocalDelete(target, parsed.logger, w, r)
+	if err != nil {
+		return
+	}
+	if repo.handler.LocalFileExists(r.Context(), target+".prov") {
+		repo.handler.RemoveLocal(target + ".prov")
+	}
+	err = repo.writeLocalIndex(index)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,99 @@
+package helm
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func minimalChart(t *testing.T, name, version string) []byte {
+	return makeChart(t, map[string]string{
+		name + "/Chart.yaml": "apiVersion: v2\nname: " + name + "\nversion: " + version + "\n",
+	})
+}
+
+// uploadBody is the multipart form the chartmuseum api accepts
+func uploadBody(t *testing.T, chart, prov []byte) ([]byte, http.Header) {
+	buffer := bytes.Buffer{}
+	form := multipart.NewWriter(&buffer)
+	for field, content := range map[string][]byte{"chart": chart, "prov": prov} {
+		part, err := form.CreateFormFile(field, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	form.Close()
+	return buffer.Bytes(), http.Header{"Content-Type": {form.FormDataContentType()}}
+}
+
+func getIndex(t *testing.T, client *repotest.Client) *indexFile {
+	rec := client.Get("index.yaml")
+	index, err := parseIndex(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("index.yaml = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	return index
+}
+
+func TestUploadUpdatesIndex(t *testing.T) {
+	config := &repository.Config{Name: "helm-index", Type: "helm", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "helm", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/helm/helm-index/")
+
+	// the index is cached, an upload has to replace the cached copy
+	if index := getIndex(t, client); len(index.Entries) != 0 {
+		t.Fatalf("empty repository index = %v", index.Entries)
+	}
+	chart := minimalChart(t, "dstool", "1.2.3")
+	if rec := client.Do("PUT", "charts/dstool-1.2.3.tgz", chart, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	body, header := uploadBody(t, chart, []byte("prov"))
+	if rec := client.Do("POST", "api/charts", body, header); rec.Code != http.StatusConflict {
+		t.Errorf("second upload = %d, want 409", rec.Code)
+	}
+	if rec := client.Do("PUT", "charts/dstool-9.9.9.tgz", minimalChart(t, "dstool", "1.3.0"), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("upload under another file name = %d, want 400", rec.Code)
+	}
+	if rec := client.Do("PUT", "charts/dsother-1.0.0.tgz", minimalChart(t, "dsother", "1.0.0"), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("upload of another chart = %d, want 403", rec.Code)
+	}
+	body, header = uploadBody(t, minimalChart(t, "dstool", "1.3.0"), []byte("prov"))
+	if rec := client.Do("POST", "api/charts", body, header); rec.Code != http.StatusCreated {
+		t.Fatalf("chartmuseum upload = %d %s", rec.Code, rec.Body)
+	}
+
+	index := getIndex(t, client)
+	versions := index.Entries["dstool"]
+	if len(versions) != 2 || versions[0].version() != "1.3.0" || versions[1].version() != "1.2.3" {
+		t.Fatalf("index entries = %v", index.Entries)
+	}
+	// helm resolves the urls against the index url
+	if urls, _ := versions[1]["urls"].([]any); len(urls) != 1 || urls[0] != "charts/dstool-1.2.3.tgz" {
+		t.Errorf("chart urls = %v", versions[1]["urls"])
+	}
+	if rec := client.Get("charts/dstool-1.2.3.tgz"); !bytes.Equal(rec.Body.Bytes(), chart) {
+		t.Errorf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec := client.Get("charts/dstool-1.3.0.tgz.prov"); rec.Body.String() != "prov" {
+		t.Errorf("provenance = %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "api/charts/dstool/1.3.0", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("chartmuseum delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("charts/dstool-1.3.0.tgz.prov"); rec.Code != http.StatusNotFound {
+		t.Errorf("provenance of a deleted chart = %d, want 404", rec.Code)
+	}
+	if rec := client.Do("DELETE", "charts/dstool-1.2.3.tgz", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if index := getIndex(t, client); len(index.Entries) != 0 {
+		t.Errorf("index after delete = %v", index.Entries)
+	}
+}
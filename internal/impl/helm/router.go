@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+type parsedRequest struct {
+	chart    string
+	version  string
+	filename string
+	repo     *repo
+	logger   slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("helm", &Router{})
+}
+
+/*
+GET    /helm/<repo>/index.yaml
+GET    /helm/<repo>/charts/<name>-<version>.tgz
+PUT    /helm/<repo>/charts/<name>-<version>.tgz
+DELETE /helm/<repo>/charts/<name>-<version>.tgz
+POST   /helm/<repo>/api/charts                   (chartmuseum compatible upload)
+DELETE /helm/<repo>/api/charts/<name>/<version>
+GET    /helm/<repo>/oci/<container repo>/<name>/<tag>.tgz
+
+Each helm repository has its own url as index.yaml lists the whole repository,
+items restricts which chart names may be uploaded.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		chart:    r.PathValue("chart"),
+		version:  r.PathValue("version"),
+		filename: r.PathValue("filename"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		writeError(w, http.StatusNotFound, "no such repository")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "chart", "version", "filename"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /helm/{repo}/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getIndex(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /helm/{repo}/charts/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getChart(parsed, w, r)
+	})
+	aMux.HandleFunc("PUT /helm/{repo}/charts/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /helm/{repo}/charts/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /helm/{repo}/api/charts", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /helm/{repo}/api/charts/{chart}/{version}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /helm/{repo}/oci/{container}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getOCIChart(parsed, w, r)
+	})
+	return nil
+}
@@ -0,0 +1,185 @@
+package maven
+
+import (
+	"encoding/xml"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const snapshotSuffix = "-SNAPSHOT"
+
+// lastUpdatedFormat is the yyyyMMddHHmmss layout of <lastUpdated> and <updated>
+const lastUpdatedFormat = "20060102150405"
+
+type snapshot struct {
+	Timestamp   string `xml:"timestamp,omitempty"`
+	BuildNumber int    `xml:"buildNumber,omitempty"`
+	LocalCopy   bool   `xml:"localCopy,omitempty"`
+}
+
+type snapshotVersion struct {
+	Classifier string `xml:"classifier,omitempty"`
+	Extension  string `xml:"extension"`
+	Value      string `xml:"value"`
+	Updated    string `xml:"updated"`
+}
+
+type versioning struct {
+	Latest           string            `xml:"latest,omitempty"`
+	Release          string            `xml:"release,omitempty"`
+	Snapshot         *snapshot         `xml:"snapshot,omitempty"`
+	Versions         []string          `xml:"versions>version,omitempty"`
+	LastUpdated      string            `xml:"lastUpdated,omitempty"`
+	SnapshotVersions []snapshotVersion `xml:"snapshotVersions>snapshotVersion,omitempty"`
+}
+
+// metadata is a maven-metadata.xml, either for an artifact (listing its
+// versions) or for a SNAPSHOT version (listing its timestamped files)
+type metadata struct {
+	XMLName    xml.Name   `xml:"metadata"`
+	GroupID    string     `xml:"groupId"`
+	ArtifactID string     `xml:"artifactId"`
+	Version    string     `xml:"version,omitempty"`
+	Versioning versioning `xml:"versioning"`
+}
+
+func parseMetadata(content []byte) (*metadata, error) {
+	m := &metadata{}
+	err := xml.Unmarshal(content, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *metadata) encode() ([]byte, error) {
+	content, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+func isSnapshot(version string) bool {
+	return strings.HasSuffix(version, snapshotSuffix)
+}
+
+// addVersion records a deployed version, maven treats the most recently
+// deployed version as the latest rather than comparing versions.
+func (m *metadata) addVersion(version string, now time.Time) {
+	if !slices.Contains(m.Versioning.Versions, version) {
+		m.Versioning.Versions = append(m.Versioning.Versions, version)
+	}
+	m.Versioning.Latest = version
+	if !isSnapshot(version) {
+		m.Versioning.Release = version
+	}
+	m.Versioning.LastUpdated = now.UTC().Format(lastUpdatedFormat)
+}
+
+func (m *metadata) removeVersion(version string, now time.Time) {
+	m.Versioning.Versions = slices.DeleteFunc(m.Versioning.Versions, func(v string) bool { return v == version })
+	m.Versioning.Latest = ""
+	m.Versioning.Release = ""
+	for _, v := range m.Versioning.Versions {
+		m.Versioning.Latest = v
+		if !isSnapshot(v) {
+			m.Versioning.Release = v
+		}
+	}
+	m.Versioning.LastUpdated = now.UTC().Format(lastUpdatedFormat)
+}
+
+// merge adds the versions of a newer or older copy of the same metadata
+func (m *metadata) merge(other *metadata) {
+	for _, v := range other.Versioning.Versions {
+		if !slices.Contains(m.Versioning.Versions, v) {
+			m.Versioning.Versions = append(m.Versioning.Versions, v)
+		}
+	}
+	if other.Versioning.LastUpdated > m.Versioning.LastUpdated {
+		m.Versioning.Latest = other.Versioning.Latest
+		if other.Versioning.Release != "" {
+			m.Versioning.Release = other.Versioning.Release
+		}
+		m.Versioning.LastUpdated = other.Versioning.LastUpdated
+	}
+}
+
+var timestampRegexp = regexp.MustCompile(`^(\d{8}\.\d{6})-(\d+)`)
+
+// artifactFile is a file name split into its maven coordinates
+type artifactFile struct {
+	Value      string // the version as it appears in the file name
+	Classifier string
+	Extension  string
+	Timestamp  string
+	Build      int
+}
+
+// parseArtifactFile splits <artifactId>-<value>[-<classifier>].<extension>
+// where value is the version or, for snapshots, the timestamped version
+func parseArtifactFile(artifactID, version, filename string) (*artifactFile, bool) {
+	rest, ok := strings.CutPrefix(filename, artifactID+"-")
+	if !ok {
+		return nil, false
+	}
+	f := &artifactFile{}
+	if after, ok := strings.CutPrefix(rest, version); ok {
+		f.Value = version
+		rest = after
+	} else if base, ok := strings.CutSuffix(version, snapshotSuffix); ok && strings.HasPrefix(rest, base+"-") {
+		match := timestampRegexp.FindStringSubmatch(rest[len(base)+1:])
+		if match == nil {
+			return nil, false
+		}
+		f.Timestamp = match[1]
+		f.Build, _ = strconv.Atoi(match[2])
+		f.Value = base + "-" + match[0]
+		rest = rest[len(f.Value):]
+	} else {
+		return nil, false
+	}
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		classifier, extension, ok := strings.Cut(rest[1:], ".")
+		if !ok || classifier == "" {
+			return nil, false
+		}
+		f.Classifier = classifier
+		f.Extension = extension
+	case strings.HasPrefix(rest, "."):
+		f.Extension = rest[1:]
+	default:
+		return nil, false
+	}
+	if f.Extension == "" {
+		return nil, false
+	}
+	return f, true
+}
+
+// addSnapshotFile records a deployed file in the metadata of a SNAPSHOT version
+func (m *metadata) addSnapshotFile(f *artifactFile, now time.Time) {
+	updated := now.UTC().Format(lastUpdatedFormat)
+	if f.Timestamp != "" {
+		if m.Versioning.Snapshot == nil || f.Build >= m.Versioning.Snapshot.BuildNumber {
+			m.Versioning.Snapshot = &snapshot{Timestamp: f.Timestamp, BuildNumber: f.Build}
+		}
+	} else if m.Versioning.Snapshot == nil {
+		m.Versioning.Snapshot = &snapshot{LocalCopy: true}
+	}
+	entry := snapshotVersion{Classifier: f.Classifier, Extension: f.Extension, Value: f.Value, Updated: updated}
+	index := slices.IndexFunc(m.Versioning.SnapshotVersions, func(sv snapshotVersion) bool {
+		return sv.Classifier == f.Classifier && sv.Extension == f.Extension
+	})
+	if index >= 0 {
+		m.Versioning.SnapshotVersions[index] = entry
+	} else {
+		m.Versioning.SnapshotVersions = append(m.Versioning.SnapshotVersions, entry)
+	}
+	m.Versioning.LastUpdated = updated
+}
@@ -0,0 +1,98 @@
+package maven
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArtifactFile(t *testing.T) {
+	tests := []struct {
+		version  string
+		filename string
+		want     artifactFile
+		ok       bool
+	}{
+		{version: "1.0", filename: "lib-1.0.jar", want: artifactFile{Value: "1.0", Extension: "jar"}, ok: true},
+		{version: "1.0", filename: "lib-1.0-sources.jar", want: artifactFile{Value: "1.0", Classifier: "sources", Extension: "jar"}, ok: true},
+		{version: "1.0", filename: "lib-1.0.tar.gz", want: artifactFile{Value: "1.0", Extension: "tar.gz"}, ok: true},
+		{version: "1.0", filename: "lib-1.0.jar.asc", want: artifactFile{Value: "1.0", Extension: "jar.asc"}, ok: true},
+		{
+			version:  "1.1-SNAPSHOT",
+			filename: "lib-1.1-20240102.030405-7-javadoc.jar",
+			want:     artifactFile{Value: "1.1-20240102.030405-7", Classifier: "javadoc", Extension: "jar", Timestamp: "20240102.030405", Build: 7},
+			ok:       true,
+		},
+		{version: "1.1-SNAPSHOT", filename: "lib-1.1-SNAPSHOT.pom", want: artifactFile{Value: "1.1-SNAPSHOT", Extension: "pom"}, ok: true},
+		{version: "1.0", filename: "other-1.0.jar"},
+		{version: "1.0", filename: "lib-2.0.jar"},
+		{version: "1.0", filename: "lib-1.0"},
+	}
+	for _, test := range tests {
+		got, ok := parseArtifactFile("lib", test.version, test.filename)
+		if ok != test.ok {
+			t.Errorf("parseArtifactFile(%q, %q) ok = %v, want %v", test.version, test.filename, ok, test.ok)
+			continue
+		}
+		if ok && *got != test.want {
+			t.Errorf("parseArtifactFile(%q, %q) = %+v, want %+v", test.version, test.filename, *got, test.want)
+		}
+	}
+}
+
+func TestMetadataVersions(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &metadata{GroupID: "com.example", ArtifactID: "lib"}
+	m.addVersion("1.0", now)
+	m.addVersion("1.1-SNAPSHOT", now)
+	m.addVersion("1.0", now)
+	if m.Versioning.Latest != "1.0" || m.Versioning.Release != "1.0" || len(m.Versioning.Versions) != 2 {
+		t.Fatalf("unexpected versioning %+v", m.Versioning)
+	}
+	m.addVersion("1.1-SNAPSHOT", now)
+	if m.Versioning.Latest != "1.1-SNAPSHOT" || m.Versioning.Release != "1.0" {
+		t.Fatalf("unexpected versioning %+v", m.Versioning)
+	}
+	m.removeVersion("1.0", now)
+	if m.Versioning.Release != "" || m.Versioning.Latest != "1.1-SNAPSHOT" {
+		t.Fatalf("unexpected versioning after remove %+v", m.Versioning)
+	}
+
+	content, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<groupId>com.example</groupId>", "<version>1.1-SNAPSHOT</version>", "<lastUpdated>20240102030405</lastUpdated>"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("encoded metadata is missing %s:\n%s", want, content)
+		}
+	}
+	decoded, err := parseMetadata(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Versioning.Latest != m.Versioning.Latest || len(decoded.Versioning.Versions) != 1 {
+		t.Errorf("round trip lost versions: %+v", decoded.Versioning)
+	}
+}
+
+func TestSnapshotMetadata(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &metadata{GroupID: "com.example", ArtifactID: "lib", Version: "1.1-SNAPSHOT"}
+	for _, filename := range []string{"lib-1.1-20240102.030405-1.jar", "lib-1.1-20240102.030405-1.pom", "lib-1.1-20240102.040000-2.jar"} {
+		f, ok := parseArtifactFile("lib", "1.1-SNAPSHOT", filename)
+		if !ok {
+			t.Fatalf("could not parse %s", filename)
+		}
+		m.addSnapshotFile(f, now)
+	}
+	if m.Versioning.Snapshot == nil || m.Versioning.Snapshot.BuildNumber != 2 || m.Versioning.Snapshot.Timestamp != "20240102.040000" {
+		t.Fatalf("unexpected snapshot %+v", m.Versioning.Snapshot)
+	}
+	if len(m.Versioning.SnapshotVersions) != 2 {
+		t.Fatalf("expected jar and pom entries, got %+v", m.Versioning.SnapshotVersions)
+	}
+	if m.Versioning.SnapshotVersions[0].Value != "1.1-20240102.040000-2" {
+		t.Errorf("jar entry was not replaced: %+v", m.Versioning.SnapshotVersions[0])
+	}
+}
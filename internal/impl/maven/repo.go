@@ -0,0 +1,388 @@
+package maven
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// raw upstream maven-metadata.xml files
+	upstream *repository.Cache[[]byte]
+}
+
+const upstreamCacheTTL = 5 * time.Minute
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		upstream: repository.NewCacheMap[[]byte](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.RegisterCache("metadata", repo.upstream)
+	repo.handler.Reindex = func(ctx context.Context) error {
+		repo.upstream.Clear()
+		return nil
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
+	return repo.handler.Authorize(w, r, operation, parsed.resource())
+}
+
+var checksumHashes = map[string]func() hash.Hash{
+	".sha1":   sha1.New,
+	".md5":    md5.New,
+	".sha256": sha256.New,
+	".sha512": sha512.New,
+}
+
+func checksum(content []byte, ext string) string {
+	h := checksumHashes[ext]()
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseChecksum accepts both a bare digest and the "<digest>  <filename>" form
+func parseChecksum(content []byte) string {
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// ensureLocal pulls a file through from upstream when it is not stored yet,
+// verifying it against the upstream .sha1 when there is one
+func (repo *repo) ensureLocal(ctx context.Context, target string) (int, error) {
+	if repo.handler.LocalFileExists(ctx, target) {
+		return http.StatusOK, nil
+	}
+	if repo.handler.Upstream == nil {
+		return http.StatusNotFound, fs.ErrNotExist
+	}
+	content, err := repo.handler.FetchToLocal(ctx, target, repo.handler.UpstreamURL(target))
+	if err != nil {
+		var upstreamErr *repository.UpstreamError
+		if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+			return http.StatusNotFound, err
+		}
+		return http.StatusBadGateway, err
+	}
+	response, err := repo.handler.FetchUpstream(ctx, repo.handler.UpstreamURL(target+".sha1"), nil)
+	if err != nil {
+		return http.StatusOK, nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return http.StatusOK, nil
+	}
+	expected, err := io.ReadAll(response.Body)
+	if err == nil && parseChecksum(expected) != checksum(content, ".sha1") {
+		repo.handler.RemoveLocal(target)
+		return http.StatusBadGateway, fmt.Errorf("sha1 mismatch for %s", target)
+	}
+	return http.StatusOK, nil
+}
+
+func (repo *repo) getFile(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	target := parsed.target()
+	status, err := repo.ensureLocal(r.Context(), target)
+	if err != nil {
+		parsed.logger.Error("file:fetch", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, status, "", "")
+		return
+	}
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+// readUpstreamMetadata fetches outside the cache lock so a slow upstream only
+// delays the lookups of the metadata being fetched
+func (repo *repo) readUpstreamMetadata(ctx context.Context, target string) (*metadata, error) {
+	if cached, age, hit := repo.upstream.Get(target); hit && age < upstreamCacheTTL {
+		return parseMetadata(*cached)
+	}
+	content, err := repo.fetchUpstreamMetadata(ctx, target)
+	var upstreamErr *repository.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		repo.upstream.Purge(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.upstream.Set(target, &content)
+	return parseMetadata(content)
+}
+
+func (repo *repo) fetchUpstreamMetadata(ctx context.Context, target string) ([]byte, error) {
+	response, err := repo.handler.FetchUpstream(ctx, repo.handler.UpstreamURL(target), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &repository.UpstreamError{URL: response.Request.URL.String(), Status: response.StatusCode}
+	}
+	return io.ReadAll(response.Body)
+}
+
+// metadataContent returns the local metadata merged with the upstream one
+func (repo *repo) metadataContent(ctx context.Context, parsed *parsedRequest) ([]byte, error) {
+	target := parsed.target()
+	local, localErr := repo.handler.ReadLocal(target)
+	if repo.handler.Upstream == nil {
+		return local, localErr
+	}
+	upstream, err := repo.readUpstreamMetadata(ctx, target)
+	if err != nil {
+		return local, localErr
+	}
+	if localErr == nil {
+		localMetadata, err := parseMetadata(local)
+		if err != nil {
+			return nil, err
+		}
+		upstream.merge(localMetadata)
+	}
+	return upstream.encode()
+}
+
+func (repo *repo) getMetadata(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	content, err := repo.metadataContent(r.Context(), parsed)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(content)
+}
+
+func (repo *repo) getChecksum(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	var content []byte
+	var err error
+	if parsed.metadata {
+		content, err = repo.metadataContent(r.Context(), parsed)
+	} else {
+		var status int
+		status, err = repo.ensureLocal(r.Context(), parsed.target())
+		if err != nil {
+			repo.handler.Fail(w, status, "", "")
+			return
+		}
+		content, err = repo.handler.ReadLocal(parsed.target())
+	}
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, checksum(content, parsed.checksum))
+}
+
+// putChecksum verifies an uploaded sidecar against the stored file,
+// sidecars themselves are always computed on demand
+func (repo *repo) putChecksum(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	defer r.Body.Close()
+	if parsed.metadata {
+		// the metadata is regenerated here so the client's checksum cannot match
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read checksum")
+		return
+	}
+	content, err := repo.handler.ReadLocal(parsed.target())
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "checksum uploaded before "+parsed.filename)
+		return
+	}
+	if parseChecksum(body) != checksum(content, parsed.checksum) {
+		parsed.logger.Error("checksum:verify", slog.String("target", parsed.target()), slog.String("checksum", parsed.checksum))
+		repo.handler.Fail(w, http.StatusBadRequest, "", parsed.checksum[1:]+" checksum mismatch for "+parsed.filename)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// putMetadata accepts the metadata maven uploads after a deploy. The metadata
+// is maintained by deploy, so an uploaded copy is only kept when there is none.
+func (repo *repo) putMetadata(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	defer r.Body.Close()
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read metadata")
+		return
+	}
+	_, err = parseMetadata(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid metadata: "+err.Error())
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	target := parsed.target()
+	if !repo.handler.LocalFileExists(r.Context(), target) {
+		err = repo.handler.WriteLocal(target, content)
+		if err != nil {
+			parsed.logger.Error("metadata:write", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+		repo.upstream.Purge(target)
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) deploy(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	file, ok := parseArtifactFile(parsed.artifact, parsed.version, parsed.filename)
+	if !ok {
+		repo.handler.Fail(w, http.StatusBadRequest, "", parsed.filename+" is not a file of "+parsed.artifact+" "+parsed.version)
+		return
+	}
+	target := parsed.target()
+	if !isSnapshot(parsed.version) && repo.handler.LocalFileExists(r.Context(), target) {
+		repo.handler.Fail(w, http.StatusConflict, "", "release "+parsed.version+" is already deployed")
+		return
+	}
+	err := repo.handler.HandleLocalPut(target, parsed.logger, w, r)
+	if err != nil {
+		return
+	}
+	err = repo.updateMetadata(parsed, file)
+	if err != nil {
+		parsed.logger.Error("metadata:update", slog.String("target", target), slog.String("error", err.Error()))
+	}
+}
+
+func (repo *repo) readLocalMetadata(target string, parsed *parsedRequest) (*metadata, error) {
+	content, err := repo.handler.ReadLocal(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &metadata{GroupID: strings.ReplaceAll(parsed.group, "/", "."), ArtifactID: parsed.artifact}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(content)
+}
+
+func (repo *repo) writeLocalMetadata(target string, m *metadata) error {
+	content, err := m.encode()
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(target, content)
+	if err != nil {
+		return err
+	}
+	repo.upstream.Purge(target)
+	return nil
+}
+
+func (repo *repo) updateMetadata(parsed *parsedRequest, file *artifactFile) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	now := time.Now()
+	artifactTarget := parsed.resource() + "/" + metadataFilename
+	m, err := repo.readLocalMetadata(artifactTarget, parsed)
+	if err != nil {
+		return err
+	}
+	m.addVersion(parsed.version, now)
+	err = repo.writeLocalMetadata(artifactTarget, m)
+	if err != nil {
+		return err
+	}
+	if !isSnapshot(parsed.version) {
+		return nil
+	}
+	versionTarget := parsed.resource() + "/" + parsed.version + "/" + metadataFilename
+	m, err = repo.readLocalMetadata(versionTarget, parsed)
+	if err != nil {
+		return err
+	}
+	m.Version = parsed.version
+	m.addSnapshotFile(file, now)
+	return repo.writeLocalMetadata(versionTarget, m)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+	err := repo.handler.HandleLocalDelete(parsed.target(), parsed.logger, w, r)
+	if err != nil {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	// once the last file of a version is gone the version leaves the metadata
+	versionDir := parsed.resource() + "/" + parsed.version
+	entries, err := fs.ReadDir(repo.handler.Local, versionDir)
+	if err == nil {
+		for _, entry := range entries {
+			if entry.Name() != metadataFilename {
+				return
+			}
+		}
+	}
+	if repo.handler.LocalFileExists(r.Context(), versionDir+"/"+metadataFilename) {
+		repo.handler.RemoveLocal(versionDir + "/" + metadataFilename)
+	}
+	artifactTarget := parsed.resource() + "/" + metadataFilename
+	m, err := repo.readLocalMetadata(artifactTarget, parsed)
+	if err == nil {
+		m.removeVersion(parsed.version, time.Now())
+		err = repo.writeLocalMetadata(artifactTarget, m)
+	}
+	if err != nil {
+		parsed.logger.Error("metadata:update", slog.String("target", artifactTarget), slog.String("error", err.Error()))
+	}
+}
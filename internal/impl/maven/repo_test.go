@@ -0,0 +1,158 @@
+package maven
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func getMetadata(t *testing.T, client *repotest.Client, target string) *metadata {
+	rec := client.Get(target)
+	m, err := parseMetadata(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("%s = %d %s: %v", target, rec.Code, rec.Body, err)
+	}
+	return m
+}
+
+func TestDeployUpdatesMetadata(t *testing.T) {
+	config := &repository.Config{Name: "maven-deploy", Type: "maven", Items: []string{"com/example/*"}}
+	config.Policies = repotest.PublishPolicies(t, "maven", "com/example/dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/maven/com/example/")
+
+	jar := []byte("jar")
+	if rec := client.Do("PUT", "dstool/1.2.3/dstool-1.2.3.jar", jar, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("deploy = %d %s", rec.Code, rec.Body)
+	}
+	// maven uploads the checksums after the file, they are checked not stored
+	if rec := client.Do("PUT", "dstool/1.2.3/dstool-1.2.3.jar.sha1", []byte(checksum(jar, ".sha1")), nil); rec.Code != http.StatusCreated {
+		t.Errorf("checksum upload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("PUT", "dstool/1.2.3/dstool-1.2.3.jar.md5", []byte(checksum([]byte("other"), ".md5")), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("wrong checksum upload = %d, want 400", rec.Code)
+	}
+	if rec := client.Do("PUT", "dstool/1.2.3/dstool-1.2.3.jar", jar, nil); rec.Code != http.StatusConflict {
+		t.Errorf("second deploy of a release = %d, want 409", rec.Code)
+	}
+	if rec := client.Do("PUT", "other/1.0/other-1.0.jar", jar, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("deploy of another artifact = %d, want 403", rec.Code)
+	}
+	if rec := client.Do("PUT", "dstool/1.2.3/tool-1.2.3.jar", jar, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("deploy of a file named for another artifact = %d, want 400", rec.Code)
+	}
+	for range 2 {
+		if rec := client.Do("PUT", "dstool/1.3.0-SNAPSHOT/dstool-1.3.0-20240102.030405-1.jar", jar, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("snapshot deploy = %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	m := getMetadata(t, client, "dstool/maven-metadata.xml")
+	if !slices.Equal(m.Versioning.Versions, []string{"1.2.3", "1.3.0-SNAPSHOT"}) || m.Versioning.Release != "1.2.3" || m.Versioning.Latest != "1.3.0-SNAPSHOT" {
+		t.Errorf("artifact metadata = %+v", m.Versioning)
+	}
+	rec := client.Get("dstool/maven-metadata.xml")
+	if sum := client.Get("dstool/maven-metadata.xml.sha1"); sum.Body.String() != checksum(rec.Body.Bytes(), ".sha1") {
+		t.Errorf("metadata sha1 = %q", sum.Body)
+	}
+	m = getMetadata(t, client, "dstool/1.3.0-SNAPSHOT/maven-metadata.xml")
+	if m.Versioning.Snapshot == nil || m.Versioning.Snapshot.Timestamp != "20240102.030405" || len(m.Versioning.SnapshotVersions) != 1 {
+		t.Errorf("snapshot metadata = %+v", m.Versioning)
+	}
+	if rec := client.Get("dstool/1.2.3/dstool-1.2.3.jar"); rec.Body.String() != "jar" {
+		t.Errorf("download = %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "dstool/1.2.3/dstool-1.2.3.jar", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	m = getMetadata(t, client, "dstool/maven-metadata.xml")
+	if !slices.Equal(m.Versioning.Versions, []string{"1.3.0-SNAPSHOT"}) || m.Versioning.Release != "" {
+		t.Errorf("artifact metadata after delete = %+v", m.Versioning)
+	}
+}
+
+func TestUpstreamMetadataIsCached(t *testing.T) {
+	var fetches atomic.Int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	jar := []byte("lib")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/example/slow/maven-metadata.xml":
+			fetching <- struct{}{}
+			<-release
+			http.NotFound(w, r)
+		case "/org/example/lib/maven-metadata.xml", "/org/example/util/maven-metadata.xml":
+			fetches.Add(1)
+			artifact := strings.Split(r.URL.Path, "/")[3]
+			fmt.Fprintf(w, `<metadata><groupId>org.example</groupId><artifactId>%s</artifactId><versioning><latest>1.0</latest><release>1.0</release><versions><version>1.0</version></versions><lastUpdated>20200101000000</lastUpdated></versioning></metadata>`, artifact)
+		case "/org/example/lib/1.0/lib-1.0.jar", "/org/example/util/1.0/util-1.0.jar":
+			w.Write(jar)
+		case "/org/example/lib/1.0/lib-1.0.jar.sha1":
+			fmt.Fprintf(w, "%s  lib-1.0.jar\n", checksum(jar, ".sha1"))
+		case "/org/example/util/1.0/util-1.0.jar.sha1":
+			w.Write([]byte(checksum([]byte("tampered"), ".sha1")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	config := &repository.Config{Name: "maven-upstream", Type: "maven", Items: []string{"org/example/*"}}
+	config.Upstream.Url = upstream.URL
+	client := repotest.NewRepo(t, &Router{}, config, "/maven/org/example/")
+
+	for range 2 {
+		if m := getMetadata(t, client, "lib/maven-metadata.xml"); !slices.Equal(m.Versioning.Versions, []string{"1.0"}) {
+			t.Fatalf("upstream metadata = %+v", m.Versioning)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fresh cached metadata was fetched %d times", fetches.Load())
+	}
+	// a deploy replaces the cached copy with the upstream one merged with the local one
+	if rec := client.Do("PUT", "lib/2.0/lib-2.0.jar", jar, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("deploy = %d %s", rec.Code, rec.Body)
+	}
+	if m := getMetadata(t, client, "lib/maven-metadata.xml"); !slices.Equal(m.Versioning.Versions, []string{"1.0", "2.0"}) || m.Versioning.Release != "2.0" {
+		t.Errorf("merged metadata = %+v", m.Versioning)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("metadata was fetched %d times after a deploy, want 2", fetches.Load())
+	}
+	if rec := client.Get("lib/1.0/lib-1.0.jar"); rec.Body.String() != "lib" {
+		t.Errorf("upstream jar = %d %q", rec.Code, rec.Body)
+	}
+	if rec := client.Get("util/1.0/util-1.0.jar"); rec.Code != http.StatusBadGateway {
+		t.Errorf("upstream jar with a wrong sha1 = %d, want 502", rec.Code)
+	}
+	if rec := client.Get("missing/maven-metadata.xml"); rec.Code != http.StatusNotFound {
+		t.Errorf("metadata missing upstream = %d, want 404", rec.Code)
+	}
+
+	// a slow upstream artifact must not hold up the lookups of other artifacts
+	slow := make(chan int, 1)
+	go func() { slow <- client.Get("slow/maven-metadata.xml").Code }()
+	<-fetching
+	fast := make(chan int, 1)
+	go func() { fast <- client.Get("util/maven-metadata.xml").Code }()
+	select {
+	case code := <-fast:
+		if code != http.StatusOK {
+			t.Errorf("metadata fetched during a slow fetch = %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a slow upstream fetch blocked another artifact")
+	}
+	close(release)
+	if code := <-slow; code != http.StatusNotFound {
+		t.Errorf("slow metadata = %d, want 404", code)
+	}
+}
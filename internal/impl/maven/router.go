@@ -0,0 +1,157 @@
+package maven
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	routes repository.Routes[*repo]
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	group    string // groupId with / separators
+	artifact string
+	version  string // empty for artifact level metadata
+	filename string // without any checksum extension
+	checksum string // .sha1, .md5, .sha256 or .sha512 when a sidecar is requested
+	metadata bool
+	repo     *repo
+	logger   slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("maven", &Router{})
+}
+
+/*
+GET    /maven/<group>/<artifact>/maven-metadata.xml[.<checksum>]
+GET    /maven/<group>/<artifact>/<version>/maven-metadata.xml[.<checksum>]  (SNAPSHOT versions)
+GET    /maven/<group>/<artifact>/<version>/<file>[.<checksum>]
+PUT    the same paths, checksums are verified against the stored file
+DELETE /maven/<group>/<artifact>/<version>/<file>
+
+<group> is the groupId with the dots replaced by /
+*/
+
+var checksumExtensions = []string{".sha1", ".md5", ".sha256", ".sha512"}
+
+const metadataFilename = "maven-metadata.xml"
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	return router.routes.Add(config, repo)
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{}
+	if err := repository.ValidatePath("path", r.PathValue("path")); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	parts := strings.Split(r.PathValue("path"), "/")
+	filename := parts[len(parts)-1]
+	for _, ext := range checksumExtensions {
+		if base, ok := strings.CutSuffix(filename, ext); ok {
+			filename = base
+			parsed.checksum = ext
+			break
+		}
+	}
+	parsed.filename = filename
+	dirs := parts[:len(parts)-1]
+	parsed.metadata = filename == metadataFilename
+	switch {
+	case parsed.metadata && len(dirs) >= 2 && !isSnapshot(dirs[len(dirs)-1]):
+		parsed.artifact = dirs[len(dirs)-1]
+		parsed.group = strings.Join(dirs[:len(dirs)-1], "/")
+	case len(dirs) >= 3:
+		parsed.version = dirs[len(dirs)-1]
+		parsed.artifact = dirs[len(dirs)-2]
+		parsed.group = strings.Join(dirs[:len(dirs)-2], "/")
+	default:
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+
+	parsed.logger = repository.RequestLogger(r)
+	route := router.routes.Select(parsed.resource(), &parsed.logger)
+	if route == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	parsed.repo = route.Repo
+	return parsed
+}
+
+// resource is the <group>/<artifact> path matched against items and policies
+func (parsed *parsedRequest) resource() string {
+	return parsed.group + "/" + parsed.artifact
+}
+
+// target is the path of the requested file in the store
+func (parsed *parsedRequest) target() string {
+	if parsed.version == "" {
+		return parsed.resource() + "/" + parsed.filename
+	}
+	return parsed.resource() + "/" + parsed.version + "/" + parsed.filename
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if router.routes.IsEmpty() {
+		return nil
+	}
+	aMux.HandleFunc("GET /maven/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.checksum != "":
+			parsed.repo.getChecksum(parsed, w, r)
+		case parsed.metadata:
+			parsed.repo.getMetadata(parsed, w, r)
+		default:
+			parsed.repo.getFile(parsed, w, r)
+		}
+	})
+	aMux.HandleFunc("PUT /maven/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.checksum != "":
+			parsed.repo.putChecksum(parsed, w, r)
+		case parsed.metadata:
+			parsed.repo.putMetadata(parsed, w, r)
+		case parsed.version == "":
+			plainError.Fail(w, http.StatusNotFound, "", "")
+		default:
+			parsed.repo.deploy(parsed, w, r)
+		}
+	})
+	aMux.HandleFunc("DELETE /maven/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		if parsed.checksum != "" || parsed.metadata || parsed.version == "" {
+			plainError.Fail(w, http.StatusMethodNotAllowed, "", "")
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+package npm
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// browse lists package names at the top level and the versions below a package
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	if p == "" {
+		return repo.browsePackages(ctx)
+	}
+	doc, err := repo.readLocalPackument(p)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string][]string)
+	for tag, version := range doc.DistTags {
+		tags[version] = append(tags[version], tag)
+	}
+	list := make([]repository.BrowseEntry, 0, len(doc.Versions))
+	for versionName, version := range doc.Versions {
+		be := repository.BrowseEntry{
+			Name:     versionName,
+			Resource: p,
+			Info:     strings.Join(tags[versionName], ", "),
+		}
+		if stat, err := fs.Stat(repo.handler.Local, tarballPath(p, tarballFilename(version))); err == nil {
+			be.Size = stat.Size()
+			be.ModTime = stat.ModTime()
+		}
+		list = append(list, be)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+func (repo *repo) browsePackages(ctx context.Context) ([]repository.BrowseEntry, error) {
+	_, span := repository.StartSpan(ctx, "store.walk")
+	list := []repository.BrowseEntry{}
+	err := fs.WalkDir(repo.handler.Local, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "-" {
+			return fs.SkipDir
+		}
+		if !d.IsDir() && d.Name() == "package.json" {
+			name := path.Dir(p)
+			list = append(list, repository.BrowseEntry{Name: name, Path: name, Resource: name})
+		}
+		return nil
+	})
+	repository.EndSpan(span, err)
+	return list, err
+}
@@ -0,0 +1,107 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+type attachment struct {
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+	Length      int64  `json:"length"`
+}
+
+// packument is the package document npm fetches for a package name
+type packument struct {
+	ID          string                    `json:"_id"`
+	Rev         string                    `json:"_rev,omitempty"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	DistTags    map[string]string         `json:"dist-tags"`
+	Versions    map[string]map[string]any `json:"versions"`
+	Time        map[string]string         `json:"time,omitempty"`
+	Readme      string                    `json:"readme,omitempty"`
+	Attachments map[string]*attachment    `json:"_attachments,omitempty"`
+}
+
+func parsePackument(content []byte) (*packument, error) {
+	doc := &packument{}
+	err := json.Unmarshal(content, doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.DistTags == nil {
+		doc.DistTags = make(map[string]string)
+	}
+	if doc.Versions == nil {
+		doc.Versions = make(map[string]map[string]any)
+	}
+	if doc.Time == nil {
+		doc.Time = make(map[string]string)
+	}
+	return doc, nil
+}
+
+func versionDist(version map[string]any) map[string]any {
+	dist, _ := version["dist"].(map[string]any)
+	return dist
+}
+
+// tarballFilename is the file part of a version's tarball url
+func tarballFilename(version map[string]any) string {
+	dist := versionDist(version)
+	if dist == nil {
+		return ""
+	}
+	tarball, _ := dist["tarball"].(string)
+	if tarball == "" {
+		return ""
+	}
+	if u, err := url.Parse(tarball); err == nil {
+		tarball = u.Path
+	}
+	return path.Base(tarball)
+}
+
+// rewriteTarballs points every version's tarball at baseURL
+func (doc *packument) rewriteTarballs(baseURL string) {
+	for _, version := range doc.Versions {
+		filename := tarballFilename(version)
+		if filename == "" {
+			continue
+		}
+		versionDist(version)["tarball"] = baseURL + "/" + doc.Name + "/-/" + filename
+	}
+}
+
+// splitName separates a package name, which may be scoped, from the rest of a path
+func splitName(p string) (name, rest string, err error) {
+	p = strings.Trim(p, "/")
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	parts := strings.SplitN(p, "/", 3)
+	switch {
+	case parts[0] == "":
+		return "", "", fmt.Errorf("missing package name")
+	case strings.HasPrefix(parts[0], "@"):
+		if len(parts) < 2 || parts[1] == "" {
+			return "", "", fmt.Errorf("invalid scoped package name %q", parts[0])
+		}
+		name = parts[0] + "/" + parts[1]
+		if len(parts) == 3 {
+			rest = parts[2]
+		}
+	default:
+		name = parts[0]
+		rest = strings.Join(parts[1:], "/")
+	}
+	return name, rest, nil
+}
+
+func defaultTarballFilename(name, version string) string {
+	return path.Base(name) + "-" + version + ".tgz"
+}
@@ -0,0 +1,69 @@
+package npm
+
+import (
+	"testing"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		path string
+		name string
+		rest string
+		err  bool
+	}{
+		{path: "left-pad", name: "left-pad"},
+		{path: "left-pad/1.3.0", name: "left-pad", rest: "1.3.0"},
+		{path: "left-pad/-/left-pad-1.3.0.tgz", name: "left-pad", rest: "-/left-pad-1.3.0.tgz"},
+		{path: "@davidjspooner/tool", name: "@davidjspooner/tool"},
+		{path: "@davidjspooner%2ftool", name: "@davidjspooner/tool"},
+		{path: "@davidjspooner%2Ftool/-/tool-1.0.0.tgz", name: "@davidjspooner/tool", rest: "-/tool-1.0.0.tgz"},
+		{path: "@davidjspooner", err: true},
+		{path: "", err: true},
+	}
+	for _, test := range tests {
+		name, rest, err := splitName(test.path)
+		if (err != nil) != test.err {
+			t.Errorf("splitName(%q) error = %v, wantErr %v", test.path, err, test.err)
+			continue
+		}
+		if name != test.name || rest != test.rest {
+			t.Errorf("splitName(%q) = %q, %q, want %q, %q", test.path, name, rest, test.name, test.rest)
+		}
+	}
+}
+
+func TestRewriteTarballs(t *testing.T) {
+	doc, err := parsePackument([]byte(`{
+		"name": "@davidjspooner/tool",
+		"versions": {
+			"1.0.0": {"dist": {"tarball": "https://registry.npmjs.org/@davidjspooner/tool/-/tool-1.0.0.tgz"}},
+			"1.1.0": {"dist": {"tarball": "@davidjspooner/tool/-/tool-1.1.0.tgz"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.rewriteTarballs("https://repo.example.com/npm")
+	for version, expected := range map[string]string{
+		"1.0.0": "https://repo.example.com/npm/@davidjspooner/tool/-/tool-1.0.0.tgz",
+		"1.1.0": "https://repo.example.com/npm/@davidjspooner/tool/-/tool-1.1.0.tgz",
+	} {
+		if got := versionDist(doc.Versions[version])["tarball"]; got != expected {
+			t.Errorf("tarball for %s = %q, want %q", version, got, expected)
+		}
+	}
+}
+
+func TestVerifyTarball(t *testing.T) {
+	content := []byte("hello")
+	version := map[string]any{"dist": map[string]any{
+		"shasum":    "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+		"integrity": "sha512-m3HSJL1i83hdltRq0+o9czGb+8KJDKra4t/3JRlnPKcjI8PZm6XBHXx6zG4UuMXaDEZjR1wuXDre9G9zvN7AQw==",
+	}}
+	if err := verifyTarball(version, content); err != nil {
+		t.Errorf("verifyTarball() = %v, want nil", err)
+	}
+	if err := verifyTarball(version, []byte("tampered")); err == nil {
+		t.Errorf("verifyTarball() accepted tampered content")
+	}
+}
@@ -0,0 +1,429 @@
+package npm
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// raw upstream packuments
+	upstream *repository.Cache[[]byte]
+}
+
+const upstreamCacheTTL = 5 * time.Minute
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		upstream: repository.NewCacheMap[[]byte](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.RegisterCache("packuments", repo.upstream)
+	repo.handler.Browse = repo.browse
+	repo.handler.ErrorFormat = repository.JSONError
+	repo.handler.Reindex = func(ctx context.Context) error {
+		repo.upstream.Clear()
+		return nil
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
+	return repo.handler.Authorize(w, r, operation, parsed.name)
+}
+
+func packumentPath(name string) string {
+	return name + "/package.json"
+}
+
+func tarballPath(name, filename string) string {
+	return name + "/-/" + filename
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/npm"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	repository.ErrorFormat(repository.JSONError).Fail(w, status, "", message)
+}
+
+func (repo *repo) readLocalPackument(name string) (*packument, error) {
+	content, err := repo.handler.ReadLocal(packumentPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return parsePackument(content)
+}
+
+// readUpstreamPackument fetches outside the cache lock so a slow upstream only
+// delays the lookups of the package being fetched
+func (repo *repo) readUpstreamPackument(ctx context.Context, name string) (*packument, error) {
+	if cached, age, hit := repo.upstream.Get(name); hit && age < upstreamCacheTTL {
+		return parsePackument(*cached)
+	}
+	content, err := repo.fetchUpstreamPackument(ctx, name)
+	var upstreamErr *repository.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		repo.upstream.Purge(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.upstream.Set(name, &content)
+	return parsePackument(content)
+}
+
+func (repo *repo) fetchUpstreamPackument(ctx context.Context, name string) ([]byte, error) {
+	response, err := repo.handler.FetchUpstream(ctx, repo.handler.UpstreamURL(escapeName(name)), http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &repository.UpstreamError{URL: response.Request.URL.String(), Status: response.StatusCode}
+	}
+	return io.ReadAll(response.Body)
+}
+
+// readPackument prefers the local document and falls back to the upstream one
+func (repo *repo) readPackument(ctx context.Context, name string) (doc *packument, local bool, err error) {
+	doc, err = repo.readLocalPackument(name)
+	if err == nil {
+		return doc, true, nil
+	}
+	if repo.handler.Upstream == nil {
+		return nil, false, err
+	}
+	doc, err = repo.readUpstreamPackument(ctx, name)
+	return doc, false, err
+}
+
+func escapeName(name string) string {
+	return strings.ReplaceAll(name, "/", "%2f")
+}
+
+func (repo *repo) getPackument(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	doc, _, err := repo.readPackument(r.Context(), parsed.name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	doc.rewriteTarballs(baseURL(r))
+	doc.Attachments = nil
+	if parsed.version == "" {
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+	version := parsed.version
+	if tagged, ok := doc.DistTags[version]; ok {
+		version = tagged
+	}
+	versionDoc, ok := doc.Versions[version]
+	if !ok {
+		writeError(w, http.StatusNotFound, "version not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, versionDoc)
+}
+
+func (repo *repo) getTarball(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	target := tarballPath(parsed.name, parsed.filename)
+	if !repo.handler.LocalFileExists(r.Context(), target) && repo.handler.Upstream != nil {
+		_, err := repo.handler.FetchToLocal(r.Context(), target, repo.handler.UpstreamURL(parsed.name, "-", parsed.filename))
+		if err != nil {
+			parsed.logger.Error("tarball:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			var upstreamErr *repository.UpstreamError
+			if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+				writeError(w, http.StatusNotFound, "tarball not found")
+				return
+			}
+			writeError(w, http.StatusBadGateway, "could not fetch tarball from upstream")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+func verifyTarball(version map[string]any, content []byte) error {
+	dist := versionDist(version)
+	if dist == nil {
+		return nil
+	}
+	if shasum, _ := dist["shasum"].(string); shasum != "" {
+		sum := sha1.Sum(content)
+		if hex.EncodeToString(sum[:]) != shasum {
+			return fmt.Errorf("shasum mismatch")
+		}
+	}
+	if integrity, _ := dist["integrity"].(string); len(integrity) > 7 && integrity[:7] == "sha512-" {
+		sum := sha512.Sum512(content)
+		if base64.StdEncoding.EncodeToString(sum[:]) != integrity[7:] {
+			return fmt.Errorf("integrity mismatch")
+		}
+	}
+	return nil
+}
+
+// publish handles "npm publish", which sends the new versions with their
+// tarballs base64 encoded as attachments
+func (repo *repo) publish(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+	incoming, err := parsePackument(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid package document")
+		return
+	}
+	if incoming.Name != parsed.name {
+		writeError(w, http.StatusBadRequest, "package name does not match url")
+		return
+	}
+	if len(incoming.Versions) == 0 {
+		writeError(w, http.StatusBadRequest, "no versions to publish")
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	doc, err := repo.readLocalPackument(parsed.name)
+	if err != nil {
+		doc, _ = parsePackument([]byte(`{}`))
+		doc.ID = parsed.name
+		doc.Name = parsed.name
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	type published struct {
+		target  string
+		content []byte
+	}
+	tarballs := []published{}
+	for versionName, version := range incoming.Versions {
+		if _, exists := doc.Versions[versionName]; exists {
+			writeError(w, http.StatusForbidden, "cannot publish over the previously published version "+versionName)
+			return
+		}
+		filename := tarballFilename(version)
+		if filename == "" {
+			filename = defaultTarballFilename(parsed.name, versionName)
+		}
+		attachment, ok := incoming.Attachments[filename]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "missing attachment "+filename)
+			return
+		}
+		content, err := base64.StdEncoding.DecodeString(attachment.Data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid attachment "+filename)
+			return
+		}
+		err = verifyTarball(version, content)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, filename+": "+err.Error())
+			return
+		}
+		if versionDist(version) == nil {
+			version["dist"] = map[string]any{}
+		}
+		versionDist(version)["tarball"] = tarballPath(parsed.name, filename)
+		doc.Versions[versionName] = version
+		doc.Time[versionName] = now
+		tarballs = append(tarballs, published{target: tarballPath(parsed.name, filename), content: content})
+	}
+	for tag, version := range incoming.DistTags {
+		doc.DistTags[tag] = version
+	}
+	if incoming.Description != "" {
+		doc.Description = incoming.Description
+	}
+	if incoming.Readme != "" {
+		doc.Readme = incoming.Readme
+	}
+	if _, ok := doc.Time["created"]; !ok {
+		doc.Time["created"] = now
+	}
+	doc.Time["modified"] = now
+
+	for _, tarball := range tarballs {
+		err = repo.handler.WriteLocal(tarball.target, tarball.content)
+		if err != nil {
+			parsed.logger.Error("tarball:write", slog.String("target", tarball.target), slog.String("error", err.Error()))
+			writeError(w, http.StatusInternalServerError, "could not store tarball")
+			return
+		}
+		digest := sha256.Sum256(tarball.content)
+		repo.handler.RecordWrite(r, audit.ActionPush, tarball.target, "sha256:"+hex.EncodeToString(digest[:]), int64(len(tarball.content)))
+	}
+	err = repo.writePackument(doc)
+	if err != nil {
+		parsed.logger.Error("packument:write", slog.String("name", parsed.name), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not store package document")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"ok": true, "id": parsed.name})
+}
+
+func (repo *repo) writePackument(doc *packument) error {
+	doc.Attachments = nil
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(packumentPath(doc.Name), content)
+}
+
+func (repo *repo) getDistTags(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	doc, _, err := repo.readPackument(r.Context(), parsed.name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, doc.DistTags)
+}
+
+func (repo *repo) putDistTag(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	var version string
+	err := json.NewDecoder(r.Body).Decode(&version)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a json string version")
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+	doc, err := repo.readLocalPackument(parsed.name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	if _, ok := doc.Versions[version]; !ok {
+		writeError(w, http.StatusNotFound, "version not found")
+		return
+	}
+	doc.DistTags[parsed.tag] = version
+	err = repo.writePackument(doc)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not store package document")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"ok": true})
+}
+
+func (repo *repo) deleteDistTag(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+	if parsed.tag == "latest" {
+		writeError(w, http.StatusBadRequest, "the latest tag cannot be removed")
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+	doc, err := repo.readLocalPackument(parsed.name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	delete(doc.DistTags, parsed.tag)
+	err = repo.writePackument(doc)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not store package document")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// deleteTarball unpublishes the version the tarball belongs to
+func (repo *repo) deleteTarball(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+	doc, err := repo.readLocalPackument(parsed.name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	target := tarballPath(parsed.name, parsed.filename)
+	if !repo.handler.LocalFileExists(r.Context(), target) {
+		writeError(w, http.StatusNotFound, "tarball not found")
+		return
+	}
+	//stop advertising the version before its tarball goes
+	for versionName, version := range doc.Versions {
+		if tarballFilename(version) != parsed.filename {
+			continue
+		}
+		delete(doc.Versions, versionName)
+		delete(doc.Time, versionName)
+		for tag, tagged := range doc.DistTags {
+			if tagged == versionName {
+				delete(doc.DistTags, tag)
+			}
+		}
+	}
+	err = repo.writePackument(doc)
+	if err != nil {
+		parsed.logger.Error("packument:write", slog.String("name", parsed.name), slog.String("error", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not store package document")
+		return
+	}
+	repo.handler.HandleLocalDelete(target, parsed.logger, w, r)
+}
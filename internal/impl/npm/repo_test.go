@@ -0,0 +1,133 @@
+package npm
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+// publishBody is the document npm publish sends, with the tarball attached
+func publishBody(name, version string, tarball []byte) []byte {
+	sum := sha1.Sum(tarball)
+	filename := defaultTarballFilename(name, version)
+	return fmt.Appendf(nil, `{
+		"_id": %[1]q, "name": %[1]q,
+		"dist-tags": {"latest": %[2]q},
+		"versions": {%[2]q: {"name": %[1]q, "version": %[2]q, "dist": {"shasum": %[3]q}}},
+		"_attachments": {%[4]q: {"content_type": "application/octet-stream", "data": %[5]q, "length": %[6]d}}
+	}`, name, version, hex.EncodeToString(sum[:]), filename, base64.StdEncoding.EncodeToString(tarball), len(tarball))
+}
+
+func TestPublishServesPackument(t *testing.T) {
+	config := &repository.Config{Name: "npm-publish", Type: "npm", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "npm", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/npm/")
+
+	if rec := client.Do("PUT", "dstool", publishBody("dstool", "1.2.3", []byte("tarball")), nil); rec.Code != http.StatusCreated {
+		t.Fatalf("publish = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("PUT", "dstool", publishBody("dstool", "1.2.3", []byte("tarball")), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("publish over a published version = %d, want 403", rec.Code)
+	}
+	if rec := client.Do("PUT", "dsother", publishBody("dsother", "1.0.0", []byte("other")), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("publish of another package = %d, want 403", rec.Code)
+	}
+
+	rec := client.Get("dstool")
+	var doc packument
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("packument = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	// npm downloads from the url in the packument, so it must point back here
+	if tarball := versionDist(doc.Versions["1.2.3"])["tarball"]; tarball != "http://example.com/npm/dstool/-/dstool-1.2.3.tgz" {
+		t.Errorf("tarball url = %v", tarball)
+	}
+	if doc.Attachments != nil || doc.DistTags["latest"] != "1.2.3" {
+		t.Errorf("packument = %s", rec.Body)
+	}
+	if rec := client.Get("dstool/latest"); !strings.Contains(rec.Body.String(), `"version":"1.2.3"`) {
+		t.Errorf("latest version = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("dstool/-/dstool-1.2.3.tgz"); rec.Body.String() != "tarball" {
+		t.Errorf("tarball = %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "dstool/-/dstool-1.2.3.tgz", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unpublish = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("dstool/1.2.3"); rec.Code != http.StatusNotFound {
+		t.Errorf("unpublished version = %d, want 404", rec.Code)
+	}
+}
+
+func TestUpstreamPackumentIsCached(t *testing.T) {
+	var packuments, tarballs atomic.Int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			fetching <- struct{}{}
+			<-release
+			http.NotFound(w, r)
+		case "/left-pad", "/is-odd":
+			packuments.Add(1)
+			name := strings.TrimPrefix(r.URL.Path, "/")
+			fmt.Fprintf(w, `{"name": %[1]q, "dist-tags": {"latest": "1.3.0"}, "versions": {"1.3.0": {"dist": {"tarball": "https://registry.npmjs.org/%[1]s/-/%[1]s-1.3.0.tgz"}}}}`, name)
+		case "/left-pad/-/left-pad-1.3.0.tgz":
+			tarballs.Add(1)
+			w.Write([]byte("left-pad"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	config := &repository.Config{Name: "npm-upstream", Type: "npm", Items: []string{"*"}}
+	config.Upstream.Url = upstream.URL
+	client := repotest.NewRepo(t, &Router{}, config, "/npm/")
+
+	for range 2 {
+		if rec := client.Get("left-pad"); !strings.Contains(rec.Body.String(), `"tarball":"http://example.com/npm/left-pad/-/left-pad-1.3.0.tgz"`) {
+			t.Fatalf("packument = %d %s", rec.Code, rec.Body)
+		}
+		if rec := client.Get("left-pad/-/left-pad-1.3.0.tgz"); rec.Body.String() != "left-pad" {
+			t.Fatalf("tarball = %d %q", rec.Code, rec.Body)
+		}
+	}
+	if packuments.Load() != 1 || tarballs.Load() != 1 {
+		t.Errorf("upstream served %d packuments and %d tarballs, want 1 of each", packuments.Load(), tarballs.Load())
+	}
+	if rec := client.Get("missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("package missing upstream = %d, want 404", rec.Code)
+	}
+
+	// a slow upstream package must not hold up the lookups of other packages
+	slow := make(chan int, 1)
+	go func() { slow <- client.Get("slow").Code }()
+	<-fetching
+	fast := make(chan int, 1)
+	go func() { fast <- client.Get("is-odd").Code }()
+	select {
+	case code := <-fast:
+		if code != http.StatusOK {
+			t.Errorf("packument fetched during a slow fetch = %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a slow upstream fetch blocked another package")
+	}
+	close(release)
+	if code := <-slow; code != http.StatusNotFound {
+		t.Errorf("slow package = %d, want 404", code)
+	}
+}
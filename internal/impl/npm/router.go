@@ -0,0 +1,157 @@
+package npm
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	routes repository.Routes[*repo]
+}
+
+type parsedRequest struct {
+	name     string
+	filename string
+	tag      string
+	version  string
+	repo     *repo
+	logger   slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("npm", &Router{})
+}
+
+/*
+GET    /npm/<name>
+GET    /npm/<name>/<version>
+PUT    /npm/<name>
+GET    /npm/<name>/-/<file>.tgz
+DELETE /npm/<name>/-/<file>.tgz
+GET    /npm/-/package/<name>/dist-tags
+PUT    /npm/-/package/<name>/dist-tags/<tag>
+DELETE /npm/-/package/<name>/dist-tags/<tag>
+
+<name> may be scoped, either as @scope/name or @scope%2fname
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	return router.routes.Add(config, repo)
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{}
+	p := r.PathValue("path")
+	distTags := false
+	if rest, ok := strings.CutPrefix(p, "-/package/"); ok {
+		p = rest
+		distTags = true
+	}
+	name, rest, err := splitName(p)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if err := repository.ValidatePath("name", name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	parsed.name = name
+	switch {
+	case distTags:
+		tag, ok := strings.CutPrefix(rest, "dist-tags")
+		if !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return nil
+		}
+		parsed.tag = strings.Trim(tag, "/")
+		if parsed.tag == "" {
+			parsed.tag = "*"
+		}
+	case strings.HasPrefix(rest, "-/"):
+		parsed.filename = strings.TrimPrefix(rest, "-/")
+		if parsed.filename == "" || strings.Contains(parsed.filename, "/") {
+			writeError(w, http.StatusNotFound, "not found")
+			return nil
+		}
+	default:
+		parsed.version = rest
+	}
+
+	for _, field := range [][2]string{{"tag", parsed.tag}, {"filename", parsed.filename}, {"version", parsed.version}} {
+		if field[1] == "" {
+			continue
+		}
+		if err := repository.ValidateSegment(field[0], field[1]); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+	}
+
+	parsed.logger = repository.RequestLogger(r)
+	route := router.routes.Select(parsed.name, &parsed.logger)
+	if route == nil {
+		writeError(w, http.StatusNotFound, "no registry serves "+parsed.name)
+		return nil
+	}
+	parsed.repo = route.Repo
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if router.routes.IsEmpty() {
+		return nil
+	}
+	aMux.HandleFunc("GET /npm/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.tag != "":
+			parsed.repo.getDistTags(parsed, w, r)
+		case parsed.filename != "":
+			parsed.repo.getTarball(parsed, w, r)
+		default:
+			parsed.repo.getPackument(parsed, w, r)
+		}
+	})
+	aMux.HandleFunc("PUT /npm/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.tag != "" && parsed.tag != "*":
+			parsed.repo.putDistTag(parsed, w, r)
+		case parsed.tag == "" && parsed.filename == "" && parsed.version == "":
+			parsed.repo.publish(parsed, w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	aMux.HandleFunc("DELETE /npm/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		switch {
+		case parsed.tag != "" && parsed.tag != "*":
+			parsed.repo.deleteDistTag(parsed, w, r)
+		case parsed.filename != "":
+			parsed.repo.deleteTarball(parsed, w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	return nil
+}
@@ -0,0 +1,158 @@
+package nuget
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	validID      = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,99}$`)
+	versionRegex = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.(\d+))?(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+)
+
+// normalizeVersion applies the NuGet normalisation: three or four numeric
+// parts without leading zeros, no build metadata
+func normalizeVersion(version string) (string, bool) {
+	match := versionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return "", false
+	}
+	parts := []string{}
+	for i, part := range match[1:5] {
+		if part == "" {
+			part = "0"
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return "", false
+		}
+		if i == 3 && n == 0 {
+			break
+		}
+		parts = append(parts, strconv.FormatUint(n, 10))
+	}
+	return strings.Join(parts, ".") + match[5], true
+}
+
+// compareVersions orders normalized versions, releases after their prereleases
+func compareVersions(a, b string) int {
+	aRelease, aPre, _ := strings.Cut(a, "-")
+	bRelease, bPre, _ := strings.Cut(b, "-")
+	if c := compareParts(strings.Split(aRelease, "."), strings.Split(bRelease, ".")); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareParts(strings.Split(aPre, "."), strings.Split(bPre, "."))
+}
+
+func compareParts(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		aNum, aErr := strconv.ParseUint(a[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(b[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(strings.ToLower(a[i]), strings.ToLower(b[i])); c != 0 {
+				return c
+			}
+		}
+	}
+	if len(a) == len(b) {
+		return 0
+	}
+	if len(a) < len(b) {
+		return -1
+	}
+	return 1
+}
+
+type dependency struct {
+	ID      string `xml:"id,attr" json:"id"`
+	Version string `xml:"version,attr" json:"range,omitempty"`
+}
+
+type dependencyGroup struct {
+	TargetFramework string       `xml:"targetFramework,attr" json:"targetFramework,omitempty"`
+	Dependencies    []dependency `xml:"dependency" json:"dependencies,omitempty"`
+}
+
+type nuspec struct {
+	Metadata struct {
+		ID          string `xml:"id"`
+		Version     string `xml:"version"`
+		Title       string `xml:"title"`
+		Authors     string `xml:"authors"`
+		Description string `xml:"description"`
+		Summary     string `xml:"summary"`
+		Tags        string `xml:"tags"`
+		ProjectURL  string `xml:"projectUrl"`
+		IconURL     string `xml:"iconUrl"`
+		LicenseURL  string `xml:"licenseUrl"`
+		License     struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"license"`
+		Dependencies struct {
+			Groups       []dependencyGroup `xml:"group"`
+			Dependencies []dependency      `xml:"dependency"`
+		} `xml:"dependencies"`
+	} `xml:"metadata"`
+}
+
+// readNuspec returns the raw and parsed .nuspec at the root of a .nupkg
+func readNuspec(content []byte) ([]byte, *nuspec, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a nuget package: %w", err)
+	}
+	for _, file := range archive.File {
+		if strings.Contains(file.Name, "/") || !strings.HasSuffix(strings.ToLower(file.Name), ".nuspec") {
+			continue
+		}
+		rFile, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw, err := io.ReadAll(io.LimitReader(rFile, 10*1024*1024))
+		rFile.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		spec := &nuspec{}
+		err = xml.Unmarshal(raw, spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid nuspec: %w", err)
+		}
+		if !validID.MatchString(spec.Metadata.ID) {
+			return nil, nil, fmt.Errorf("invalid package id %q", spec.Metadata.ID)
+		}
+		if _, ok := normalizeVersion(spec.Metadata.Version); !ok {
+			return nil, nil, fmt.Errorf("invalid package version %q", spec.Metadata.Version)
+		}
+		return raw, spec, nil
+	}
+	return nil, nil, fmt.Errorf("nuget package has no .nuspec")
+}
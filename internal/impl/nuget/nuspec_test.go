@@ -0,0 +1,72 @@
+package nuget
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	for version, want := range map[string]string{
+		"1.0":              "1.0.0",
+		"1.00.01":          "1.0.1",
+		"1.2.3.0":          "1.2.3",
+		"1.2.3.4":          "1.2.3.4",
+		"1.2.3-Beta.1+abc": "1.2.3-Beta.1",
+		"1.2.3.4.5":        "",
+		"latest":           "",
+	} {
+		got, _ := normalizeVersion(version)
+		if got != want {
+			t.Errorf("normalizeVersion(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.2", "1.0.0-alpha.10", "1.0.0-beta", "1.0.0", "1.0.0.1", "1.2.0", "10.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		if compareVersions(ordered[i-1], ordered[i]) >= 0 || compareVersions(ordered[i], ordered[i-1]) <= 0 {
+			t.Errorf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func makeNupkg(id, version string) []byte {
+	buffer := bytes.Buffer{}
+	archive := zip.NewWriter(&buffer)
+	w, _ := archive.Create(id + ".nuspec")
+	w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>` + id + `</id>
+    <version>` + version + `</version>
+    <authors>someone</authors>
+    <description>a tool</description>
+    <license type="expression">MIT</license>
+    <dependencies>
+      <group targetFramework="net8.0">
+        <dependency id="Newtonsoft.Json" version="13.0.1" />
+      </group>
+    </dependencies>
+  </metadata>
+</package>`))
+	archive.Create("lib/net8.0/" + id + ".dll")
+	archive.Close()
+	return buffer.Bytes()
+}
+
+func TestReadNuspec(t *testing.T) {
+	_, spec, err := readNuspec(makeNupkg("DsTool", "1.2.3.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := spec.Metadata
+	if meta.ID != "DsTool" || meta.Version != "1.2.3.0" || meta.License.Value != "MIT" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	groups := meta.Dependencies.Groups
+	if len(groups) != 1 || groups[0].TargetFramework != "net8.0" || groups[0].Dependencies[0].ID != "Newtonsoft.Json" {
+		t.Errorf("unexpected dependencies %+v", groups)
+	}
+}
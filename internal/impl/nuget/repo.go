@@ -0,0 +1,454 @@
+package nuget
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+}
+
+const maxPackageSize = 256 * 1024 * 1024
+
+// packageVersion is what the feed records about a pushed version, the
+// versions of a package are kept together in <id>/index.json
+type packageVersion struct {
+	ID                string            `json:"id"`
+	Version           string            `json:"version"`
+	Title             string            `json:"title,omitempty"`
+	Authors           string            `json:"authors,omitempty"`
+	Description       string            `json:"description,omitempty"`
+	Summary           string            `json:"summary,omitempty"`
+	Tags              string            `json:"tags,omitempty"`
+	ProjectURL        string            `json:"projectUrl,omitempty"`
+	IconURL           string            `json:"iconUrl,omitempty"`
+	LicenseURL        string            `json:"licenseUrl,omitempty"`
+	LicenseExpression string            `json:"licenseExpression,omitempty"`
+	DependencyGroups  []dependencyGroup `json:"dependencyGroups,omitempty"`
+	Published         time.Time         `json:"published"`
+	Size              int64             `json:"size"`
+	SHA512            string            `json:"sha512"`
+}
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+func baseURL(r *http.Request, name string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/nuget/" + name
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func contentPath(id, version, filename string) string {
+	return path.Join(id, version, filename)
+}
+
+func (repo *repo) readVersions(id string) ([]*packageVersion, error) {
+	content, err := repo.handler.ReadLocal(path.Join(id, "index.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*packageVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []*packageVersion{}
+	err = json.Unmarshal(content, &versions)
+	return versions, err
+}
+
+func (repo *repo) writeVersions(id string, versions []*packageVersion) error {
+	slices.SortFunc(versions, func(a, b *packageVersion) int {
+		return compareVersions(a.Version, b.Version)
+	})
+	content, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(path.Join(id, "index.json"), content)
+}
+
+func (repo *repo) getServiceIndex(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r, repo.handler.Name)
+	resources := []map[string]string{}
+	for _, resource := range []struct{ id, types string }{
+		{"/v3-flatcontainer/", "PackageBaseAddress/3.0.0"},
+		{"/api/v2/package", "PackagePublish/2.0.0"},
+		{"/v3/registration/", "RegistrationsBaseUrl RegistrationsBaseUrl/3.0.0-rc RegistrationsBaseUrl/3.0.0-beta RegistrationsBaseUrl/3.6.0"},
+		{"/v3/query", "SearchQueryService SearchQueryService/3.0.0-rc SearchQueryService/3.0.0-beta SearchQueryService/3.5.0"},
+	} {
+		for _, t := range strings.Fields(resource.types) {
+			resources = append(resources, map[string]string{"@id": base + resource.id, "@type": t})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"version": "3.0.0", "resources": resources})
+}
+
+func (repo *repo) getVersions(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", parsed.id) {
+		return
+	}
+	versions, err := repo.readVersions(parsed.id)
+	if err != nil || len(versions) == 0 {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	list := make([]string, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, strings.ToLower(v.Version))
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"versions": list})
+}
+
+func (repo *repo) getContent(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	version, ok := normalizeVersion(parsed.version)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	version = strings.ToLower(version)
+	switch parsed.filename {
+	case parsed.id + "." + version + ".nupkg":
+		w.Header().Set("Content-Type", "application/octet-stream")
+	case parsed.id + ".nuspec":
+		w.Header().Set("Content-Type", "application/xml")
+	default:
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", parsed.id) {
+		return
+	}
+	repo.handler.HandleLocalGet(contentPath(parsed.id, version, parsed.filename), parsed.logger, w, r)
+}
+
+func (repo *repo) catalogEntry(base string, v *packageVersion) map[string]any {
+	id, version := strings.ToLower(v.ID), strings.ToLower(v.Version)
+	groups := v.DependencyGroups
+	if groups == nil {
+		groups = []dependencyGroup{}
+	}
+	return map[string]any{
+		"@id":               base + "/v3/registration/" + id + "/" + version + ".json",
+		"@type":             "PackageDetails",
+		"id":                v.ID,
+		"version":           v.Version,
+		"title":             v.Title,
+		"authors":           v.Authors,
+		"description":       v.Description,
+		"summary":           v.Summary,
+		"tags":              strings.Fields(v.Tags),
+		"projectUrl":        v.ProjectURL,
+		"iconUrl":           v.IconURL,
+		"licenseUrl":        v.LicenseURL,
+		"licenseExpression": v.LicenseExpression,
+		"listed":            true,
+		"published":         v.Published.UTC().Format(time.RFC3339),
+		"dependencyGroups":  groups,
+		"packageContent":    base + "/v3-flatcontainer/" + id + "/" + version + "/" + id + "." + version + ".nupkg",
+	}
+}
+
+func (repo *repo) registrationLeaf(base string, v *packageVersion) map[string]any {
+	entry := repo.catalogEntry(base, v)
+	return map[string]any{
+		"@id":            entry["@id"],
+		"@type":          "Package",
+		"catalogEntry":   entry,
+		"packageContent": entry["packageContent"],
+		"registration":   base + "/v3/registration/" + strings.ToLower(v.ID) + "/index.json",
+	}
+}
+
+func (repo *repo) getRegistration(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", parsed.id) {
+		return
+	}
+	versions, err := repo.readVersions(parsed.id)
+	if err != nil || len(versions) == 0 {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	base := baseURL(r, repo.handler.Name)
+	indexURL := base + "/v3/registration/" + parsed.id + "/index.json"
+	if parsed.filename != "index.json" {
+		wanted, ok := normalizeVersion(strings.TrimSuffix(parsed.filename, ".json"))
+		if ok {
+			for _, v := range versions {
+				if strings.EqualFold(v.Version, wanted) {
+					writeJSON(w, http.StatusOK, repo.registrationLeaf(base, v))
+					return
+				}
+			}
+		}
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	// a single page with the leaves inlined is enough for a private feed
+	leaves := make([]map[string]any, 0, len(versions))
+	for _, v := range versions {
+		leaves = append(leaves, repo.registrationLeaf(base, v))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@id":   indexURL,
+		"count": 1,
+		"items": []map[string]any{{
+			"@id":   indexURL + "#page/" + versions[0].Version + "/" + versions[len(versions)-1].Version,
+			"count": len(leaves),
+			"items": leaves,
+			"lower": versions[0].Version,
+			"upper": versions[len(versions)-1].Version,
+		}},
+	})
+}
+
+func (repo *repo) search(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	terms := strings.Fields(strings.ToLower(query.Get("q")))
+	skip, _ := strconv.Atoi(query.Get("skip"))
+	skip = max(skip, 0)
+	take, err := strconv.Atoi(query.Get("take"))
+	if err != nil || take <= 0 || take > 1000 {
+		take = 20
+	}
+	prerelease := query.Get("prerelease") == "true"
+
+	entries, err := fs.ReadDir(repo.handler.Local, ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		parsed.logger.Error("store:list", slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	base := baseURL(r, repo.handler.Name)
+	data := []map[string]any{}
+	for _, entry := range entries {
+		id := entry.Name()
+		if !entry.IsDir() || !validID.MatchString(id) {
+			continue
+		}
+		if allowed, _ := repo.handler.Check("list", id); !allowed {
+			continue
+		}
+		versions, err := repo.readVersions(id)
+		if err != nil {
+			continue
+		}
+		versions = slices.DeleteFunc(versions, func(v *packageVersion) bool {
+			return !prerelease && strings.Contains(v.Version, "-")
+		})
+		if len(versions) == 0 {
+			continue
+		}
+		latest := versions[len(versions)-1]
+		text := strings.ToLower(strings.Join([]string{latest.ID, latest.Title, latest.Description, latest.Tags}, " "))
+		if slices.ContainsFunc(terms, func(term string) bool { return !strings.Contains(text, term) }) {
+			continue
+		}
+		list := make([]map[string]any, 0, len(versions))
+		for _, v := range versions {
+			list = append(list, map[string]any{
+				"version":   v.Version,
+				"downloads": 0,
+				"@id":       base + "/v3/registration/" + id + "/" + strings.ToLower(v.Version) + ".json",
+			})
+		}
+		data = append(data, map[string]any{
+			"@id":            base + "/v3/registration/" + id + "/index.json",
+			"@type":          "Package",
+			"registration":   base + "/v3/registration/" + id + "/index.json",
+			"id":             latest.ID,
+			"version":        latest.Version,
+			"title":          latest.Title,
+			"description":    latest.Description,
+			"summary":        latest.Summary,
+			"authors":        strings.Split(latest.Authors, ","),
+			"tags":           strings.Fields(latest.Tags),
+			"projectUrl":     latest.ProjectURL,
+			"iconUrl":        latest.IconURL,
+			"totalDownloads": 0,
+			"versions":       list,
+		})
+	}
+	total := len(data)
+	data = data[min(skip, total):min(skip+take, total)]
+	writeJSON(w, http.StatusOK, map[string]any{"totalHits": total, "data": data})
+}
+
+// readUpload returns the first file of the multipart body dotnet nuget push sends
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return io.ReadAll(io.LimitReader(r.Body, maxPackageSize))
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+	return io.ReadAll(io.LimitReader(part, maxPackageSize))
+}
+
+func (repo *repo) push(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	content, err := readUpload(r)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read package")
+		return
+	}
+	raw, spec, err := readNuspec(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	meta := spec.Metadata
+	version, _ := normalizeVersion(meta.Version)
+	id := strings.ToLower(meta.ID)
+	if !repo.IsAllowed(w, r, "put", id) {
+		return
+	}
+	if !repo.handler.Serves(id) {
+		repo.handler.Fail(w, http.StatusForbidden, "", "package "+meta.ID+" is not served by this feed")
+		return
+	}
+	sum := sha512.Sum512(content)
+	v := &packageVersion{
+		ID:               meta.ID,
+		Version:          version,
+		Title:            meta.Title,
+		Authors:          meta.Authors,
+		Description:      meta.Description,
+		Summary:          meta.Summary,
+		Tags:             meta.Tags,
+		ProjectURL:       meta.ProjectURL,
+		IconURL:          meta.IconURL,
+		LicenseURL:       meta.LicenseURL,
+		DependencyGroups: meta.Dependencies.Groups,
+		Published:        time.Now(),
+		Size:             int64(len(content)),
+		SHA512:           base64.StdEncoding.EncodeToString(sum[:]),
+	}
+	if meta.License.Type == "expression" {
+		v.LicenseExpression = meta.License.Value
+	}
+	if len(meta.Dependencies.Dependencies) > 0 {
+		v.DependencyGroups = append(v.DependencyGroups, dependencyGroup{Dependencies: meta.Dependencies.Dependencies})
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	versions, err := repo.readVersions(id)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("id", id), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	if slices.ContainsFunc(versions, func(existing *packageVersion) bool {
+		return strings.EqualFold(existing.Version, version)
+	}) {
+		repo.handler.Fail(w, http.StatusConflict, "", meta.ID+" "+version+" already exists")
+		return
+	}
+	lower := strings.ToLower(version)
+	target := contentPath(id, lower, id+"."+lower+".nupkg")
+	err = repo.handler.WriteLocal(target, content)
+	if err == nil {
+		err = repo.handler.WriteLocal(contentPath(id, lower, id+".nuspec"), raw)
+	}
+	if err == nil {
+		err = repo.writeVersions(id, append(versions, v))
+	}
+	if err != nil {
+		parsed.logger.Error("package:write", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	digest := sha256.Sum256(content)
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+hex.EncodeToString(digest[:]), v.Size)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	version, ok := normalizeVersion(parsed.version)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "delete", parsed.id) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	versions, err := repo.readVersions(parsed.id)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("id", parsed.id), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	kept := slices.DeleteFunc(slices.Clone(versions), func(v *packageVersion) bool {
+		return strings.EqualFold(v.Version, version)
+	})
+	if len(kept) == len(versions) {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	err = repo.writeVersions(parsed.id, kept)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("id", parsed.id), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	lower := strings.ToLower(version)
+	repo.handler.RemoveLocal(contentPath(parsed.id, lower, parsed.id+".nuspec"))
+	err = repo.handler.HandleLocalDelete(contentPath(parsed.id, lower, parsed.id+"."+lower+".nupkg"), parsed.logger, w, r)
+	if err != nil {
+		parsed.logger.Error("package:delete", slog.String("id", parsed.id), slog.String("error", err.Error()))
+	}
+}
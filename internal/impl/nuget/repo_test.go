@@ -0,0 +1,68 @@
+package nuget
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+// pushBody is the multipart form dotnet nuget push sends
+func pushBody(t *testing.T, nupkg []byte) ([]byte, http.Header) {
+	buffer := bytes.Buffer{}
+	form := multipart.NewWriter(&buffer)
+	part, err := form.CreateFormFile("package", "package.nupkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(nupkg)
+	form.Close()
+	return buffer.Bytes(), http.Header{"Content-Type": {form.FormDataContentType()}}
+}
+
+func TestPushServesV3Resources(t *testing.T) {
+	config := &repository.Config{Name: "nuget-v3", Type: "nuget", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "nuget", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/nuget/nuget-v3/")
+
+	// ids are case insensitive, policies and urls use the lower case id
+	nupkg := makeNupkg("DsTool", "1.2.3")
+	body, header := pushBody(t, nupkg)
+	if rec := client.Do("PUT", "api/v2/package", body, header); rec.Code != http.StatusCreated {
+		t.Fatalf("push = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("PUT", "api/v2/package", body, header); rec.Code != http.StatusConflict {
+		t.Errorf("second push = %d, want 409", rec.Code)
+	}
+	body, header = pushBody(t, makeNupkg("OtherTool", "1.0.0"))
+	if rec := client.Do("PUT", "api/v2/package", body, header); rec.Code != http.StatusForbidden {
+		t.Errorf("push of another package = %d, want 403", rec.Code)
+	}
+
+	if rec := client.Get("v3/index.json"); !strings.Contains(rec.Body.String(), "http://example.com/nuget/nuget-v3/v3-flatcontainer/") {
+		t.Errorf("service index = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("v3-flatcontainer/dstool/index.json"); rec.Body.String() != `{"versions":["1.2.3"]}`+"\n" {
+		t.Errorf("versions = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("v3-flatcontainer/dstool/1.2.3/dstool.1.2.3.nupkg"); !bytes.Equal(rec.Body.Bytes(), nupkg) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec := client.Get("v3/registration/dstool/index.json"); !strings.Contains(rec.Body.String(), `"licenseExpression":"MIT"`) {
+		t.Errorf("registration = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("v3/query?q=dstool"); !strings.Contains(rec.Body.String(), `"id":"DsTool"`) {
+		t.Errorf("search = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "api/v2/package/dstool/1.2.3", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("v3-flatcontainer/dstool/index.json"); rec.Code != http.StatusNotFound {
+		t.Errorf("versions after delete = %d, want 404", rec.Code)
+	}
+}
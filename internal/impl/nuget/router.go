@@ -0,0 +1,136 @@
+package nuget
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	id       string
+	version  string
+	filename string
+	repo     *repo
+	logger   slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("nuget", &Router{})
+}
+
+/*
+GET    /nuget/<repo>/v3/index.json                                    (service index)
+GET    /nuget/<repo>/v3-flatcontainer/<id>/index.json
+GET    /nuget/<repo>/v3-flatcontainer/<id>/<version>/<id>.<version>.nupkg
+GET    /nuget/<repo>/v3-flatcontainer/<id>/<version>/<id>.nuspec
+GET    /nuget/<repo>/v3/registration/<id>/index.json
+GET    /nuget/<repo>/v3/registration/<id>/<version>.json
+GET    /nuget/<repo>/v3/query?q=&skip=&take=&prerelease=
+PUT    /nuget/<repo>/api/v2/package                                  (dotnet nuget push)
+DELETE /nuget/<repo>/api/v2/package/<id>/<version>
+
+Ids and versions in urls are lower case, items restricts which package
+ids may be pushed.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		id:       strings.ToLower(r.PathValue("id")),
+		version:  strings.ToLower(r.PathValue("version")),
+		filename: strings.ToLower(r.PathValue("filename")),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "id", "version", "filename"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	if parsed.id != "" && !validID.MatchString(parsed.id) {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /nuget/{repo}/v3/index.json", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getServiceIndex(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /nuget/{repo}/v3-flatcontainer/{id}/index.json", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getVersions(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /nuget/{repo}/v3-flatcontainer/{id}/{version}/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getContent(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /nuget/{repo}/v3/registration/{id}/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getRegistration(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /nuget/{repo}/v3/query", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.search(parsed, w, r)
+	})
+	aMux.HandleFunc("PUT /nuget/{repo}/api/v2/package", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.push(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /nuget/{repo}/api/v2/package/{id}/{version}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
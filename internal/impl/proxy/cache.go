@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// entry is stored next to each cached response
+type entry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ContentType  string    `json:"contentType,omitempty"`
+	Size         int64     `json:"size"`
+	Fetched      time.Time `json:"fetched"`
+	Expires      time.Time `json:"expires"`
+}
+
+// cacheKey maps a request path to its store name, directory urls are kept as
+// a hidden index file so they can sit next to the files they list
+func cacheKey(p string) (string, bool) {
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += ".index"
+	}
+	if path.Clean("/"+p) != "/"+p {
+		return "", false
+	}
+	return p, true
+}
+
+func contentPath(key string) string {
+	return "files/" + key
+}
+
+func entryPath(key string) string {
+	return "meta/" + key + ".json"
+}
+
+// lifetime works out how long a response may be served without revalidation
+// and whether it may be stored at all, a configured minimum ttl overrides
+// no-store, no-cache and private so misbehaving upstreams can still be cached
+func lifetime(header http.Header, now time.Time, limits repository.CacheTTL) (time.Duration, bool) {
+	maxAge, sharedMaxAge := int64(-1), int64(-1)
+	noCache, noStore := false, false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		switch strings.ToLower(name) {
+		case "no-store", "private":
+			noStore = true
+		case "no-cache":
+			noCache = true
+		case "max-age":
+			if err == nil {
+				maxAge = seconds
+			}
+		case "s-maxage":
+			if err == nil {
+				sharedMaxAge = seconds
+			}
+		}
+	}
+	var ttl time.Duration
+	switch {
+	case noStore || noCache:
+	case sharedMaxAge >= 0:
+		ttl = time.Duration(sharedMaxAge) * time.Second
+	case maxAge >= 0:
+		ttl = time.Duration(maxAge) * time.Second
+	default:
+		if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			ttl = expires.Sub(date)
+		}
+	}
+	if ttl < limits.MinTTL {
+		ttl = limits.MinTTL
+	}
+	if limits.MaxTTL > 0 && ttl > limits.MaxTTL {
+		ttl = limits.MaxTTL
+	}
+	return max(ttl, 0), !noStore || limits.MinTTL > 0
+}
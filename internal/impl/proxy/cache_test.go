@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+func TestLifetime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := repository.CacheTTL{MinTTL: time.Minute, MaxTTL: time.Hour}
+	for _, test := range []struct {
+		header http.Header
+		limits repository.CacheTTL
+		ttl    time.Duration
+		store  bool
+	}{
+		{http.Header{"Cache-Control": {"public, max-age=600"}}, limits, 10 * time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=600, s-maxage=1200"}}, limits, 20 * time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=86400"}}, limits, time.Hour, true},
+		{http.Header{"Cache-Control": {"no-cache"}}, limits, time.Minute, true},
+		{http.Header{"Cache-Control": {"no-store"}}, repository.CacheTTL{}, 0, false},
+		{http.Header{"Cache-Control": {"no-store"}}, limits, time.Minute, true},
+		{http.Header{
+			"Date":    {now.Format(http.TimeFormat)},
+			"Expires": {now.Add(30 * time.Minute).Format(http.TimeFormat)},
+		}, limits, 30 * time.Minute, true},
+		{http.Header{}, repository.CacheTTL{}, 0, true},
+	} {
+		ttl, store := lifetime(test.header, now, test.limits)
+		if ttl != test.ttl || store != test.store {
+			t.Errorf("lifetime(%v) = %v %v, want %v %v", test.header, ttl, store, test.ttl, test.store)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	for p, want := range map[string]string{
+		"release/stable.txt": "release/stable.txt",
+		"dist/":              "dist/.index",
+		"":                   ".index",
+		"dist/../../etc":     "",
+		"dist//index.json":   "",
+	} {
+		got, _ := cacheKey(p)
+		if got != want {
+			t.Errorf("cacheKey(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestUpstreamURL(t *testing.T) {
+	upstream, _ := url.Parse("https://dl.k8s.io/")
+	repo := &repo{
+		handler: &repository.Handler{Upstream: upstream},
+		rewrites: []rewrite{
+			{match: regexp.MustCompile(`^stable/(.*)$`), replace: "release/$1"},
+			{match: regexp.MustCompile(`^node/(.*)$`), replace: "https://nodejs.org/dist/$1"},
+		},
+	}
+	for p, want := range map[string]string{
+		"stable/v1.30.0/bin/linux/amd64/kubectl": "https://dl.k8s.io/release/v1.30.0/bin/linux/amd64/kubectl",
+		"node/v20.0.0/SHASUMS256.txt":            "https://nodejs.org/dist/v20.0.0/SHASUMS256.txt",
+		"release/stable.txt":                     "https://dl.k8s.io/release/stable.txt",
+	} {
+		if got := repo.upstreamURL(p); got != want {
+			t.Errorf("upstreamURL(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+)
+
+type rewrite struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+type repo struct {
+	handler  *repository.Handler
+	rewrites []rewrite
+	limits   repository.CacheTTL
+}
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	if config.Upstream.Url == "" {
+		return nil, fmt.Errorf("proxy repository %s has no upstream url", config.Name)
+	}
+	repo := &repo{limits: config.Cache}
+	for _, rule := range config.Rewrites {
+		match, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("proxy repository %s: invalid rewrite %q: %w", config.Name, rule.Match, err)
+		}
+		repo.rewrites = append(repo.rewrites, rewrite{match: match, replace: rule.Replace})
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.Browse = repo.browse
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+// upstreamURL applies the first matching rewrite rule to p
+func (repo *repo) upstreamURL(p string) string {
+	for _, rule := range repo.rewrites {
+		if rule.match.MatchString(p) {
+			p = rule.match.ReplaceAllString(p, rule.replace)
+			break
+		}
+	}
+	if strings.Contains(p, "://") {
+		return p
+	}
+	return repo.handler.UpstreamURL(p)
+}
+
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	list, err := repo.handler.BrowseStore(ctx, contentPath(p))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]repository.BrowseEntry, 0, len(list))
+	for _, entry := range list {
+		if entry.Name == ".index" {
+			continue
+		}
+		entry.Resource = strings.TrimPrefix(entry.Resource, "files/")
+		if entry.Path != "" {
+			entry.Path = entry.Resource
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (repo *repo) readEntry(key string) (*entry, error) {
+	content, err := repo.handler.ReadLocal(entryPath(key))
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{}
+	err = json.Unmarshal(content, e)
+	return e, err
+}
+
+func (repo *repo) writeEntry(key string, e *entry) error {
+	content, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(entryPath(key), content)
+}
+
+func (repo *repo) get(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "get", parsed.path) {
+		return
+	}
+	key, ok := cacheKey(parsed.path)
+	if !ok || !repo.handler.Serves(parsed.path) {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	now := time.Now()
+	cached, err := repo.readEntry(key)
+	if err != nil {
+		cached = nil
+	}
+	if cached != nil && now.Before(cached.Expires) {
+		repo.serve(parsed, key, cached, w, r)
+		return
+	}
+
+	upstreamURL := repo.upstreamURL(parsed.path)
+	header := http.Header{}
+	if cached != nil && cached.URL == upstreamURL {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	response, err := repo.handler.FetchUpstream(r.Context(), upstreamURL, header)
+	if err != nil {
+		repo.fallback(parsed, key, cached, err, w, r)
+		return
+	}
+	defer response.Body.Close()
+	ttl, store := lifetime(response.Header, now, repo.limits)
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		cached.Expires = now.Add(ttl)
+		if etag := response.Header.Get("ETag"); etag != "" {
+			cached.ETag = etag
+		}
+		err = repo.writeEntry(key, cached)
+		if err != nil {
+			parsed.logger.Error("cache:write", slog.String("target", key), slog.String("error", err.Error()))
+		}
+		repo.serve(parsed, key, cached, w, r)
+	case response.StatusCode == http.StatusOK && store:
+		content, err := io.ReadAll(response.Body)
+		if err != nil {
+			repo.fallback(parsed, key, cached, err, w, r)
+			return
+		}
+		fresh := &entry{
+			URL:          upstreamURL,
+			ETag:         response.Header.Get("ETag"),
+			LastModified: response.Header.Get("Last-Modified"),
+			ContentType:  response.Header.Get("Content-Type"),
+			Size:         int64(len(content)),
+			Fetched:      now,
+			Expires:      now.Add(ttl),
+		}
+		// the content goes first so an entry never describes a missing file
+		err = repo.handler.WriteLocal(contentPath(key), content)
+		if err == nil {
+			err = repo.writeEntry(key, fresh)
+		}
+		if err != nil {
+			parsed.logger.Error("cache:write", slog.String("target", key), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+		repo.serve(parsed, key, fresh, w, r)
+	case response.StatusCode == http.StatusOK:
+		copyHeaders(w.Header(), response.Header, "Content-Type", "Content-Length", "ETag", "Last-Modified", "Cache-Control")
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, response.Body)
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+	default:
+		repo.fallback(parsed, key, cached, &repository.UpstreamError{URL: upstreamURL, Status: response.StatusCode}, w, r)
+	}
+}
+
+// fallback serves a stale copy when the upstream cannot be reached
+func (repo *repo) fallback(parsed *parsedRequest, key string, cached *entry, err error, w http.ResponseWriter, r *http.Request) {
+	if cached == nil {
+		parsed.logger.Error("upstream:fetch", slog.String("target", key), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusBadGateway, "", "")
+		return
+	}
+	parsed.logger.Warn("upstream:fetch serving stale copy", slog.String("target", key), slog.String("error", err.Error()))
+	repo.serve(parsed, key, cached, w, r)
+}
+
+func copyHeaders(to, from http.Header, names ...string) {
+	for _, name := range names {
+		if value := from.Get(name); value != "" {
+			to.Set(name, value)
+		}
+	}
+}
+
+func (repo *repo) serve(parsed *parsedRequest, key string, e *entry, w http.ResponseWriter, r *http.Request) {
+	if e.ETag != "" {
+		w.Header().Set("ETag", e.ETag)
+	}
+	if e.LastModified != "" {
+		w.Header().Set("Last-Modified", e.LastModified)
+	}
+	remaining := max(time.Until(e.Expires), 0)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(remaining.Seconds())))
+	if match := r.Header.Get("If-None-Match"); match != "" && match == e.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rFile, err := repo.handler.Local.Open(contentPath(key))
+	if err != nil {
+		parsed.logger.Error("file:open", slog.String("target", key), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	defer rFile.Close()
+	if e.ContentType != "" {
+		w.Header().Set("Content-Type", e.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(e.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, rFile)
+	if err != nil {
+		parsed.logger.Error("file:read", slog.String("target", key), slog.String("error", err.Error()))
+		return
+	}
+	repo.handler.Notify(r, webhook.ActionPull, webhook.Target{Name: parsed.path, Path: key, Size: e.Size})
+}
+
+func (repo *repo) evict(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "delete", parsed.path) {
+		return
+	}
+	key, ok := cacheKey(parsed.path)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	cached, err := repo.readEntry(key)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	err = repo.handler.RemoveLocal(entryPath(key))
+	if err == nil {
+		err = repo.handler.RemoveLocal(contentPath(key))
+	}
+	if err != nil {
+		parsed.logger.Error("cache:evict", slog.String("target", key), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionDelete, key, "", cached.Size)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestRewriteCachesUpstreamFiles(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dl/tool.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=600")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("tool"))
+	}))
+	defer upstream.Close()
+
+	config := &repository.Config{Name: "proxy-rewrite", Type: "proxy", Items: []string{"tools/*", "private/*"}}
+	config.Upstream.Url = upstream.URL + "/"
+	config.Rewrites = []repository.Rewrite{{Match: `^tools/(.*)$`, Replace: "dl/$1"}}
+	// a proxy has nothing to publish, delete evicts the cached copy
+	config.Policies = repotest.Policies(t, `
+- name: tools
+  actions: ["proxy:get", "proxy:delete"]
+  resources: ["proxy:tools/*"]
+`)
+	client := repotest.NewRepo(t, &Router{}, config, "/proxy/proxy-rewrite/")
+
+	for range 2 {
+		if rec := client.Get("tools/tool.tar.gz"); rec.Code != http.StatusOK || rec.Body.String() != "tool" {
+			t.Fatalf("get = %d %q", rec.Code, rec.Body)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("a fresh cached copy was fetched %d times", fetches.Load())
+	}
+	if rec := client.Do("GET", "tools/tool.tar.gz", nil, http.Header{"If-None-Match": {`"v1"`}}); rec.Code != http.StatusNotModified {
+		t.Errorf("conditional get = %d, want 304", rec.Code)
+	}
+	if rec := client.Get("tools/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("get of a missing file = %d, want 404", rec.Code)
+	}
+	if rec := client.Get("private/tool.tar.gz"); rec.Code != http.StatusForbidden {
+		t.Errorf("get without permission = %d, want 403", rec.Code)
+	}
+
+	if rec := client.Do("DELETE", "tools/tool.tar.gz", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("evict = %d %s", rec.Code, rec.Body)
+	}
+	client.Get("tools/tool.tar.gz")
+	if fetches.Load() != 2 {
+		t.Errorf("an evicted copy was not fetched again, %d fetches", fetches.Load())
+	}
+}
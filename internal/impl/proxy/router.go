@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	path   string
+	repo   *repo
+	logger slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("proxy", &Router{})
+}
+
+/*
+GET    /proxy/<repo>/<path>    (fetched from the upstream and cached)
+DELETE /proxy/<repo>/<path>    (evicts the cached copy)
+
+The path is rewritten by the first matching rewrite rule before it is
+appended to the upstream url, items restricts which paths are proxied.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		path: r.PathValue("path"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if p := strings.TrimSuffix(parsed.path, "/"); p != "" {
+		if err := repository.ValidatePath("path", p); err != nil {
+			plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+			return nil
+		}
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /proxy/{repo}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.get(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /proxy/{repo}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.evict(parsed, w, r)
+	})
+	return nil
+}
@@ -0,0 +1,36 @@
+package pypi
+
+import (
+	"context"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// browse lists projects at the top level and the uploaded files below a project
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	if p == "" {
+		names, err := repo.localProjects()
+		if err != nil {
+			return nil, err
+		}
+		list := make([]repository.BrowseEntry, 0, len(names))
+		for _, name := range names {
+			list = append(list, repository.BrowseEntry{Name: name, Path: name, Resource: name})
+		}
+		return list, nil
+	}
+	index, err := repo.readLocalIndex(p)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]repository.BrowseEntry, 0, len(index.Files))
+	for _, f := range index.Files {
+		list = append(list, repository.BrowseEntry{
+			Name:     f.Filename,
+			Resource: p,
+			Size:     f.Size,
+			Info:     f.Version,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,341 @@
+package pypi
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// upstream project pages, with the upstream file urls
+	upstream *repository.Cache[project]
+}
+
+const upstreamCacheTTL = 5 * time.Minute
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		upstream: repository.NewCacheMap[project](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.RegisterCache("projects", repo.upstream)
+	repo.handler.Browse = repo.browse
+	repo.handler.Reindex = func(ctx context.Context) error {
+		repo.upstream.Clear()
+		return nil
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
+	return repo.handler.Authorize(w, r, operation, parsed.project)
+}
+
+func indexPath(name string) string {
+	return name + "/index.json"
+}
+
+func filePath(name, filename string) string {
+	return name + "/" + filename
+}
+
+func (repo *repo) localProjects() ([]string, error) {
+	entries, err := fs.ReadDir(repo.handler.Local, ".")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (repo *repo) readLocalIndex(name string) (*project, error) {
+	content, err := repo.handler.ReadLocal(indexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	p := &project{}
+	err = json.Unmarshal(content, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (repo *repo) writeLocalIndex(p *project) error {
+	p.Meta = nil
+	content, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(indexPath(p.Name), content)
+}
+
+// readUpstreamProject fetches outside the cache lock so a slow upstream only
+// delays the lookups of the project being fetched
+func (repo *repo) readUpstreamProject(ctx context.Context, name string) (*project, error) {
+	if cached, age, hit := repo.upstream.Get(name); hit && age < upstreamCacheTTL {
+		return cached, nil
+	}
+	fetched, err := repo.fetchUpstreamProject(ctx, name)
+	var upstreamErr *repository.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		repo.upstream.Purge(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.upstream.Set(name, fetched)
+	return fetched, nil
+}
+
+func (repo *repo) fetchUpstreamProject(ctx context.Context, name string) (*project, error) {
+	pageURL := repo.handler.UpstreamURL("simple", name) + "/"
+	response, err := repo.handler.FetchUpstream(ctx, pageURL, http.Header{"Accept": {jsonMediaType}})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &repository.UpstreamError{URL: pageURL, Status: response.StatusCode}
+	}
+	fetched := &project{}
+	err = json.NewDecoder(response.Body).Decode(fetched)
+	if err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(pageURL)
+	for _, f := range fetched.Files {
+		if ref, err := url.Parse(f.URL); err == nil {
+			f.URL = base.ResolveReference(ref).String()
+		}
+		f.Version = versionOf(f.Filename, name)
+	}
+	return fetched, nil
+}
+
+// files merges the local files of a project with the ones upstream
+func (repo *repo) files(ctx context.Context, name string) (*project, error) {
+	merged := &project{Name: name}
+	local, localErr := repo.readLocalIndex(name)
+	if localErr == nil {
+		merged.Files = append(merged.Files, local.Files...)
+	}
+	if repo.handler.Upstream != nil {
+		upstream, err := repo.readUpstreamProject(ctx, name)
+		if err != nil && localErr != nil {
+			return nil, err
+		}
+		if upstream != nil {
+			for _, f := range upstream.Files {
+				if !slices.ContainsFunc(merged.Files, func(l *file) bool { return l.Filename == f.Filename }) {
+					merged.Files = append(merged.Files, f)
+				}
+			}
+		}
+	} else if localErr != nil {
+		return nil, localErr
+	}
+	return merged, nil
+}
+
+func (repo *repo) getProject(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "list") {
+		return
+	}
+	merged, err := repo.files(r.Context(), parsed.project)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "project not found")
+		return
+	}
+	// hand out copies pointing at this server, the cached upstream urls are still needed
+	page := &project{Name: merged.Name}
+	versions := []string{}
+	for _, f := range merged.Files {
+		local := *f
+		local.URL = "/pypi/packages/" + parsed.project + "/" + url.PathEscape(f.Filename)
+		page.Files = append(page.Files, &local)
+		if f.Version != "" && !slices.Contains(versions, f.Version) {
+			versions = append(versions, f.Version)
+		}
+	}
+	page.Versions = versions
+
+	asJSON := wantsJSON(r.Header.Get("Accept"))
+	if asJSON {
+		w.Header().Set("Content-Type", jsonMediaType)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	err = writeProject(w, asJSON, page)
+	if err != nil {
+		parsed.logger.Error("project:write", slog.String("project", parsed.project), slog.String("error", err.Error()))
+	}
+}
+
+func (repo *repo) download(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "get") {
+		return
+	}
+	target := filePath(parsed.project, parsed.filename)
+	if !repo.handler.LocalFileExists(r.Context(), target) && repo.handler.Upstream != nil {
+		status, err := repo.fetchUpstreamFile(r.Context(), parsed)
+		if err != nil {
+			parsed.logger.Error("file:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, status, "", "could not fetch file from upstream")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+func (repo *repo) fetchUpstreamFile(ctx context.Context, parsed *parsedRequest) (int, error) {
+	upstream, err := repo.readUpstreamProject(ctx, parsed.project)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	index := slices.IndexFunc(upstream.Files, func(f *file) bool { return f.Filename == parsed.filename })
+	if index < 0 {
+		return http.StatusNotFound, errors.New("file not found upstream")
+	}
+	f := upstream.Files[index]
+	target := filePath(parsed.project, parsed.filename)
+	content, err := repo.handler.FetchToLocal(ctx, target, f.URL)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	if expected := f.Hashes["sha256"]; expected != "" {
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != expected {
+			repo.handler.RemoveLocal(target)
+			return http.StatusBadGateway, errors.New("sha256 mismatch")
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// upload implements the legacy upload api used by twine
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "put") {
+		return
+	}
+	content, header, err := r.FormFile("content")
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "missing content")
+		return
+	}
+	defer content.Close()
+	filename := header.Filename
+	if filename == "" || strings.ContainsAny(filename, "/\\") || strings.HasPrefix(filename, ".") {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid filename")
+		return
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read content")
+		return
+	}
+	sha := sha256.Sum256(data)
+	shaHex := hex.EncodeToString(sha[:])
+	if expected := r.FormValue("sha256_digest"); expected != "" && !strings.EqualFold(expected, shaHex) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "sha256 digest mismatch")
+		return
+	}
+	if expected := r.FormValue("md5_digest"); expected != "" {
+		sum := md5.Sum(data)
+		if !strings.EqualFold(expected, hex.EncodeToString(sum[:])) {
+			repo.handler.Fail(w, http.StatusBadRequest, "", "md5 digest mismatch")
+			return
+		}
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	index, err := repo.readLocalIndex(parsed.project)
+	if err != nil {
+		index = &project{Name: parsed.project}
+	}
+	if slices.ContainsFunc(index.Files, func(f *file) bool { return f.Filename == filename }) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "File already exists")
+		return
+	}
+	target := filePath(parsed.project, filename)
+	err = repo.handler.WriteLocal(target, data)
+	if err != nil {
+		parsed.logger.Error("file:write", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not store file")
+		return
+	}
+	version := r.FormValue("version")
+	if version == "" {
+		version = versionOf(filename, parsed.project)
+	}
+	index.Files = append(index.Files, &file{
+		Filename:       filename,
+		Hashes:         map[string]string{"sha256": shaHex},
+		RequiresPython: r.FormValue("requires_python"),
+		Size:           int64(len(data)),
+		UploadTime:     time.Now().UTC().Format(time.RFC3339),
+		Version:        version,
+	})
+	err = repo.writeLocalIndex(index)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("project", parsed.project), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not update index")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+shaHex, int64(len(data)))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(parsed, w, r, "delete") {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	err := repo.handler.HandleLocalDelete(filePath(parsed.project, parsed.filename), parsed.logger, w, r)
+	if err != nil {
+		return
+	}
+	index, err := repo.readLocalIndex(parsed.project)
+	if err != nil {
+		return
+	}
+	index.Files = slices.DeleteFunc(index.Files, func(f *file) bool { return f.Filename == parsed.filename })
+	err = repo.writeLocalIndex(index)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("project", parsed.project), slog.String("error", err.Error()))
+	}
+}
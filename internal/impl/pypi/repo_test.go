@@ -0,0 +1,157 @@
+package pypi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+// uploadBody is the multipart form twine upload sends
+func uploadBody(t *testing.T, name, filename string, content []byte) ([]byte, http.Header) {
+	buffer := bytes.Buffer{}
+	form := multipart.NewWriter(&buffer)
+	form.WriteField(":action", "file_upload")
+	form.WriteField("name", name)
+	sum := sha256.Sum256(content)
+	form.WriteField("sha256_digest", hex.EncodeToString(sum[:]))
+	part, err := form.CreateFormFile("content", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+	return buffer.Bytes(), http.Header{"Content-Type": {form.FormDataContentType()}}
+}
+
+func getProject(t *testing.T, client *repotest.Client, name string) project {
+	var page project
+	rec := client.Do("GET", "simple/"+name+"/", nil, http.Header{"Accept": {jsonMediaType}})
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("project page = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	return page
+}
+
+func TestUploadServesSimpleIndex(t *testing.T) {
+	config := &repository.Config{Name: "pypi-upload", Type: "pypi", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "pypi", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/pypi/")
+
+	// twine sends the project name as written, the index uses the normalized one
+	body, header := uploadBody(t, "DS_Tool", "ds_tool-1.2.3.tar.gz", []byte("sdist"))
+	if rec := client.Do("POST", "", body, header); rec.Code != http.StatusForbidden {
+		t.Errorf("upload of another project = %d, want 403", rec.Code)
+	}
+	body, header = uploadBody(t, "DsTool", "dstool-1.2.3.tar.gz", []byte("sdist"))
+	if rec := client.Do("POST", "", body, header); rec.Code != http.StatusOK {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("POST", "legacy/", body, header); rec.Code != http.StatusBadRequest {
+		t.Errorf("second upload = %d, want 400", rec.Code)
+	}
+
+	if rec := client.Get("simple/"); !strings.Contains(rec.Body.String(), `<a href="dstool/">dstool</a>`) {
+		t.Errorf("index = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("simple/DsTool/"); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/pypi/simple/dstool/" {
+		t.Errorf("unnormalized project = %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	page := getProject(t, client, "dstool")
+	if len(page.Files) != 1 || page.Files[0].URL != "/pypi/packages/dstool/dstool-1.2.3.tar.gz" || page.Files[0].Hashes["sha256"] == "" {
+		t.Fatalf("project files = %+v", page.Files)
+	}
+	if len(page.Versions) != 1 || page.Versions[0] != "1.2.3" {
+		t.Errorf("project versions = %v", page.Versions)
+	}
+	if rec := client.Get("packages/dstool/dstool-1.2.3.tar.gz"); rec.Body.String() != "sdist" {
+		t.Errorf("download = %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := client.Do("DELETE", "packages/dstool/dstool-1.2.3.tar.gz", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if page := getProject(t, client, "dstool"); len(page.Files) != 0 {
+		t.Errorf("project files after delete = %+v", page.Files)
+	}
+}
+
+func TestUpstreamProjectIsCached(t *testing.T) {
+	var pages, files atomic.Int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	sdist := []byte("requests")
+	sum := sha256.Sum256(sdist)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/slow/":
+			fetching <- struct{}{}
+			<-release
+			http.NotFound(w, r)
+		case "/simple/requests/", "/simple/six/":
+			pages.Add(1)
+			name := strings.Split(r.URL.Path, "/")[2]
+			// relative urls are resolved against the page
+			fmt.Fprintf(w, `{"name": %q, "files": [{"filename": "%[1]s-2.0.tar.gz", "url": "../../files/%[1]s-2.0.tar.gz", "hashes": {"sha256": %q}}]}`, name, hex.EncodeToString(sum[:]))
+		case "/files/requests-2.0.tar.gz":
+			files.Add(1)
+			w.Write(sdist)
+		case "/files/six-2.0.tar.gz":
+			w.Write([]byte("tampered"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	config := &repository.Config{Name: "pypi-upstream", Type: "pypi", Items: []string{"*"}}
+	config.Upstream.Url = upstream.URL
+	client := repotest.NewRepo(t, &Router{}, config, "/pypi/")
+
+	for range 2 {
+		if page := getProject(t, client, "requests"); len(page.Files) != 1 || page.Files[0].URL != "/pypi/packages/requests/requests-2.0.tar.gz" {
+			t.Fatalf("project files = %+v", page.Files)
+		}
+		if rec := client.Get("packages/requests/requests-2.0.tar.gz"); rec.Body.String() != "requests" {
+			t.Fatalf("download = %d %q", rec.Code, rec.Body)
+		}
+	}
+	if pages.Load() != 1 || files.Load() != 1 {
+		t.Errorf("upstream served %d pages and %d files, want 1 of each", pages.Load(), files.Load())
+	}
+	if rec := client.Get("packages/six/six-2.0.tar.gz"); rec.Code != http.StatusBadGateway {
+		t.Errorf("download with a wrong hash = %d, want 502", rec.Code)
+	}
+	if rec := client.Get("simple/missing/"); rec.Code != http.StatusNotFound {
+		t.Errorf("project missing upstream = %d, want 404", rec.Code)
+	}
+
+	// a slow upstream project must not hold up the lookups of other projects
+	slow := make(chan int, 1)
+	go func() { slow <- client.Get("simple/slow/").Code }()
+	<-fetching
+	fast := make(chan int, 1)
+	go func() { fast <- client.Get("simple/six/").Code }()
+	select {
+	case code := <-fast:
+		if code != http.StatusOK {
+			t.Errorf("project fetched during a slow fetch = %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a slow upstream fetch blocked another project")
+	}
+	close(release)
+	if code := <-slow; code != http.StatusNotFound {
+		t.Errorf("slow project = %d, want 404", code)
+	}
+}
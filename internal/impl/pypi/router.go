@@ -0,0 +1,156 @@
+package pypi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	routes repository.Routes[*repo]
+	all    []*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	project  string
+	filename string
+	repo     *repo
+	logger   slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("pypi", &Router{})
+}
+
+/*
+GET    /pypi/simple/
+GET    /pypi/simple/<project>/
+GET    /pypi/packages/<project>/<filename>
+DELETE /pypi/packages/<project>/<filename>
+POST   /pypi/           (twine upload, also accepted at /pypi/legacy/)
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.all = append(router.all, repo)
+	return router.routes.Add(config, repo)
+}
+
+func (router *Router) lookupRepo(w http.ResponseWriter, r *http.Request, parsed *parsedRequest) bool {
+	parsed.logger = repository.RequestLogger(r)
+	route := router.routes.Select(parsed.project, &parsed.logger)
+	if route == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return false
+	}
+	parsed.repo = route.Repo
+	return true
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		project:  normalize(r.PathValue("project")),
+		filename: r.PathValue("filename"),
+	}
+	if err := repository.ValidateSegments(r, "project", "filename"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	if !router.lookupRepo(w, r, parsed) {
+		return nil
+	}
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if router.routes.IsEmpty() {
+		return nil
+	}
+	aMux.HandleFunc("GET /pypi/simple/{$}", func(w http.ResponseWriter, r *http.Request) {
+		router.index(w, r)
+	})
+	aMux.HandleFunc("GET /pypi/simple/{project}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/pypi/simple/"+normalize(r.PathValue("project"))+"/", http.StatusMovedPermanently)
+	})
+	aMux.HandleFunc("GET /pypi/simple/{project}/{$}", func(w http.ResponseWriter, r *http.Request) {
+		project := r.PathValue("project")
+		if project != normalize(project) {
+			http.Redirect(w, r, "/pypi/simple/"+normalize(project)+"/", http.StatusMovedPermanently)
+			return
+		}
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getProject(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /pypi/packages/{project}/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.download(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /pypi/packages/{project}/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseMultipartForm(32 << 20)
+		if err != nil {
+			plainError.Fail(w, http.StatusBadRequest, "", "expected multipart form")
+			return
+		}
+		if r.FormValue(":action") != "file_upload" {
+			plainError.Fail(w, http.StatusBadRequest, "", "unsupported action")
+			return
+		}
+		parsed := &parsedRequest{project: normalize(r.FormValue("name"))}
+		if parsed.project == "" {
+			plainError.Fail(w, http.StatusBadRequest, "", "missing name")
+			return
+		}
+		if !router.lookupRepo(w, r, parsed) {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	}
+	aMux.HandleFunc("POST /pypi/{$}", upload)
+	aMux.HandleFunc("POST /pypi/legacy/{$}", upload)
+	return nil
+}
+
+// index lists the locally stored projects of every pypi repository
+func (router *Router) index(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, repo := range router.all {
+		projects, err := repo.localProjects()
+		if err != nil {
+			continue
+		}
+		for _, project := range projects {
+			if allowed, _ := repo.handler.Check("list", project); allowed {
+				names = append(names, project)
+			}
+		}
+	}
+	asJSON := wantsJSON(r.Header.Get("Accept"))
+	if asJSON {
+		w.Header().Set("Content-Type", jsonMediaType)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	writeIndex(w, asJSON, names)
+}
@@ -0,0 +1,148 @@
+package pypi
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonMediaType = "application/vnd.pypi.simple.v1+json"
+	htmlMediaType = "application/vnd.pypi.simple.v1+html"
+)
+
+var normalizeRegexp = regexp.MustCompile(`[-_.]+`)
+
+// normalize implements the PEP 503 project name normalisation
+func normalize(name string) string {
+	return strings.ToLower(normalizeRegexp.ReplaceAllString(name, "-"))
+}
+
+type file struct {
+	Filename       string            `json:"filename"`
+	URL            string            `json:"url"`
+	Hashes         map[string]string `json:"hashes"`
+	RequiresPython string            `json:"requires-python,omitempty"`
+	Size           int64             `json:"size,omitempty"`
+	UploadTime     string            `json:"upload-time,omitempty"`
+	Yanked         any               `json:"yanked,omitempty"`
+	Version        string            `json:"version,omitempty"`
+}
+
+type project struct {
+	Meta     map[string]string `json:"meta"`
+	Name     string            `json:"name"`
+	Files    []*file           `json:"files"`
+	Versions []string          `json:"versions,omitempty"`
+}
+
+type projectList struct {
+	Meta     map[string]string `json:"meta"`
+	Projects []struct {
+		Name string `json:"name"`
+	} `json:"projects"`
+}
+
+var apiMeta = map[string]string{"api-version": "1.1"}
+
+// wantsJSON applies the PEP 691 content negotiation, html is the default
+func wantsJSON(accept string) bool {
+	bestJSON, bestHTML := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case jsonMediaType:
+			bestJSON = max(bestJSON, q)
+		case htmlMediaType, "text/html":
+			bestHTML = max(bestHTML, q)
+		}
+	}
+	return bestJSON > bestHTML
+}
+
+var projectTemplate = template.Must(template.New("project").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="pypi:repository-version" content="1.1">
+<title>Links for {{.Name}}</title>
+</head>
+<body>
+<h1>Links for {{.Name}}</h1>
+{{range .Files}}<a href="{{.URL}}{{with .Hashes.sha256}}#sha256={{.}}{{end}}"{{with .RequiresPython}} data-requires-python="{{.}}"{{end}}>{{.Filename}}</a><br/>
+{{end}}</body>
+</html>
+`))
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="pypi:repository-version" content="1.1">
+<title>Simple index</title>
+</head>
+<body>
+{{range .}}<a href="{{.}}/">{{.}}</a><br/>
+{{end}}</body>
+</html>
+`))
+
+func writeProject(w io.Writer, asJSON bool, p *project) error {
+	sort.Slice(p.Files, func(i, j int) bool {
+		return p.Files[i].Filename < p.Files[j].Filename
+	})
+	if asJSON {
+		p.Meta = apiMeta
+		return json.NewEncoder(w).Encode(p)
+	}
+	return projectTemplate.Execute(w, p)
+}
+
+func writeIndex(w io.Writer, asJSON bool, names []string) error {
+	sort.Strings(names)
+	if asJSON {
+		list := projectList{Meta: apiMeta}
+		for _, name := range names {
+			list.Projects = append(list.Projects, struct {
+				Name string `json:"name"`
+			}{Name: name})
+		}
+		return json.NewEncoder(w).Encode(list)
+	}
+	return indexTemplate.Execute(w, names)
+}
+
+// versionOf guesses the version from a wheel or sdist filename
+func versionOf(filename, name string) string {
+	base := filename
+	for _, ext := range []string{".tar.gz", ".zip", ".tar.bz2", ".whl", ".egg"} {
+		if strings.HasSuffix(base, ext) {
+			base = strings.TrimSuffix(base, ext)
+			break
+		}
+	}
+	if strings.HasSuffix(filename, ".whl") || strings.HasSuffix(filename, ".egg") {
+		parts := strings.Split(base, "-")
+		if len(parts) >= 2 {
+			return parts[1]
+		}
+		return ""
+	}
+	// sdists are <name>-<version> where the name itself may contain dashes
+	if i := strings.LastIndex(base, "-"); i > 0 && normalize(base[:i]) == normalize(name) {
+		return base[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package pypi
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Django":            "django",
+		"zope.interface":    "zope-interface",
+		"Foo__Bar--baz.qux": "foo-bar-baz-qux",
+		"requests":          "requests",
+	}
+	for name, want := range tests {
+		if got := normalize(name); got != want {
+			t.Errorf("normalize(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	tests := []struct {
+		filename string
+		name     string
+		version  string
+	}{
+		{filename: "requests-2.31.0-py3-none-any.whl", name: "requests", version: "2.31.0"},
+		{filename: "requests-2.31.0.tar.gz", name: "requests", version: "2.31.0"},
+		{filename: "zope.interface-6.0.tar.gz", name: "zope-interface", version: "6.0"},
+		{filename: "my-tool-1.0.zip", name: "my_tool", version: "1.0"},
+		{filename: "other-1.0.tar.gz", name: "requests", version: ""},
+	}
+	for _, test := range tests {
+		if got := versionOf(test.filename, test.name); got != test.version {
+			t.Errorf("versionOf(%q, %q) = %q, want %q", test.filename, test.name, got, test.version)
+		}
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                                    false,
+		"text/html":                           false,
+		"application/vnd.pypi.simple.v1+json": true,
+		"application/vnd.pypi.simple.v1+json, text/html;q=0.1":                           true,
+		"application/vnd.pypi.simple.v1+json;q=0.2, application/vnd.pypi.simple.v1+html": false,
+		"*/*": false,
+	}
+	for accept, want := range tests {
+		if got := wantsJSON(accept); got != want {
+			t.Errorf("wantsJSON(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const leadSize = 96
+
+var (
+	leadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// header entry types
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+type entry struct {
+	Type   uint32
+	Offset uint32
+	Count  uint32
+}
+
+// header is one of the two tag stores of an rpm, the signature or the main header
+type header struct {
+	entries map[uint32]entry
+	store   []byte
+}
+
+// readHeader parses the header at offset and returns the offset just past it
+func readHeader(content []byte, offset int) (*header, int, error) {
+	if offset+16 > len(content) || !bytes.Equal(content[offset:offset+4], headerMagic) {
+		return nil, 0, fmt.Errorf("no rpm header at offset %d", offset)
+	}
+	count := int(binary.BigEndian.Uint32(content[offset+8:]))
+	size := int(binary.BigEndian.Uint32(content[offset+12:]))
+	indexStart := offset + 16
+	storeStart := indexStart + 16*count
+	end := storeStart + size
+	if count < 0 || size < 0 || end > len(content) || end < storeStart {
+		return nil, 0, fmt.Errorf("truncated rpm header at offset %d", offset)
+	}
+	h := &header{entries: make(map[uint32]entry, count), store: content[storeStart:end]}
+	for i := 0; i < count; i++ {
+		raw := content[indexStart+16*i:]
+		tag := binary.BigEndian.Uint32(raw)
+		h.entries[tag] = entry{
+			Type:   binary.BigEndian.Uint32(raw[4:]),
+			Offset: binary.BigEndian.Uint32(raw[8:]),
+			Count:  binary.BigEndian.Uint32(raw[12:]),
+		}
+	}
+	return h, end, nil
+}
+
+// readHeaders returns the signature and main headers and the byte range of
+// the main header, which the primary metadata records
+func readHeaders(content []byte) (signature, main *header, start, end int, err error) {
+	if len(content) < leadSize || !bytes.Equal(content[:4], leadMagic) {
+		return nil, nil, 0, 0, fmt.Errorf("not an rpm package")
+	}
+	signature, start, err = readHeader(content, leadSize)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	// the signature header is padded to a multiple of 8 bytes
+	start += (8 - start%8) % 8
+	main, end, err = readHeader(content, start)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	return signature, main, start, end, nil
+}
+
+func (h *header) strings(tag uint32) []string {
+	e, ok := h.entries[tag]
+	if !ok || int(e.Offset) > len(h.store) {
+		return nil
+	}
+	switch e.Type {
+	case typeString, typeStringArray, typeI18NString:
+	default:
+		return nil
+	}
+	count := int(e.Count)
+	if e.Type == typeString {
+		count = 1
+	}
+	values := make([]string, 0, count)
+	data := h.store[e.Offset:]
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+func (h *header) string(tag uint32) string {
+	values := h.strings(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (h *header) ints(tag uint32) []int64 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	width := map[uint32]int{typeInt16: 2, typeInt32: 4, typeInt64: 8}[e.Type]
+	if width == 0 || int(e.Offset)+width*int(e.Count) > len(h.store) {
+		return nil
+	}
+	values := make([]int64, e.Count)
+	for i := range values {
+		raw := h.store[int(e.Offset)+width*i:]
+		switch width {
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(raw))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(raw))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(raw))
+		}
+	}
+	return values
+}
+
+func (h *header) int(tag uint32) (int64, bool) {
+	values := h.ints(tag)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
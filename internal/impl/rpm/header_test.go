@@ -0,0 +1,148 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// buildHeader encodes tags as an rpm header, values are strings, []string or []int32
+func buildHeader(tags map[uint32]any) []byte {
+	keys := make([]uint32, 0, len(tags))
+	for tag := range tags {
+		keys = append(keys, tag)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	index := bytes.Buffer{}
+	store := bytes.Buffer{}
+	for _, tag := range keys {
+		var typ, count uint32
+		switch value := tags[tag].(type) {
+		case string:
+			typ, count = typeString, 1
+			store.WriteString(value + "\x00")
+		case []string:
+			typ, count = typeStringArray, uint32(len(value))
+			for _, s := range value {
+				store.WriteString(s + "\x00")
+			}
+		case []int32:
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+			typ, count = typeInt32, uint32(len(value))
+			offset := store.Len()
+			binary.Write(&store, binary.BigEndian, value)
+			binary.Write(&index, binary.BigEndian, []uint32{tag, typ, uint32(offset), count})
+			continue
+		}
+		offset := store.Len() - int(storeLen(tags[tag]))
+		binary.Write(&index, binary.BigEndian, []uint32{tag, typ, uint32(offset), count})
+	}
+	result := bytes.Buffer{}
+	result.Write(headerMagic)
+	result.Write([]byte{0, 0, 0, 0})
+	binary.Write(&result, binary.BigEndian, []uint32{uint32(len(keys)), uint32(store.Len())})
+	result.Write(index.Bytes())
+	result.Write(store.Bytes())
+	return result.Bytes()
+}
+
+func storeLen(value any) int {
+	switch value := value.(type) {
+	case string:
+		return len(value) + 1
+	case []string:
+		return len(strings.Join(value, "\x00")) + 1
+	}
+	return 0
+}
+
+func makeRPM() []byte {
+	content := bytes.Buffer{}
+	lead := make([]byte, leadSize)
+	copy(lead, leadMagic)
+	content.Write(lead)
+	content.Write(buildHeader(map[uint32]any{sigTagPayloadSize: []int32{4096}}))
+	for content.Len()%8 != 0 {
+		content.WriteByte(0)
+	}
+	content.Write(buildHeader(map[uint32]any{
+		tagName:           "dstool",
+		tagVersion:        "1.2.3",
+		tagRelease:        "1.el9",
+		tagEpoch:          []int32{2},
+		tagSummary:        "a tool",
+		tagArch:           "x86_64",
+		tagSourceRPM:      "dstool-1.2.3-1.el9.src.rpm",
+		tagSize:           []int32{1234},
+		tagProvideName:    []string{"dstool", "dstool(x86-64)"},
+		tagProvideFlags:   []int32{senseEqual, senseEqual},
+		tagProvideVersion: []string{"2:1.2.3-1.el9", "2:1.2.3-1.el9"},
+		tagRequireName:    []string{"rpmlib(CompressedFileNames)", "libc.so.6", "bash"},
+		tagRequireFlags:   []int32{senseLess | senseEqual, 0, senseGreater | senseEqual | sensePrereq},
+		tagRequireVersion: []string{"3.0.4-1", "", "5.0"},
+		tagBaseNames:      []string{"dstool", "dstool", "README"},
+		tagDirNames:       []string{"/usr/bin/", "/usr/share/doc/"},
+		tagDirIndexes:     []int32{0, 1, 1},
+		tagFileModes:      []int32{0100755, 040755, 0100644},
+	}))
+	content.WriteString("payload")
+	return content.Bytes()
+}
+
+func TestReadPackage(t *testing.T) {
+	p, err := readPackage(makeRPM(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Filename() != "dstool-1.2.3-1.el9.x86_64.rpm" || p.Epoch != "2" {
+		t.Errorf("unexpected package %s epoch %s", p.Filename(), p.Epoch)
+	}
+	if p.InstalledSize != 1234 || p.ArchiveSize != 4096 {
+		t.Errorf("unexpected sizes %d %d", p.InstalledSize, p.ArchiveSize)
+	}
+	if len(p.Requires) != 2 || p.Requires[1].Flags != "GE" || p.Requires[1].Ver != "5.0" || p.Requires[1].Pre != "1" {
+		t.Errorf("unexpected requires %+v", p.Requires)
+	}
+	if p.Provides[0].Epoch != "2" || p.Provides[0].Ver != "1.2.3" || p.Provides[0].Rel != "1.el9" {
+		t.Errorf("unexpected provides %+v", p.Provides)
+	}
+	if len(p.Files) != 3 || p.Files[0].Path != "/usr/bin/dstool" || p.Files[1].Type != "dir" {
+		t.Errorf("unexpected files %+v", p.Files)
+	}
+
+	primary, err := primaryXML([]*Package{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<rpm:entry name="bash" flags="GE" epoch="0" ver="5.0" pre="1"></rpm:entry>`,
+		`<file>/usr/bin/dstool</file>`,
+		`<version epoch="2" ver="1.2.3" rel="1.el9"></version>`,
+	} {
+		if !strings.Contains(string(primary), want) {
+			t.Errorf("primary.xml does not contain %s:\n%s", want, primary)
+		}
+	}
+	if strings.Contains(string(primary), "README") {
+		t.Errorf("primary.xml lists non primary files")
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	for filename, want := range map[string]string{
+		"dstool-1.2.3-1.el9.x86_64.rpm": "dstool",
+		"ds-tool-1.0-1.noarch.rpm":      "ds-tool",
+		"dstool.rpm":                    "",
+		"../etc-1-1.rpm":                "",
+	} {
+		got, _ := nameOf(filename)
+		if got != want {
+			t.Errorf("nameOf(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
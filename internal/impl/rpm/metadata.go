@@ -0,0 +1,452 @@
+package rpm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// header tags used for the repository metadata
+const (
+	tagName            = 1000
+	tagVersion         = 1001
+	tagRelease         = 1002
+	tagEpoch           = 1003
+	tagSummary         = 1004
+	tagDescription     = 1005
+	tagBuildTime       = 1006
+	tagBuildHost       = 1007
+	tagSize            = 1009
+	tagVendor          = 1011
+	tagLicense         = 1014
+	tagPackager        = 1015
+	tagGroup           = 1016
+	tagURL             = 1020
+	tagArch            = 1022
+	tagFileModes       = 1030
+	tagFileFlags       = 1037
+	tagSourceRPM       = 1044
+	tagArchiveSize     = 1046
+	tagProvideName     = 1047
+	tagRequireFlags    = 1048
+	tagRequireName     = 1049
+	tagRequireVersion  = 1050
+	tagConflictFlags   = 1053
+	tagConflictName    = 1054
+	tagConflictVersion = 1055
+	tagChangelogTime   = 1080
+	tagChangelogName   = 1081
+	tagChangelogText   = 1082
+	tagObsoleteName    = 1090
+	tagProvideFlags    = 1112
+	tagProvideVersion  = 1113
+	tagObsoleteFlags   = 1114
+	tagObsoleteVersion = 1115
+	tagDirIndexes      = 1116
+	tagBaseNames       = 1117
+	tagDirNames        = 1118
+	tagLongSize        = 5009
+
+	sigTagPayloadSize = 1007
+)
+
+// dependency flags
+const (
+	senseLess       = 0x02
+	senseGreater    = 0x04
+	senseEqual      = 0x08
+	sensePrereq     = 0x40
+	senseScriptPre  = 0x200
+	senseScriptPost = 0x400
+	fileFlagGhost   = 0x40
+)
+
+type Dependency struct {
+	Name  string `xml:"name,attr" json:"name"`
+	Flags string `xml:"flags,attr,omitempty" json:"flags,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty" json:"epoch,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty" json:"ver,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty" json:"rel,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty" json:"pre,omitempty"`
+}
+
+type File struct {
+	Type string `xml:"type,attr,omitempty" json:"type,omitempty"`
+	Path string `xml:",chardata" json:"path"`
+}
+
+type Changelog struct {
+	Author string `xml:"author,attr" json:"author"`
+	Date   int64  `xml:"date,attr" json:"date"`
+	Text   string `xml:",chardata" json:"text"`
+}
+
+// Package is what the repository metadata records about one rpm, it is kept
+// in the store so the metadata can be regenerated without reading every rpm
+type Package struct {
+	Name          string       `json:"name"`
+	Arch          string       `json:"arch"`
+	Epoch         string       `json:"epoch"`
+	Version       string       `json:"version"`
+	Release       string       `json:"release"`
+	Checksum      string       `json:"checksum"`
+	Summary       string       `json:"summary"`
+	Description   string       `json:"description"`
+	Packager      string       `json:"packager"`
+	URL           string       `json:"url"`
+	FileTime      int64        `json:"filetime"`
+	BuildTime     int64        `json:"buildtime"`
+	Size          int64        `json:"size"`
+	InstalledSize int64        `json:"installedsize"`
+	ArchiveSize   int64        `json:"archivesize"`
+	Location      string       `json:"location"`
+	License       string       `json:"license"`
+	Vendor        string       `json:"vendor"`
+	Group         string       `json:"group"`
+	BuildHost     string       `json:"buildhost"`
+	SourceRPM     string       `json:"sourcerpm"`
+	HeaderStart   int          `json:"headerstart"`
+	HeaderEnd     int          `json:"headerend"`
+	Provides      []Dependency `json:"provides,omitempty"`
+	Requires      []Dependency `json:"requires,omitempty"`
+	Conflicts     []Dependency `json:"conflicts,omitempty"`
+	Obsoletes     []Dependency `json:"obsoletes,omitempty"`
+	Files         []File       `json:"files,omitempty"`
+	Changelogs    []Changelog  `json:"changelogs,omitempty"`
+}
+
+// Filename is the canonical name-version-release.arch.rpm file name
+func (p *Package) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, p.Arch)
+}
+
+func readPackage(content []byte, fileTime int64) (*Package, error) {
+	signature, main, start, end, err := readHeaders(content)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{
+		Name:        main.string(tagName),
+		Arch:        main.string(tagArch),
+		Epoch:       "0",
+		Version:     main.string(tagVersion),
+		Release:     main.string(tagRelease),
+		Checksum:    sha256Hex(content),
+		Summary:     main.string(tagSummary),
+		Description: main.string(tagDescription),
+		Packager:    main.string(tagPackager),
+		URL:         main.string(tagURL),
+		FileTime:    fileTime,
+		Size:        int64(len(content)),
+		License:     main.string(tagLicense),
+		Vendor:      main.string(tagVendor),
+		Group:       main.string(tagGroup),
+		BuildHost:   main.string(tagBuildHost),
+		SourceRPM:   main.string(tagSourceRPM),
+		HeaderStart: start,
+		HeaderEnd:   end,
+	}
+	if p.Name == "" || p.Version == "" || p.Release == "" || p.Arch == "" {
+		return nil, fmt.Errorf("rpm header has no name, version, release or arch")
+	}
+	if main.entries[tagSourceRPM].Count == 0 {
+		p.Arch = "src"
+	}
+	if epoch, ok := main.int(tagEpoch); ok {
+		p.Epoch = strconv.FormatInt(epoch, 10)
+	}
+	p.BuildTime, _ = main.int(tagBuildTime)
+	if size, ok := main.int(tagLongSize); ok {
+		p.InstalledSize = size
+	} else {
+		p.InstalledSize, _ = main.int(tagSize)
+	}
+	if size, ok := signature.int(sigTagPayloadSize); ok {
+		p.ArchiveSize = size
+	} else {
+		p.ArchiveSize, _ = main.int(tagArchiveSize)
+	}
+	p.Provides = dependencies(main, tagProvideName, tagProvideFlags, tagProvideVersion)
+	p.Requires = dependencies(main, tagRequireName, tagRequireFlags, tagRequireVersion)
+	p.Conflicts = dependencies(main, tagConflictName, tagConflictFlags, tagConflictVersion)
+	p.Obsoletes = dependencies(main, tagObsoleteName, tagObsoleteFlags, tagObsoleteVersion)
+	p.Files = files(main)
+
+	times := main.ints(tagChangelogTime)
+	names := main.strings(tagChangelogName)
+	texts := main.strings(tagChangelogText)
+	for i := 0; i < len(times) && i < len(names) && i < len(texts); i++ {
+		p.Changelogs = append(p.Changelogs, Changelog{Author: names[i], Date: times[i], Text: texts[i]})
+	}
+	return p, nil
+}
+
+var evrRegexp = regexp.MustCompile(`^(?:(\d+):)?([^-]*)(?:-(.*))?$`)
+
+func dependencies(h *header, nameTag, flagsTag, versionTag uint32) []Dependency {
+	names := h.strings(nameTag)
+	flags := h.ints(flagsTag)
+	versions := h.strings(versionTag)
+	deps := []Dependency{}
+	for i, name := range names {
+		// rpmlib() dependencies are satisfied by rpm itself
+		if len(name) > 7 && name[:7] == "rpmlib(" {
+			continue
+		}
+		dep := Dependency{Name: name}
+		var flag int64
+		if i < len(flags) {
+			flag = flags[i]
+		}
+		dep.Flags = map[int64]string{
+			senseLess: "LT", senseGreater: "GT", senseEqual: "EQ",
+			senseLess | senseEqual: "LE", senseGreater | senseEqual: "GE",
+		}[flag&(senseLess|senseGreater|senseEqual)]
+		if dep.Flags != "" && i < len(versions) {
+			if match := evrRegexp.FindStringSubmatch(versions[i]); match != nil {
+				dep.Epoch, dep.Ver, dep.Rel = match[1], match[2], match[3]
+				if dep.Epoch == "" {
+					dep.Epoch = "0"
+				}
+			}
+		}
+		if flag&(sensePrereq|senseScriptPre|senseScriptPost) != 0 {
+			dep.Pre = "1"
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+func files(h *header) []File {
+	baseNames := h.strings(tagBaseNames)
+	dirNames := h.strings(tagDirNames)
+	dirIndexes := h.ints(tagDirIndexes)
+	modes := h.ints(tagFileModes)
+	flags := h.ints(tagFileFlags)
+	result := make([]File, 0, len(baseNames))
+	for i, base := range baseNames {
+		if i >= len(dirIndexes) || int(dirIndexes[i]) >= len(dirNames) {
+			break
+		}
+		f := File{Path: dirNames[dirIndexes[i]] + base}
+		switch {
+		case i < len(flags) && flags[i]&fileFlagGhost != 0:
+			f.Type = "ghost"
+		case i < len(modes) && modes[i]&0170000 == 040000:
+			f.Type = "dir"
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// primaryFile selects the files listed in primary.xml as well as filelists.xml
+var primaryFile = regexp.MustCompile(`^(/etc/|.*bin/|/usr/lib/sendmail$)`)
+
+type version struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+func (p *Package) version() version {
+	return version{Epoch: p.Epoch, Ver: p.Version, Rel: p.Release}
+}
+
+type dependencyList struct {
+	Entries []Dependency `xml:"rpm:entry"`
+}
+
+func dependencyListOf(deps []Dependency) *dependencyList {
+	if len(deps) == 0 {
+		return nil
+	}
+	return &dependencyList{Entries: deps}
+}
+
+type primaryPackage struct {
+	Type     string  `xml:"type,attr"`
+	Name     string  `xml:"name"`
+	Arch     string  `xml:"arch"`
+	Version  version `xml:"version"`
+	Checksum struct {
+		Type  string `xml:"type,attr"`
+		PkgID string `xml:"pkgid,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"checksum"`
+	Summary     string `xml:"summary"`
+	Description string `xml:"description"`
+	Packager    string `xml:"packager"`
+	URL         string `xml:"url"`
+	Time        struct {
+		File  int64 `xml:"file,attr"`
+		Build int64 `xml:"build,attr"`
+	} `xml:"time"`
+	Size struct {
+		Package   int64 `xml:"package,attr"`
+		Installed int64 `xml:"installed,attr"`
+		Archive   int64 `xml:"archive,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Format struct {
+		License     string `xml:"rpm:license"`
+		Vendor      string `xml:"rpm:vendor"`
+		Group       string `xml:"rpm:group"`
+		BuildHost   string `xml:"rpm:buildhost"`
+		SourceRPM   string `xml:"rpm:sourcerpm"`
+		HeaderRange struct {
+			Start int `xml:"start,attr"`
+			End   int `xml:"end,attr"`
+		} `xml:"rpm:header-range"`
+		Provides  *dependencyList `xml:"rpm:provides,omitempty"`
+		Requires  *dependencyList `xml:"rpm:requires,omitempty"`
+		Conflicts *dependencyList `xml:"rpm:conflicts,omitempty"`
+		Obsoletes *dependencyList `xml:"rpm:obsoletes,omitempty"`
+		Files     []File          `xml:"file"`
+	} `xml:"format"`
+}
+
+type primaryMetadata struct {
+	XMLName  xml.Name         `xml:"metadata"`
+	XMLNS    string           `xml:"xmlns,attr"`
+	RPMNS    string           `xml:"xmlns:rpm,attr"`
+	Count    int              `xml:"packages,attr"`
+	Packages []primaryPackage `xml:"package"`
+}
+
+type filelistsPackage struct {
+	PkgID   string  `xml:"pkgid,attr"`
+	Name    string  `xml:"name,attr"`
+	Arch    string  `xml:"arch,attr"`
+	Version version `xml:"version"`
+	Files   []File  `xml:"file"`
+}
+
+type filelistsMetadata struct {
+	XMLName  xml.Name           `xml:"filelists"`
+	XMLNS    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []filelistsPackage `xml:"package"`
+}
+
+type otherPackage struct {
+	PkgID      string      `xml:"pkgid,attr"`
+	Name       string      `xml:"name,attr"`
+	Arch       string      `xml:"arch,attr"`
+	Version    version     `xml:"version"`
+	Changelogs []Changelog `xml:"changelog"`
+}
+
+type otherMetadata struct {
+	XMLName  xml.Name       `xml:"otherdata"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	Count    int            `xml:"packages,attr"`
+	Packages []otherPackage `xml:"package"`
+}
+
+func encodeXML(v any) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+func primaryXML(packages []*Package) ([]byte, error) {
+	metadata := primaryMetadata{
+		XMLNS: "http://linux.duke.edu/metadata/common",
+		RPMNS: "http://linux.duke.edu/metadata/rpm",
+		Count: len(packages),
+	}
+	for _, p := range packages {
+		pp := primaryPackage{Type: "rpm", Name: p.Name, Arch: p.Arch, Version: p.version()}
+		pp.Checksum.Type = "sha256"
+		pp.Checksum.PkgID = "YES"
+		pp.Checksum.Value = p.Checksum
+		pp.Summary = p.Summary
+		pp.Description = p.Description
+		pp.Packager = p.Packager
+		pp.URL = p.URL
+		pp.Time.File = p.FileTime
+		pp.Time.Build = p.BuildTime
+		pp.Size.Package = p.Size
+		pp.Size.Installed = p.InstalledSize
+		pp.Size.Archive = p.ArchiveSize
+		pp.Location.Href = p.Location
+		pp.Format.License = p.License
+		pp.Format.Vendor = p.Vendor
+		pp.Format.Group = p.Group
+		pp.Format.BuildHost = p.BuildHost
+		pp.Format.SourceRPM = p.SourceRPM
+		pp.Format.HeaderRange.Start = p.HeaderStart
+		pp.Format.HeaderRange.End = p.HeaderEnd
+		pp.Format.Provides = dependencyListOf(p.Provides)
+		pp.Format.Requires = dependencyListOf(p.Requires)
+		pp.Format.Conflicts = dependencyListOf(p.Conflicts)
+		pp.Format.Obsoletes = dependencyListOf(p.Obsoletes)
+		for _, f := range p.Files {
+			if f.Type != "ghost" && primaryFile.MatchString(f.Path) {
+				pp.Format.Files = append(pp.Format.Files, f)
+			}
+		}
+		metadata.Packages = append(metadata.Packages, pp)
+	}
+	return encodeXML(metadata)
+}
+
+func filelistsXML(packages []*Package) ([]byte, error) {
+	metadata := filelistsMetadata{XMLNS: "http://linux.duke.edu/metadata/filelists", Count: len(packages)}
+	for _, p := range packages {
+		metadata.Packages = append(metadata.Packages, filelistsPackage{
+			PkgID: p.Checksum, Name: p.Name, Arch: p.Arch, Version: p.version(), Files: p.Files,
+		})
+	}
+	return encodeXML(metadata)
+}
+
+func otherXML(packages []*Package) ([]byte, error) {
+	metadata := otherMetadata{XMLNS: "http://linux.duke.edu/metadata/other", Count: len(packages)}
+	for _, p := range packages {
+		metadata.Packages = append(metadata.Packages, otherPackage{
+			PkgID: p.Checksum, Name: p.Name, Arch: p.Arch, Version: p.version(), Changelogs: p.Changelogs,
+		})
+	}
+	return encodeXML(metadata)
+}
+
+type repomdData struct {
+	Type     string `xml:"type,attr"`
+	Checksum struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"checksum"`
+	OpenChecksum struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"open-checksum"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp int64 `xml:"timestamp"`
+	Size      int64 `xml:"size"`
+	OpenSize  int64 `xml:"open-size"`
+}
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	RPMNS    string       `xml:"xmlns:rpm,attr"`
+	Revision int64        `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+// dataFile is a compressed metadata file named after its checksum so caches
+// never mix an old repomd.xml with new data
+func dataFile(kind string, compressed []byte) string {
+	return path.Join("repodata", sha256Hex(compressed)+"-"+kind+".xml.gz")
+}
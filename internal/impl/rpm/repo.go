@@ -0,0 +1,257 @@
+package rpm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	signer  *signing.Signer
+}
+
+const maxPackageSize = 1024 * 1024 * 1024
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_~^-]*$`)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{}
+	var err error
+	repo.signer, err = signing.Load(config.Signing)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.Reindex = repo.reindex
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+// reindex rebuilds the metadata from the stored packages
+func (repo *repo) reindex(ctx context.Context) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	entries, err := fs.ReadDir(repo.handler.Local, "packages")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	packages := []*Package{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".rpm" {
+			continue
+		}
+		location := "packages/" + entry.Name()
+		content, err := repo.handler.ReadLocal(location)
+		if err != nil {
+			return err
+		}
+		fileTime := time.Now().Unix()
+		if info, err := entry.Info(); err == nil {
+			fileTime = info.ModTime().Unix()
+		}
+		p, err := readPackage(content, fileTime)
+		if err != nil {
+			slog.Warn("rpm:reindex", slog.String("target", location), slog.String("error", err.Error()))
+			continue
+		}
+		p.Location = location
+		packages = append(packages, p)
+	}
+	return repo.publish(packages)
+}
+
+// nameOf extracts the package name from a name-version-release.arch.rpm file name
+func nameOf(filename string) (string, bool) {
+	base, found := strings.CutSuffix(filename, ".rpm")
+	if !found || !validName.MatchString(base) {
+		return "", false
+	}
+	parts := strings.Split(base, "-")
+	if len(parts) < 3 {
+		return "", false
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), true
+}
+
+func (repo *repo) getMetadata(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", "repodata") {
+		return
+	}
+	switch {
+	case parsed.file == "repomd.xml.key":
+		if repo.signer == nil {
+			repo.handler.Fail(w, http.StatusNotFound, "", "")
+			return
+		}
+		key, err := repo.signer.PublicKey()
+		if err != nil {
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pgp-keys")
+		w.Write(key)
+		return
+	case strings.HasSuffix(parsed.file, ".xml"):
+		w.Header().Set("Content-Type", "application/xml")
+	case strings.HasSuffix(parsed.file, ".gz"):
+		w.Header().Set("Content-Type", "application/gzip")
+	case strings.HasSuffix(parsed.file, ".asc"):
+		w.Header().Set("Content-Type", "application/pgp-signature")
+	}
+	repo.handler.HandleLocalGet("repodata/"+parsed.file, parsed.logger, w, r)
+}
+
+func (repo *repo) getPackage(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	name, ok := nameOf(parsed.file)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "get", name) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-rpm")
+	repo.handler.HandleLocalGet("packages/"+parsed.file, parsed.logger, w, r)
+}
+
+// readUpload accepts the package as the raw body or as the "file" field of a form
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(io.LimitReader(r.Body, maxPackageSize))
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxPackageSize))
+}
+
+func (repo *repo) upload(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	content, err := readUpload(r)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read package")
+		return
+	}
+	p, err := readPackage(content, time.Now().Unix())
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	filename := p.Filename()
+	if !validName.MatchString(p.Name) || !validName.MatchString(p.Arch) || !validName.MatchString(strings.TrimSuffix(filename, ".rpm")) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid package name, version, release or architecture")
+		return
+	}
+	if !repo.IsAllowed(w, r, "put", p.Name) {
+		return
+	}
+	if !repo.handler.Serves(p.Name) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "package "+p.Name+" is not served by this repository")
+		return
+	}
+	p.Location = "packages/" + filename
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	existing, err := repo.handler.ReadLocal(p.Location)
+	switch {
+	case err == nil && sha256Hex(existing) != p.Checksum:
+		repo.handler.Fail(w, http.StatusConflict, "", filename+" already exists with different content")
+		return
+	case err != nil:
+		err = repo.handler.WriteLocal(p.Location, content)
+		if err != nil {
+			parsed.logger.Error("package:write", slog.String("target", p.Location), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	packages, err := repo.readIndex()
+	if err == nil {
+		packages = slices.DeleteFunc(packages, func(existing *Package) bool {
+			return existing.Location == p.Location
+		})
+		err = repo.publish(append(packages, p))
+	}
+	if err != nil {
+		parsed.logger.Error("repodata:write", slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, p.Location, "sha256:"+p.Checksum, p.Size)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (repo *repo) delete(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	name, ok := nameOf(parsed.file)
+	if !ok {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "delete", name) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	location := "packages/" + parsed.file
+	packages, err := repo.readIndex()
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	index := slices.IndexFunc(packages, func(p *Package) bool {
+		return p.Location == location
+	})
+	if index < 0 {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	removed := packages[index]
+	err = repo.publish(slices.Delete(packages, index, index+1))
+	if err != nil {
+		parsed.logger.Error("repodata:write", slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	err = repo.handler.RemoveLocal(location)
+	if err != nil {
+		parsed.logger.Error("package:delete", slog.String("target", location), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionDelete, location, "sha256:"+removed.Checksum, removed.Size)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+// primaryData follows repomd.xml to the package list dnf reads
+func primaryData(t *testing.T, client *repotest.Client, repomd []byte) string {
+	href := regexp.MustCompile(`href="repodata/([^"]*-primary\.xml\.gz)"`).FindSubmatch(repomd)
+	if href == nil {
+		t.Fatalf("repomd.xml does not reference primary data:\n%s", repomd)
+	}
+	rec := client.Get("repodata/" + string(href[1]))
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("primary data = %d: %v", rec.Code, err)
+	}
+	primary, _ := io.ReadAll(gz)
+	return string(primary)
+}
+
+func TestUploadSignsRepodata(t *testing.T) {
+	config := &repository.Config{Name: "rpm-repodata", Type: "rpm", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "rpm", "dstool")
+	var keyring openpgp.EntityList
+	config.Signing, keyring = repotest.SigningKey(t)
+	client := repotest.NewRepo(t, &Router{}, config, "/rpm/rpm-repodata/")
+
+	rpm := makeRPM()
+	if rec := client.Do("POST", "packages", rpm, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("packages/dstool-1.2.3-1.el9.x86_64.rpm"); !bytes.Equal(rec.Body.Bytes(), rpm) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	repomd := client.Get("repodata/repomd.xml").Body.Bytes()
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(repomd), client.Get("repodata/repomd.xml.asc").Body, nil); err != nil {
+		t.Errorf("repomd.xml.asc does not verify: %v", err)
+	}
+	if rec := client.Get("repodata/repomd.xml.key"); rec.Code != http.StatusOK {
+		t.Errorf("repomd.xml.key = %d", rec.Code)
+	}
+	if primary := primaryData(t, client, repomd); !strings.Contains(primary, `<location href="packages/dstool-1.2.3-1.el9.x86_64.rpm">`) {
+		t.Errorf("primary data does not list the package:\n%s", primary)
+	}
+
+	// the package name is taken from the file name of a delete
+	if rec := client.Do("DELETE", "packages/other-1.0-1.x86_64.rpm", nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete of another package = %d, want 403", rec.Code)
+	}
+	if rec := client.Do("DELETE", "packages/dstool-1.2.3-1.el9.x86_64.rpm", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if primary := primaryData(t, client, client.Get("repodata/repomd.xml").Body.Bytes()); strings.Contains(primary, "dstool") {
+		t.Errorf("primary data after delete still lists the package:\n%s", primary)
+	}
+}
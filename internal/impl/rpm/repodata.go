@@ -0,0 +1,145 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+const (
+	indexFile  = "index.json"
+	repomdFile = "repodata/repomd.xml"
+)
+
+func (repo *repo) readIndex() ([]*Package, error) {
+	content, err := repo.handler.ReadLocal(indexFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*Package{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packages := []*Package{}
+	err = json.Unmarshal(content, &packages)
+	return packages, err
+}
+
+func (repo *repo) writeIndex(packages []*Package) error {
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Location < packages[j].Location
+	})
+	content, err := json.MarshalIndent(packages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal(indexFile, content)
+}
+
+func gzipped(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&buffer)
+	_, err := gz.Write(content)
+	if err == nil {
+		err = gz.Close()
+	}
+	return buffer.Bytes(), err
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// publish writes the index and regenerates repodata from it, data files
+// are written before repomd.xml so clients never see a dangling reference
+func (repo *repo) publish(packages []*Package) error {
+	err := repo.writeIndex(packages)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	md := repomd{
+		XMLNS:    "http://linux.duke.edu/metadata/repo",
+		RPMNS:    "http://linux.duke.edu/metadata/rpm",
+		Revision: now,
+	}
+	keep := map[string]bool{}
+	for _, kind := range []struct {
+		name     string
+		generate func([]*Package) ([]byte, error)
+	}{
+		{"primary", primaryXML},
+		{"filelists", filelistsXML},
+		{"other", otherXML},
+	} {
+		content, err := kind.generate(packages)
+		if err != nil {
+			return err
+		}
+		compressed, err := gzipped(content)
+		if err != nil {
+			return err
+		}
+		location := dataFile(kind.name, compressed)
+		err = repo.handler.WriteLocal(location, compressed)
+		if err != nil {
+			return err
+		}
+		keep[path.Base(location)] = true
+
+		data := repomdData{Type: kind.name, Timestamp: now}
+		data.Checksum.Type = "sha256"
+		data.Checksum.Value = sha256Hex(compressed)
+		data.OpenChecksum.Type = "sha256"
+		data.OpenChecksum.Value = sha256Hex(content)
+		data.Location.Href = location
+		data.Size = int64(len(compressed))
+		data.OpenSize = int64(len(content))
+		md.Data = append(md.Data, data)
+	}
+	content, err := encodeXML(md)
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(repomdFile, content)
+	if err != nil {
+		return err
+	}
+	if repo.signer != nil {
+		signature, err := repo.signer.DetachSign(content)
+		if err != nil {
+			return err
+		}
+		err = repo.handler.WriteLocal(repomdFile+".asc", signature)
+		if err != nil {
+			return err
+		}
+	}
+	return repo.removeStaleData(keep)
+}
+
+// removeStaleData deletes data files no longer referenced by repomd.xml
+func (repo *repo) removeStaleData(keep map[string]bool) error {
+	entries, err := fs.ReadDir(repo.handler.Local, "repodata")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || keep[name] || path.Ext(name) != ".gz" {
+			continue
+		}
+		err = repo.handler.RemoveLocal("repodata/" + name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package rpm
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	file   string
+	repo   *repo
+	logger slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("rpm", &Router{})
+}
+
+/*
+GET    /rpm/<repo>/repodata/repomd.xml[.asc|.key]
+GET    /rpm/<repo>/repodata/<checksum>-{primary,filelists,other}.xml.gz
+GET    /rpm/<repo>/packages/<name>-<version>-<release>.<arch>.rpm
+POST   /rpm/<repo>/packages                                     (upload a .rpm)
+DELETE /rpm/<repo>/packages/<name>-<version>-<release>.<arch>.rpm
+
+A yum/dnf repo file uses "baseurl=<base>/rpm/<repo>", items restricts
+which package names may be uploaded.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		file: r.PathValue("file"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "file"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /rpm/{repo}/repodata/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getMetadata(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /rpm/{repo}/packages/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getPackage(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /rpm/{repo}/packages", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.upload(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /rpm/{repo}/packages/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.delete(parsed, w, r)
+	})
+	return nil
+}
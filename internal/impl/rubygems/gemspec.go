@@ -0,0 +1,183 @@
+package rubygems
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	validName     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	validVersion  = regexp.MustCompile(`^[0-9]+(\.[0-9A-Za-z]+)*$`)
+	validPlatform = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	gemFilename   = regexp.MustCompile(`^(.+?)-([0-9][0-9A-Za-z.]*)(?:-(.+))?\.gem$`)
+)
+
+// requirement is a Gem::Requirement, each entry is an operator and a Gem::Version
+type requirement struct {
+	Requirements [][]yaml.Node `yaml:"requirements"`
+}
+
+// String formats the requirement as the compact index does, "&" separated
+func (req requirement) String() string {
+	parts := []string{}
+	for _, pair := range req.Requirements {
+		if len(pair) != 2 {
+			continue
+		}
+		var op string
+		var version struct {
+			Version string `yaml:"version"`
+		}
+		if pair[0].Decode(&op) != nil || pair[1].Decode(&version) != nil {
+			continue
+		}
+		parts = append(parts, op+" "+version.Version)
+	}
+	return strings.Join(parts, "&")
+}
+
+type gemspec struct {
+	Name    string `yaml:"name"`
+	Version struct {
+		Version string `yaml:"version"`
+	} `yaml:"version"`
+	Platform     string `yaml:"platform"`
+	Dependencies []struct {
+		Name        string      `yaml:"name"`
+		Type        string      `yaml:"type"`
+		Requirement requirement `yaml:"requirement"`
+	} `yaml:"dependencies"`
+	RequiredRubyVersion     requirement `yaml:"required_ruby_version"`
+	RequiredRubygemsVersion requirement `yaml:"required_rubygems_version"`
+}
+
+// gemVersion is what the index records about a pushed version, the versions
+// of a gem are kept together in specs/<name>.json
+type gemVersion struct {
+	Number       string    `json:"number"`
+	Platform     string    `json:"platform"`
+	Dependencies []string  `json:"dependencies,omitempty"`
+	Ruby         string    `json:"ruby,omitempty"`
+	Rubygems     string    `json:"rubygems,omitempty"`
+	Checksum     string    `json:"checksum"`
+	Yanked       bool      `json:"yanked,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// fullVersion is the version with its platform, unless that is plain ruby
+func (v *gemVersion) fullVersion() string {
+	if v.Platform == "" || v.Platform == "ruby" {
+		return v.Number
+	}
+	return v.Number + "-" + v.Platform
+}
+
+func (v *gemVersion) filename(name string) string {
+	return name + "-" + v.fullVersion() + ".gem"
+}
+
+// readGemspec returns the specification from the metadata.gz of a .gem archive
+func readGemspec(content []byte) (*gemspec, error) {
+	archive := tar.NewReader(bytes.NewReader(content))
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("gem has no metadata.gz")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a gem: %w", err)
+		}
+		if header.Name != "metadata.gz" {
+			continue
+		}
+		gz, err := gzip.NewReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := io.ReadAll(io.LimitReader(gz, 10*1024*1024))
+		if err != nil {
+			return nil, err
+		}
+		spec := &gemspec{}
+		err = yaml.Unmarshal(raw, spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gem metadata: %w", err)
+		}
+		if spec.Platform == "" {
+			spec.Platform = "ruby"
+		}
+		if !validName.MatchString(spec.Name) || !validVersion.MatchString(spec.Version.Version) || !validPlatform.MatchString(spec.Platform) {
+			return nil, fmt.Errorf("invalid gem name, version or platform")
+		}
+		return spec, nil
+	}
+}
+
+func versionOf(spec *gemspec, checksum string) *gemVersion {
+	v := &gemVersion{
+		Number:   spec.Version.Version,
+		Platform: spec.Platform,
+		Checksum: checksum,
+		Created:  time.Now().UTC(),
+	}
+	for _, dep := range spec.Dependencies {
+		if dep.Type != ":runtime" {
+			continue
+		}
+		v.Dependencies = append(v.Dependencies, dep.Name+":"+dep.Requirement.String())
+	}
+	// ">= 0" is the default and left out, as rubygems.org does
+	if ruby := spec.RequiredRubyVersion.String(); ruby != ">= 0" {
+		v.Ruby = ruby
+	}
+	if rubygems := spec.RequiredRubygemsVersion.String(); rubygems != ">= 0" {
+		v.Rubygems = rubygems
+	}
+	return v
+}
+
+// formatInfo writes the compact index info file of a gem, yanked versions are left out
+func formatInfo(versions []*gemVersion) []byte {
+	buffer := bytes.Buffer{}
+	buffer.WriteString("---\n")
+	for _, v := range versions {
+		if v.Yanked {
+			continue
+		}
+		requirements := []string{"checksum:" + v.Checksum}
+		if v.Ruby != "" {
+			requirements = append(requirements, "ruby:"+v.Ruby)
+		}
+		if v.Rubygems != "" {
+			requirements = append(requirements, "rubygems:"+v.Rubygems)
+		}
+		fmt.Fprintf(&buffer, "%s %s|%s\n", v.fullVersion(), strings.Join(v.Dependencies, ","), strings.Join(requirements, ","))
+	}
+	return buffer.Bytes()
+}
+
+// versionsLine is the line of a gem in the versions file, empty when every version is yanked
+func versionsLine(name string, versions []*gemVersion, info []byte) string {
+	list := []string{}
+	for _, v := range versions {
+		if !v.Yanked {
+			list = append(list, v.fullVersion())
+		}
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	sum := md5.Sum(info)
+	return name + " " + strings.Join(list, ",") + " " + hex.EncodeToString(sum[:]) + "\n"
+}
@@ -0,0 +1,104 @@
+package rubygems
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+const testMetadata = `--- !ruby/object:Gem::Specification
+name: dstool
+version: !ruby/object:Gem::Version
+  version: 1.2.3
+platform: ruby
+dependencies:
+- !ruby/object:Gem::Dependency
+  name: rack
+  requirement: !ruby/object:Gem::Requirement
+    requirements:
+    - - ">="
+      - !ruby/object:Gem::Version
+        version: '1.0'
+    - - "<"
+      - !ruby/object:Gem::Version
+        version: '3'
+  type: :runtime
+  prerelease: false
+- !ruby/object:Gem::Dependency
+  name: rspec
+  requirement: !ruby/object:Gem::Requirement
+    requirements:
+    - - "~>"
+      - !ruby/object:Gem::Version
+        version: '3.0'
+  type: :development
+required_ruby_version: !ruby/object:Gem::Requirement
+  requirements:
+  - - ">="
+    - !ruby/object:Gem::Version
+      version: 2.7.0
+required_rubygems_version: !ruby/object:Gem::Requirement
+  requirements:
+  - - ">="
+    - !ruby/object:Gem::Version
+      version: '0'
+`
+
+func makeGem(t *testing.T) []byte {
+	metadata := bytes.Buffer{}
+	gz := gzip.NewWriter(&metadata)
+	gz.Write([]byte(testMetadata))
+	gz.Close()
+
+	gem := bytes.Buffer{}
+	archive := tar.NewWriter(&gem)
+	for name, content := range map[string][]byte{"metadata.gz": metadata.Bytes(), "data.tar.gz": nil} {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		archive.Write(content)
+	}
+	archive.Close()
+	return gem.Bytes()
+}
+
+func TestReadGemspec(t *testing.T) {
+	spec, err := readGemspec(makeGem(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := versionOf(spec, "abc")
+	if v.filename(spec.Name) != "dstool-1.2.3.gem" {
+		t.Errorf("unexpected filename %s", v.filename(spec.Name))
+	}
+	info := string(formatInfo([]*gemVersion{v}))
+	if want := "---\n1.2.3 rack:>= 1.0&< 3|checksum:abc,ruby:>= 2.7.0\n"; info != want {
+		t.Errorf("info is %q, want %q", info, want)
+	}
+	if line := versionsLine("dstool", []*gemVersion{v}, []byte(info)); !strings.HasPrefix(line, "dstool 1.2.3 ") {
+		t.Errorf("unexpected versions line %q", line)
+	}
+	v.Yanked = true
+	if line := versionsLine("dstool", []*gemVersion{v}, nil); line != "" {
+		t.Errorf("yanked gem listed as %q", line)
+	}
+}
+
+func TestGemFilename(t *testing.T) {
+	for filename, want := range map[string]string{
+		"dstool-1.2.3.gem":                 "dstool",
+		"ds-tool-1.2.3.gem":                "ds-tool",
+		"nokogiri-1.16.0-x86_64-linux.gem": "nokogiri",
+		"dstool.gem":                       "",
+	} {
+		got := ""
+		if match := gemFilename.FindStringSubmatch(filename); match != nil {
+			got = match[1]
+		}
+		if got != want {
+			t.Errorf("name of %q is %q, want %q", filename, got, want)
+		}
+	}
+}
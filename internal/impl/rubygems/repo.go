@@ -0,0 +1,378 @@
+package rubygems
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type repo struct {
+	handler *repository.Handler
+	lock    sync.Mutex
+	// upstream compact index files
+	upstream *repository.Cache[[]byte]
+}
+
+const (
+	maxGemSize       = 256 * 1024 * 1024
+	upstreamCacheTTL = 5 * time.Minute
+)
+
+func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
+	repo := &repo{
+		upstream: repository.NewCacheMap[[]byte](1000),
+	}
+	var err error
+	repo.handler, err = repository.NewHandler(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo.handler.ErrorFormat = repository.PlainError
+	repo.handler.RegisterCache("index", repo.upstream)
+	repo.handler.Reindex = func(ctx context.Context) error {
+		repo.upstream.Clear()
+		repo.lock.Lock()
+		defer repo.lock.Unlock()
+		return repo.rebuildIndex()
+	}
+
+	return repo, nil
+}
+
+func (repo *repo) IsAllowed(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	return repo.handler.Authorize(w, r, operation, resource)
+}
+
+func specsPath(name string) string {
+	return "specs/" + name + ".json"
+}
+
+func (repo *repo) readVersions(name string) ([]*gemVersion, error) {
+	content, err := repo.handler.ReadLocal(specsPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*gemVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []*gemVersion{}
+	err = json.Unmarshal(content, &versions)
+	return versions, err
+}
+
+// writeVersions stores the versions of a gem and regenerates the compact index
+func (repo *repo) writeVersions(name string, versions []*gemVersion) error {
+	content, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal(specsPath(name), content)
+	if err != nil {
+		return err
+	}
+	err = repo.handler.WriteLocal("info/"+name, formatInfo(versions))
+	if err != nil {
+		return err
+	}
+	return repo.rebuildIndex()
+}
+
+// rebuildIndex regenerates the versions and names files from every gem
+func (repo *repo) rebuildIndex() error {
+	entries, err := fs.ReadDir(repo.handler.Local, "specs")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	versions := bytes.Buffer{}
+	versions.WriteString("created_at: " + time.Now().UTC().Format(time.RFC3339) + "\n---\n")
+	names := bytes.Buffer{}
+	names.WriteString("---\n")
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".json")
+		if !found || !validName.MatchString(name) {
+			continue
+		}
+		gemVersions, err := repo.readVersions(name)
+		if err != nil {
+			return err
+		}
+		line := versionsLine(name, gemVersions, formatInfo(gemVersions))
+		if line == "" {
+			continue
+		}
+		versions.WriteString(line)
+		names.WriteString(name + "\n")
+	}
+	err = repo.handler.WriteLocal("versions", versions.Bytes())
+	if err != nil {
+		return err
+	}
+	return repo.handler.WriteLocal("names", names.Bytes())
+}
+
+// fetchUpstream returns an upstream compact index file, nil without an upstream.
+// It fetches outside the cache lock so a slow upstream only delays the lookups
+// of the file being fetched.
+func (repo *repo) fetchUpstream(ctx context.Context, p string) ([]byte, error) {
+	if repo.handler.Upstream == nil {
+		return nil, nil
+	}
+	if cached, age, hit := repo.upstream.Get(p); hit && age < upstreamCacheTTL {
+		return *cached, nil
+	}
+	content, err := repo.fetchUpstreamFile(ctx, p)
+	var upstreamErr *repository.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		repo.upstream.Purge(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.upstream.Set(p, &content)
+	return content, nil
+}
+
+func (repo *repo) fetchUpstreamFile(ctx context.Context, p string) ([]byte, error) {
+	rawURL := repo.handler.UpstreamURL(p)
+	response, err := repo.handler.FetchUpstream(ctx, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &repository.UpstreamError{URL: rawURL, Status: response.StatusCode}
+	}
+	return io.ReadAll(response.Body)
+}
+
+// body drops the header of a compact index file, everything up to "---"
+func body(content []byte) []byte {
+	if _, after, found := bytes.Cut(content, []byte("---\n")); found {
+		return after
+	}
+	return content
+}
+
+// serveIndex appends the local entries to the upstream file, later lines win
+func (repo *repo) serveIndex(parsed *parsedRequest, file string, w http.ResponseWriter, r *http.Request) {
+	local, err := repo.handler.ReadLocal(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		parsed.logger.Error("index:read", slog.String("target", file), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	upstream, err := repo.fetchUpstream(r.Context(), file)
+	if err != nil {
+		parsed.logger.Warn("upstream:fetch", slog.String("target", file), slog.String("error", err.Error()))
+	}
+	content := local
+	switch {
+	case upstream != nil:
+		content = append(bytes.TrimRight(upstream, "\n"), '\n')
+		content = append(content, body(local)...)
+	case local == nil && file == "versions":
+		content = []byte("created_at: " + time.Now().UTC().Format(time.RFC3339) + "\n---\n")
+	case local == nil:
+		content = []byte("---\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(content)
+}
+
+func (repo *repo) getVersions(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", "versions") {
+		return
+	}
+	repo.serveIndex(parsed, "versions", w, r)
+}
+
+func (repo *repo) getNames(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !repo.IsAllowed(w, r, "list", "names") {
+		return
+	}
+	repo.serveIndex(parsed, "names", w, r)
+}
+
+// isLocal reports whether a gem was ever pushed to this repository
+func (repo *repo) isLocal(ctx context.Context, name string) bool {
+	return repo.handler.LocalFileExists(ctx, specsPath(name))
+}
+
+func (repo *repo) getInfo(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	if !validName.MatchString(parsed.gem) {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	if !repo.IsAllowed(w, r, "list", parsed.gem) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if repo.isLocal(r.Context(), parsed.gem) || repo.handler.Upstream == nil {
+		repo.handler.HandleLocalGet("info/"+parsed.gem, parsed.logger, w, r)
+		return
+	}
+	content, err := repo.fetchUpstream(r.Context(), "info/"+parsed.gem)
+	if err != nil {
+		var upstreamErr *repository.UpstreamError
+		if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+			repo.handler.Fail(w, http.StatusNotFound, "", "")
+			return
+		}
+		parsed.logger.Error("upstream:fetch", slog.String("gem", parsed.gem), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusBadGateway, "", "")
+		return
+	}
+	w.Write(content)
+}
+
+func (repo *repo) getGem(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	match := gemFilename.FindStringSubmatch(parsed.file)
+	if match == nil || !validName.MatchString(match[1]) || strings.Contains(parsed.file, "/") {
+		repo.handler.Fail(w, http.StatusNotFound, "", "")
+		return
+	}
+	name := match[1]
+	if !repo.IsAllowed(w, r, "get", name) {
+		return
+	}
+	target := "gems/" + parsed.file
+	if repo.handler.Upstream != nil && !repo.handler.LocalFileExists(r.Context(), target) && !repo.isLocal(r.Context(), name) {
+		_, err := repo.handler.FetchToLocal(r.Context(), target, repo.handler.UpstreamURL("gems", parsed.file))
+		if err != nil {
+			var upstreamErr *repository.UpstreamError
+			if errors.As(err, &upstreamErr) && upstreamErr.Status == http.StatusNotFound {
+				repo.handler.Fail(w, http.StatusNotFound, "", "")
+				return
+			}
+			parsed.logger.Error("upstream:fetch", slog.String("target", target), slog.String("error", err.Error()))
+			repo.handler.Fail(w, http.StatusBadGateway, "", "")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	repo.handler.HandleLocalGet(target, parsed.logger, w, r)
+}
+
+func (repo *repo) push(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxGemSize))
+	if err != nil {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "could not read gem")
+		return
+	}
+	spec, err := readGemspec(content)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusUnprocessableEntity, "", err.Error())
+		return
+	}
+	if !repo.IsAllowed(w, r, "put", spec.Name) {
+		return
+	}
+	if !repo.handler.Serves(spec.Name) {
+		repo.handler.Fail(w, http.StatusForbidden, "", "gem "+spec.Name+" is not served by this repository")
+		return
+	}
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	v := versionOf(spec, checksum)
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	versions, err := repo.readVersions(spec.Name)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("gem", spec.Name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	for _, existing := range versions {
+		if existing.fullVersion() == v.fullVersion() {
+			repo.handler.Fail(w, http.StatusConflict, "", "Repushing of gem versions is not allowed.")
+			return
+		}
+	}
+	target := "gems/" + v.filename(spec.Name)
+	err = repo.handler.WriteLocal(target, content)
+	if err == nil {
+		err = repo.writeVersions(spec.Name, append(versions, v))
+	}
+	if err != nil {
+		parsed.logger.Error("gem:write", slog.String("target", target), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionPush, target, "sha256:"+checksum, int64(len(content)))
+	w.Write([]byte("Successfully registered gem: " + spec.Name + " (" + v.fullVersion() + ")"))
+}
+
+// yankParameters reads gem_name, version and platform from the query or a form body
+func yankParameters(r *http.Request) url.Values {
+	values := r.URL.Query()
+	if content, err := io.ReadAll(io.LimitReader(r.Body, 64*1024)); err == nil {
+		if form, err := url.ParseQuery(string(content)); err == nil {
+			for key, value := range form {
+				values[key] = value
+			}
+		}
+	}
+	return values
+}
+
+func (repo *repo) yank(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	params := yankParameters(r)
+	name, number, platform := params.Get("gem_name"), params.Get("version"), params.Get("platform")
+	if platform == "" {
+		platform = "ruby"
+	}
+	if !validName.MatchString(name) {
+		repo.handler.Fail(w, http.StatusBadRequest, "", "invalid gem name")
+		return
+	}
+	if !repo.IsAllowed(w, r, "delete", name) {
+		return
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	versions, err := repo.readVersions(name)
+	if err != nil {
+		parsed.logger.Error("index:read", slog.String("gem", name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	var found *gemVersion
+	for _, v := range versions {
+		if v.Number == number && v.Platform == platform && !v.Yanked {
+			found = v
+		}
+	}
+	if found == nil {
+		repo.handler.Fail(w, http.StatusNotFound, "", "The version "+number+" does not exist or is already yanked.")
+		return
+	}
+	found.Yanked = true
+	err = repo.writeVersions(name, versions)
+	if err != nil {
+		parsed.logger.Error("index:write", slog.String("gem", name), slog.String("error", err.Error()))
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "")
+		return
+	}
+	repo.handler.RecordWrite(r, audit.ActionOverwrite, "info/"+name, "", 0)
+	w.Write([]byte("Successfully deleted gem: " + name + " (" + found.fullVersion() + ")"))
+}
@@ -0,0 +1,52 @@
+package rubygems
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestPushAndYankUpdateCompactIndex(t *testing.T) {
+	config := &repository.Config{Name: "rubygems-index", Type: "rubygems", Items: []string{"ds*"}}
+	config.Policies = repotest.PublishPolicies(t, "rubygems", "dstool")
+	client := repotest.NewRepo(t, &Router{}, config, "/rubygems/rubygems-index/")
+
+	gem := makeGem(t)
+	if rec := client.Do("POST", "api/v1/gems", gem, nil); rec.Code != http.StatusOK {
+		t.Fatalf("push = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Do("POST", "api/v1/gems", gem, nil); rec.Code != http.StatusConflict {
+		t.Errorf("second push = %d, want 409", rec.Code)
+	}
+	if rec := client.Get("gems/dstool-1.2.3.gem"); !bytes.Equal(rec.Body.Bytes(), gem) {
+		t.Fatalf("download = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec := client.Get("names"); !strings.Contains(rec.Body.String(), "---\ndstool\n") {
+		t.Errorf("names = %d %q", rec.Code, rec.Body)
+	}
+	if rec := client.Get("versions"); !strings.Contains(rec.Body.String(), "\ndstool 1.2.3 ") {
+		t.Errorf("versions = %d %q", rec.Code, rec.Body)
+	}
+	if rec := client.Get("info/dstool"); !strings.HasPrefix(rec.Body.String(), "---\n1.2.3 rack:") {
+		t.Errorf("info = %d %q", rec.Code, rec.Body)
+	}
+
+	// gem yank names the gem in a form body rather than the url
+	form := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	if rec := client.Do("DELETE", "api/v1/gems/yank", []byte("gem_name=other&version=1.0"), form); rec.Code != http.StatusForbidden {
+		t.Errorf("yank of another gem = %d, want 403", rec.Code)
+	}
+	if rec := client.Do("DELETE", "api/v1/gems/yank", []byte("gem_name=dstool&version=1.2.3"), form); rec.Code != http.StatusOK {
+		t.Fatalf("yank = %d %s", rec.Code, rec.Body)
+	}
+	if rec := client.Get("info/dstool"); strings.Contains(rec.Body.String(), "1.2.3") {
+		t.Errorf("info lists a yanked version: %q", rec.Body)
+	}
+	if rec := client.Do("DELETE", "api/v1/gems/yank", []byte("gem_name=dstool&version=1.2.3"), form); rec.Code != http.StatusNotFound {
+		t.Errorf("second yank = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package rubygems
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+type Router struct {
+	repos map[string]*repo
+}
+
+// plainError answers requests that fail before a repository is selected
+var plainError = repository.ErrorFormat(repository.PlainError)
+
+type parsedRequest struct {
+	gem    string
+	file   string
+	repo   *repo
+	logger slog.Logger
+}
+
+func init() {
+	repository.RegisterRouter("rubygems", &Router{})
+}
+
+/*
+GET    /rubygems/<repo>/versions
+GET    /rubygems/<repo>/names
+GET    /rubygems/<repo>/info/<gem>
+GET    /rubygems/<repo>/gems/<gem>-<version>[-<platform>].gem
+POST   /rubygems/<repo>/api/v1/gems           (gem push)
+DELETE /rubygems/<repo>/api/v1/gems/yank      (gem yank, gem_name, version and platform parameters)
+
+A Gemfile uses source "<base>/rubygems/<repo>". With an upstream such as
+https://rubygems.org gems that were never pushed locally are proxied, a
+locally pushed gem always hides the upstream gem of the same name.
+*/
+
+func (router *Router) NewRepo(ctx context.Context, config *repository.Config) error {
+	if router.repos == nil {
+		router.repos = make(map[string]*repo)
+	}
+	repo, err := newRepo(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.repos[config.Name] = repo
+	return nil
+}
+
+func (router *Router) ParseRequest(w http.ResponseWriter, r *http.Request) *parsedRequest {
+	parsed := &parsedRequest{
+		gem:  r.PathValue("gem"),
+		file: r.PathValue("file"),
+	}
+	parsed.repo = router.repos[r.PathValue("repo")]
+	if parsed.repo == nil {
+		plainError.Fail(w, http.StatusNotFound, "", "")
+		return nil
+	}
+	if err := repository.ValidateSegments(r, "gem", "file"); err != nil {
+		plainError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return nil
+	}
+	parsed.logger = repository.RequestLogger(r)
+	return parsed
+}
+
+func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if len(router.repos) == 0 {
+		return nil
+	}
+	aMux.HandleFunc("GET /rubygems/{repo}/versions", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getVersions(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /rubygems/{repo}/names", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getNames(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /rubygems/{repo}/info/{gem}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getInfo(parsed, w, r)
+	})
+	aMux.HandleFunc("GET /rubygems/{repo}/gems/{file}", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.getGem(parsed, w, r)
+	})
+	aMux.HandleFunc("POST /rubygems/{repo}/api/v1/gems", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.push(parsed, w, r)
+	})
+	aMux.HandleFunc("DELETE /rubygems/{repo}/api/v1/gems/yank", func(w http.ResponseWriter, r *http.Request) {
+		parsed := router.ParseRequest(w, r)
+		if parsed == nil {
+			return
+		}
+		parsed.repo.yank(parsed, w, r)
+	})
+	return nil
+}
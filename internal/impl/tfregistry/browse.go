@@ -0,0 +1,65 @@
+package tfregistry
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// browse lists namespace/provider pairs at the top level and the versions
+// with their platforms below a provider
+func (repo *repo) browse(ctx context.Context, p string) ([]repository.BrowseEntry, error) {
+	if p == "" {
+		return repo.browseProviders()
+	}
+	namespace, providerName, _ := strings.Cut(p, "/")
+	index, err := repo.buildIndex(ctx, namespace, providerName)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]repository.BrowseEntry, 0, len(index.Versions))
+	for _, version := range index.Versions {
+		platforms := make([]string, 0, len(version.Platforms))
+		for _, platform := range version.Platforms {
+			platforms = append(platforms, platform.OS+"/"+platform.Arch)
+		}
+		info := strings.Join(platforms, ", ")
+		if len(version.Protocols) > 0 {
+			info += " (protocols " + strings.Join(version.Protocols, ", ") + ")"
+		}
+		list = append(list, repository.BrowseEntry{
+			Name:     version.Version,
+			Resource: p,
+			Info:     info,
+		})
+	}
+	return list, nil
+}
+
+func (repo *repo) browseProviders() ([]repository.BrowseEntry, error) {
+	namespaces, err := fs.ReadDir(repo.handler.Local, ".")
+	if err != nil {
+		return nil, err
+	}
+	list := []repository.BrowseEntry{}
+	for _, namespace := range namespaces {
+		if !namespace.IsDir() || namespace.Name() == repository.ChecksumDir {
+			continue
+		}
+		providers, err := fs.ReadDir(repo.handler.Local, namespace.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, provider := range providers {
+			if !provider.IsDir() {
+				continue
+			}
+			p := path.Join(namespace.Name(), provider.Name())
+			list = append(list, repository.BrowseEntry{Name: p, Path: p, Resource: p})
+		}
+	}
+	return list, nil
+}
@@ -4,7 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 
-	"github.com/davidjspooner/dshttp/pkg/httphandler"
+	"github.com/davidjspooner/dsrepo/internal/repository"
 )
 
 type parsedRequest struct {
@@ -22,10 +22,7 @@ func NewParsedRequest(r *http.Request) *parsedRequest {
 		namespace:    r.PathValue("namespace"),
 		providerName: r.PathValue("provider"),
 	}
-	obs, _ := httphandler.GetObservation(r)
-	if obs != nil {
-		pr.logger = obs.Logger
-	}
+	pr.logger = repository.RequestLogger(r)
 	return pr
 }
 
@@ -34,3 +31,26 @@ func (pr *parsedRequest) ParseVersionOSArch(r *http.Request) {
 	pr.os = r.PathValue("os")
 	pr.arch = r.PathValue("arch")
 }
+
+// validate checks the path values of a request before they are joined into
+// store paths
+func (pr *parsedRequest) validate(w http.ResponseWriter) bool {
+	err := repository.ValidateSegment("namespace", pr.namespace)
+	if err == nil {
+		err = repository.ValidateSegment("provider", pr.providerName)
+	}
+	if err == nil && pr.version != "" {
+		err = repository.ValidateSemver(pr.version)
+	}
+	if err == nil && (pr.os != "" || pr.arch != "") {
+		err = repository.ValidatePlatform(pr.os, pr.arch)
+	}
+	if err != nil {
+		terraformError.Fail(w, http.StatusBadRequest, "", err.Error())
+		return false
+	}
+	return true
+}
+
+// terraformError answers requests that fail before a repository is selected
+var terraformError = repository.ErrorFormat(repository.TerraformError)
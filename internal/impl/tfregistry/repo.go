@@ -6,15 +6,15 @@ import (
 	"io/fs"
 	"net/http"
 	"path"
-	"slices"
 	"strings"
 
 	"github.com/davidjspooner/dsrepo/internal/repository"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type repo struct {
 	handler *repository.Handler
-	order   int
+	virtual *repository.Virtual[*repo]
 }
 
 func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
@@ -24,28 +24,40 @@ func newRepo(ctx context.Context, config *repository.Config) (*repo, error) {
 	if err != nil {
 		return nil, err
 	}
+	repo.handler.Browse = repo.browse
+	repo.handler.ErrorFormat = repository.TerraformError
 
 	return repo, nil
 }
 
 func (repo *repo) IsAllowed(parsed *parsedRequest, w http.ResponseWriter, r *http.Request, operation string) bool {
-	//TODO: check permissions
-	return true
+	return repo.handler.Authorize(w, r, operation, path.Join(parsed.namespace, parsed.providerName))
 }
 
-var allowedArchs = []string{"amd64", "arm", "arm64", "386", "ppc64le", "s390x", "mips64", "mips64le", "riscv64"}
-var allowedOSs = []string{"darwin", "linux", "windows", "freebsd", "openbsd", "netbsd", "solaris", "dragonfly", "plan9", "aix", "zos"}
-
 func (repo *repo) HandleProviderVersions(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
 	if !repo.IsAllowed(parsed, w, r, "list") {
 		return
 	}
 
-	//read the filesystem to get the versions, os and archs
+	index, err := repo.buildIndex(r.Context(), parsed.namespace, parsed.providerName)
+	if err != nil {
+		repo.handler.Fail(w, http.StatusInternalServerError, "", "could not walk")
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index)
+}
+
+// buildIndex reads the filesystem to get the versions, os and archs. The index
+// is not cached: a provider has few enough files to walk on every request, and
+// a cached index went stale for every other server writing to the same store.
+// The admin api therefore lists no caches for terraform repositories.
+func (repo *repo) buildIndex(ctx context.Context, namespace, providerName string) (*Index, error) {
 	index := Index{}
 
-	target := path.Join(parsed.namespace, parsed.providerName) + "/"
+	target := path.Join(namespace, providerName) + "/"
+	_, span := repository.StartSpan(ctx, "store.walk", attribute.String("store.target", target))
 	err := fs.WalkDir(repo.handler.Local, target, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -56,7 +68,7 @@ func (repo *repo) HandleProviderVersions(parsed *parsedRequest, w http.ResponseW
 			arch = strings.TrimSuffix(arch, ".json")
 			os := parts[len(parts)-2]
 			version := parts[len(parts)-3]
-			if slices.Contains(allowedArchs, arch) && slices.Contains(allowedOSs, os) {
+			if repository.ValidatePlatform(os, arch) == nil {
 				_ = version
 
 				found := false
@@ -97,13 +109,11 @@ func (repo *repo) HandleProviderVersions(parsed *parsedRequest, w http.ResponseW
 		}
 		return nil
 	})
+	repository.EndSpan(span, err)
 	if err != nil {
-		http.Error(w, "could not walk", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(index)
+	return &index, nil
 }
 
 func (repo *repo) Download(parsed *parsedRequest, w http.ResponseWriter, r *http.Request) {
@@ -6,32 +6,37 @@ import (
 	"net/http"
 
 	"github.com/davidjspooner/dshttp/pkg/mux"
-	"github.com/davidjspooner/dsmatch/pkg/matcher"
 	"github.com/davidjspooner/dsrepo/internal/repository"
 )
 
 type Router struct {
-	repos matcher.Tree[*repo]
-	count int
+	routes   repository.Routes[*repo]
+	named    map[string]*repo
+	virtuals []*repo
 }
 
 func init() {
-	repository.RegisterRouter("tfregistry", &Router{})
+	repository.RegisterRouter("tfregistry", &Router{named: make(map[string]*repo)})
 }
 
 func (router *Router) lookupRepo(w http.ResponseWriter, parsed *parsedRequest) *repo {
+	if !parsed.validate(w) {
+		return nil
+	}
 	path := parsed.namespace + "/" + parsed.providerName
-	leaves := router.repos.FindLeaves([]byte(path))
-	if len(leaves) == 0 {
+	route := router.routes.Select(path, &parsed.logger)
+	if route == nil {
 		parsed.logger.Error("repo not found", slog.String("namespace", parsed.namespace), slog.String("name", parsed.providerName))
-		w.WriteHeader(http.StatusNotFound)
+		terraformError.Fail(w, http.StatusNotFound, "", "provider "+path+" not found")
 		return nil
 	}
-	repo := leaves[0].Payload
-	return repo
+	return route.Repo
 }
 
 func (router *Router) SetupRoutes(aMux mux.Mux) error {
+	if err := router.resolveVirtuals(); err != nil {
+		return err
+	}
 	aMux.HandleFunc("GET /.well-known/terraform.json", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"providers.v1":"/tfregistry/providers/v1/"}`))
@@ -42,36 +47,35 @@ func (router *Router) SetupRoutes(aMux mux.Mux) error {
 		if repo == nil {
 			return
 		}
-		parsed.ParseVersionOSArch(r)
-		repo.HandleProviderVersions(parsed, w, r)
+		repo.providerVersions(parsed, w, r)
 	})
 
 	aMux.HandleFunc("GET /tfregistry/providers/v1/{namespace}/{provider}/{version}/download/{os}/{arch}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := NewParsedRequest(r)
-		repo := router.lookupRepo(w, parsed)
-		if repo == nil {
+		parsed.ParseVersionOSArch(r)
+		found := router.lookupRepo(w, parsed)
+		if found == nil {
 			return
 		}
-		parsed.ParseVersionOSArch(r)
-		repo.Download(parsed, w, r)
+		found.read(parsed, w, r, "get", (*repo).Download)
 	})
 	aMux.HandleFunc("PUT /tfregistry/providers/v1/{namespace}/{provider}/{version}/download/{os}/{arch}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := NewParsedRequest(r)
-		repo := router.lookupRepo(w, parsed)
-		if repo == nil {
+		parsed.ParseVersionOSArch(r)
+		found := router.lookupRepo(w, parsed)
+		if found == nil {
 			return
 		}
-		parsed.ParseVersionOSArch(r)
-		repo.Upload(parsed, w, r)
+		found.write(parsed, w, r, "put", (*repo).Upload)
 	})
 	aMux.HandleFunc("DELETE /tfregistry/providers/v1/{namespace}/{provider}/{version}/download/{os}/{arch}", func(w http.ResponseWriter, r *http.Request) {
 		parsed := NewParsedRequest(r)
-		repo := router.lookupRepo(w, parsed)
-		if repo == nil {
+		parsed.ParseVersionOSArch(r)
+		found := router.lookupRepo(w, parsed)
+		if found == nil {
 			return
 		}
-		parsed.ParseVersionOSArch(r)
-		repo.Delete(parsed, w, r)
+		found.write(parsed, w, r, "delete", (*repo).Delete)
 	})
 	return nil
 }
@@ -81,19 +85,15 @@ func (router *Router) NewRepo(ctx context.Context, config *repository.Config) er
 	if err != nil {
 		return err
 	}
-	router.count++
-	repo.order = router.count
-	for _, item := range config.Items {
-		seq, err := repository.NewGlob([]byte(item), '/')
-		if err != nil {
-			return err
-		}
-		leaf, err := router.repos.Add(seq)
-		if err != nil {
-			return err
-		}
-		leaf.Payload = repo
-	}
+	router.named[config.Name] = repo
+	return router.routes.Add(config, repo)
+}
 
-	return nil
+func (router *Router) NewVirtual(ctx context.Context, config *repository.Config) error {
+	repo, err := newVirtual(ctx, config)
+	if err != nil {
+		return err
+	}
+	router.virtuals = append(router.virtuals, repo)
+	return router.routes.Add(config, repo)
 }
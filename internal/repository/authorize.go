@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/davidjspooner/dshttp/pkg/httphandler"
+	"github.com/davidjspooner/dsrepo/internal/access"
+	"github.com/davidjspooner/dsrepo/internal/audit"
+)
+
+// RequestIdentity returns the user name a request claims and its source address.
+// The BasicAuth password is not checked, so the name is only ever recorded as claimed.
+func RequestIdentity(r *http.Request) (user, remote string) {
+	user = "anonymous"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	remote = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remote = host
+	}
+	return user, remote
+}
+
+// RequestLogger is the logger of the request observation. Requests served
+// without an observer log to the default logger, as a zero slog.Logger panics.
+func RequestLogger(r *http.Request) slog.Logger {
+	obs, _ := httphandler.GetObservation(r)
+	if obs == nil || obs.Logger.Handler() == nil {
+		return *slog.Default()
+	}
+	return obs.Logger
+}
+
+// Check evaluates the repository policies for "<type>:<operation>" on "<type>:<resource>".
+// Repositories without policies allow everything.
+func (handler *Handler) Check(operation, resource string) (allowed bool, reason access.PolicyName) {
+	if len(handler.Policies) == 0 {
+		return true, ""
+	}
+	return handler.Policies.Allow(handler.Type+":"+strings.ToLower(operation), handler.Type+":"+resource)
+}
+
+// userRoles links the roles of a repository to its policies and returns the
+// role of each configured user
+func userRoles(config *Config) (map[UserAlias]*access.Role, error) {
+	if len(config.Users) == 0 {
+		return nil, nil
+	}
+	err := access.CrossLink(config.Roles, config.Policies)
+	if err != nil {
+		return nil, fmt.Errorf("repository %q: %w", config.Name, err)
+	}
+	roles := make(map[UserAlias]*access.Role, len(config.Users))
+	for user, name := range config.Users {
+		index := slices.IndexFunc(config.Roles, func(role *access.Role) bool { return role.Name == name })
+		if index < 0 {
+			return nil, fmt.Errorf("repository %q: user %q has unknown role %q", config.Name, user, name)
+		}
+		roles[user] = config.Roles[index]
+	}
+	return roles, nil
+}
+
+// Allowed is the policy decision for a request. Every caller is held to the
+// repository policies, and a user listed in the repository config also to the
+// policies of its role. The claimed name is not verified, so a role can only
+// narrow what the repository policies allow. Anything that filters what a
+// caller may see must decide through here as Authorize does.
+func (handler *Handler) Allowed(r *http.Request, operation, resource string) (allowed bool, reason access.PolicyName) {
+	allowed, reason = handler.Check(operation, resource)
+	if !allowed {
+		return allowed, reason
+	}
+	user, _ := RequestIdentity(r)
+	role := handler.roles[UserAlias(user)]
+	if role == nil {
+		return allowed, reason
+	}
+	return role.Allow(handler.Type+":"+strings.ToLower(operation), handler.Type+":"+resource)
+}
+
+// Authorize is Allowed with an audit record. A denied request is answered with 403.
+func (handler *Handler) Authorize(w http.ResponseWriter, r *http.Request, operation, resource string) bool {
+	operation = strings.ToLower(operation)
+	allowed, reason := handler.Allowed(r, operation, resource)
+
+	event := handler.newEvent(r, audit.ActionAccess, resource)
+	event.Operation = operation
+	event.Allowed = allowed
+	event.Policy = reason
+	audit.Record(r.Context(), event)
+
+	if !allowed {
+		handler.Fail(w, http.StatusForbidden, "", operation+" of "+resource+" denied")
+	}
+	return allowed
+}
+
+func (handler *Handler) newEvent(r *http.Request, action audit.Action, target string) *audit.Event {
+	user, remote := RequestIdentity(r)
+	return &audit.Event{
+		Action:      action,
+		Repository:  handler.Name,
+		Type:        handler.Type,
+		Target:      target,
+		ClaimedUser: user,
+		Remote:      remote,
+		Allowed:     true,
+	}
+}
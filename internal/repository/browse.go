@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"time"
+)
+
+type BrowseEntry struct {
+	Name     string
+	Path     string // where to browse next, empty for leaves
+	Resource string // checked against the "list" policies
+	Size     int64
+	ModTime  time.Time
+	Info     string
+}
+
+// Browser lists the contents of a repository below p for the web ui
+type Browser func(ctx context.Context, p string) ([]BrowseEntry, error)
+
+func (handler *Handler) List(ctx context.Context, p string) ([]BrowseEntry, error) {
+	if handler.Browse != nil {
+		return handler.Browse(ctx, p)
+	}
+	return handler.BrowseStore(ctx, p)
+}
+
+// BrowseStore lists a directory of the local store
+func (handler *Handler) BrowseStore(ctx context.Context, p string) ([]BrowseEntry, error) {
+	_, span := StartSpan(ctx, "store.list")
+	dir := p
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := fs.ReadDir(handler.Local, dir)
+	EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]BrowseEntry, 0, len(entries))
+	for _, entry := range entries {
+		if p == "" && entry.Name() == ChecksumDir {
+			continue
+		}
+		full := path.Join(p, entry.Name())
+		be := BrowseEntry{
+			Name:     entry.Name(),
+			Resource: full,
+		}
+		if entry.IsDir() {
+			be.Path = full
+		} else if info, err := entry.Info(); err == nil {
+			be.Size = info.Size()
+			be.ModTime = info.ModTime()
+		}
+		list = append(list, be)
+	}
+	return list, nil
+}
@@ -55,12 +55,46 @@ func (c *Cache[T]) Use(key string, refreshFunc RefreshFunc[T]) {
 	}
 }
 
+// Get returns the cached value of key and its age without refreshing it, so a
+// caller can fetch a replacement without holding the cache lock
+func (c *Cache[T]) Get(key string) (value *T, age time.Duration, hit bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, hit := c.entries[key]
+	if !hit {
+		return nil, 0, false
+	}
+	return entry.value, time.Since(entry.modified), true
+}
+
+// Set stores a freshly fetched value of key
+func (c *Cache[T]) Set(key string, value *T) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = cacheEntry[T]{key: key, value: value, modified: time.Now()}
+	if len(c.entries) > c.MaxCount {
+		c.prune()
+	}
+}
+
 func (c *Cache[T]) Count() int {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	return len(c.entries)
 }
 
+func (c *Cache[T]) Purge(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *Cache[T]) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	clear(c.entries)
+}
+
 func (c *Cache[T]) Prune() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
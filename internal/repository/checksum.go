@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ChecksumDir holds the checksums of the files stored by HandleLocalPut, it
+// mirrors the layout of the store and is left out of listings
+const ChecksumDir = ".checksums"
+
+// Checksums are computed for every file stored by HandleLocalPut
+type Checksums struct {
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+}
+
+func NewChecksums(content []byte) *Checksums {
+	md5sum := md5.Sum(content)
+	sha256sum := sha256.Sum256(content)
+	sha512sum := sha512.Sum512(content)
+	return &Checksums{
+		Size:   int64(len(content)),
+		MD5:    hex.EncodeToString(md5sum[:]),
+		SHA256: hex.EncodeToString(sha256sum[:]),
+		SHA512: hex.EncodeToString(sha512sum[:]),
+	}
+}
+
+// Get returns the hex checksum for an algorithm of ExpectedChecksums
+func (sums *Checksums) Get(algorithm string) string {
+	switch algorithm {
+	case "md5":
+		return sums.MD5
+	case "sha256":
+		return sums.SHA256
+	case "sha512":
+		return sums.SHA512
+	}
+	return ""
+}
+
+func checksumPath(target string) string {
+	return ChecksumDir + "/" + target + ".json"
+}
+
+// ReadChecksums returns the checksums stored with target
+func (handler *Handler) ReadChecksums(target string) (*Checksums, error) {
+	content, err := handler.ReadLocal(checksumPath(target))
+	if err != nil {
+		return nil, err
+	}
+	sums := &Checksums{}
+	err = json.Unmarshal(content, sums)
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// Checksums returns the checksums stored with target, files stored before
+// checksums were kept have theirs computed from the content
+func (handler *Handler) Checksums(target string) (*Checksums, error) {
+	sums, err := handler.ReadChecksums(target)
+	if err == nil {
+		return sums, nil
+	}
+	content, err := handler.ReadLocal(target)
+	if err != nil {
+		return nil, err
+	}
+	return NewChecksums(content), nil
+}
+
+func (handler *Handler) writeChecksums(target string, sums *Checksums) error {
+	content, err := json.Marshal(sums)
+	if err != nil {
+		return err
+	}
+	return handler.WriteLocal(checksumPath(target), content)
+}
+
+// ExpectedChecksum is a checksum a client sent with an upload
+type ExpectedChecksum struct {
+	Header    string
+	Algorithm string // md5, sha256 or sha512
+	Hex       string
+}
+
+var digestAlgorithms = map[string]string{
+	"md5":     "md5",
+	"sha-256": "sha256",
+	"sha-512": "sha512",
+}
+
+// ExpectedChecksums collects the checksums of an upload from Content-Digest
+// (RFC 9530), Digest (RFC 3230) and X-Checksum-Md5, -Sha256 and -Sha512
+// headers. Algorithms that are not stored are ignored.
+func ExpectedChecksums(header http.Header) ([]ExpectedChecksum, error) {
+	var expected []ExpectedChecksum
+	for _, name := range []string{"Content-Digest", "Digest"} {
+		for _, value := range header.Values(name) {
+			for _, member := range strings.Split(value, ",") {
+				algorithm, encoded, _ := strings.Cut(strings.TrimSpace(member), "=")
+				algorithm, ok := digestAlgorithms[strings.ToLower(algorithm)]
+				if !ok {
+					continue
+				}
+				encoded, _, _ = strings.Cut(encoded, ";")
+				if name == "Content-Digest" {
+					trimmed, found := strings.CutPrefix(encoded, ":")
+					trimmed, closed := strings.CutSuffix(trimmed, ":")
+					if !found || !closed {
+						return nil, &InvalidError{Field: name, Value: value, Reason: "digest is not a byte sequence"}
+					}
+					encoded = trimmed
+				}
+				raw, err := base64.StdEncoding.DecodeString(encoded)
+				if err != nil {
+					return nil, &InvalidError{Field: name, Value: value, Reason: "digest is not base64"}
+				}
+				expected = append(expected, ExpectedChecksum{Header: name, Algorithm: algorithm, Hex: hex.EncodeToString(raw)})
+			}
+		}
+	}
+	for _, algorithm := range []string{"md5", "sha256", "sha512"} {
+		name := "X-Checksum-" + strings.ToUpper(algorithm[:1]) + algorithm[1:]
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(value); err != nil {
+			return nil, &InvalidError{Field: name, Value: value, Reason: "checksum is not hex"}
+		}
+		expected = append(expected, ExpectedChecksum{Header: name, Algorithm: algorithm, Hex: strings.ToLower(value)})
+	}
+	return expected, nil
+}
+
+// Verify checks the content against every checksum the client sent
+func (sums *Checksums) Verify(expected []ExpectedChecksum) error {
+	for _, e := range expected {
+		if sums.Get(e.Algorithm) != e.Hex {
+			return fmt.Errorf("%s checksum from %s does not match the content", e.Algorithm, e.Header)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestExpectedChecksums(t *testing.T) {
+	sums := NewChecksums([]byte("hello"))
+	b64 := func(h string) string {
+		raw, _ := hex.DecodeString(h)
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	tests := []struct {
+		header  http.Header
+		count   int
+		invalid bool
+		verify  bool
+	}{
+		{header: http.Header{}, count: 0, verify: true},
+		{header: http.Header{"Content-Digest": {"sha-256=:" + b64(sums.SHA256) + ":"}}, count: 1, verify: true},
+		{header: http.Header{"Content-Digest": {"sha-512=:" + b64(sums.SHA512) + ":, sha-256=:" + b64(sums.SHA256) + ":"}}, count: 2, verify: true},
+		{header: http.Header{"Content-Digest": {"sha-256=" + b64(sums.SHA256)}}, invalid: true},
+		{header: http.Header{"Digest": {"SHA-256=" + b64(sums.SHA256) + ",MD5=" + b64(sums.MD5)}}, count: 2, verify: true},
+		{header: http.Header{"Digest": {"SHA=" + b64(sums.SHA256)}}, count: 0, verify: true},
+		{header: http.Header{"Digest": {"SHA-256=" + b64(sums.SHA512)}}, count: 1, verify: false},
+		{header: http.Header{"X-Checksum-Sha256": {sums.SHA256}}, count: 1, verify: true},
+		{header: http.Header{"X-Checksum-Sha512": {sums.SHA256}}, count: 1, verify: false},
+		{header: http.Header{"X-Checksum-Md5": {"not hex"}}, invalid: true},
+	}
+	for _, test := range tests {
+		expected, err := ExpectedChecksums(test.header)
+		if test.invalid {
+			if _, ok := err.(*InvalidError); !ok {
+				t.Errorf("%v: expected an InvalidError, got %v", test.header, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.header, err)
+			continue
+		}
+		if len(expected) != test.count {
+			t.Errorf("%v: %d checksums, want %d", test.header, len(expected), test.count)
+		}
+		if err := sums.Verify(expected); (err == nil) != test.verify {
+			t.Errorf("%v: verify returned %v", test.header, err)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package repository
 
-import "github.com/davidjspooner/dsrepo/internal/access"
+import (
+	"time"
+
+	"github.com/davidjspooner/dsrepo/internal/access"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+)
 
 type UserAlias string
 
@@ -16,9 +22,35 @@ type Config struct {
 		Url        string    `yaml:"url"`
 		Credential UserAlias `yaml:"credential"`
 	} `yaml:"upstream"`
-	Policies access.PolicyList             `yaml:"policies"`
-	Roles    access.RoleList               `yaml:"roles"`
-	Users    map[UserAlias]access.RoleName `yaml:"users"`
+	// container repositories whose OCI charts a helm repository also serves
+	Containers []string                      `yaml:"containers"`
+	Signing    signing.Config                `yaml:"signing"`
+	Webhooks   []webhook.Config              `yaml:"webhooks"`
+	Policies   access.PolicyList             `yaml:"policies"`
+	Roles      access.RoleList               `yaml:"roles"`
+	Users      map[UserAlias]access.RoleName `yaml:"users"`
+	// upstream path rewrites and cache lifetimes of a proxy repository
+	Rewrites []Rewrite `yaml:"rewrites"`
+	Cache    CacheTTL  `yaml:"cache"`
+	// members of a virtual repository in the order reads search them, and the
+	// member that receives writes
+	Members []string `yaml:"members"`
+	Deploy  string   `yaml:"deploy"`
+	// decides between repositories of one type whose items overlap, higher wins
+	Priority int `yaml:"priority"`
+}
+
+// Rewrite replaces a regular expression match in the requested path, the
+// result may be a path below the upstream url or an absolute url
+type Rewrite struct {
+	Match   string `yaml:"match"`
+	Replace string `yaml:"replace"`
+}
+
+// CacheTTL clamps the lifetime upstream Cache-Control headers give a response
+type CacheTTL struct {
+	MinTTL time.Duration `yaml:"minttl"`
+	MaxTTL time.Duration `yaml:"maxttl"`
 }
 
 type Credential struct {
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error is a failed request in protocol neutral terms. Code is optional, a
+// repository type that has error codes uses it or derives one from Status.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorFormat writes an Error as the error body a protocol's clients understand
+type ErrorFormat func(w http.ResponseWriter, e *Error)
+
+// Write answers a request with e in format, plain text if format is nil
+func (e *Error) Write(w http.ResponseWriter, format ErrorFormat) {
+	if format == nil {
+		format = PlainError
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(e.Status)
+	}
+	format(w, e)
+}
+
+// Fail answers a request with an error in format, for routers that fail a
+// request before a repository is known
+func (format ErrorFormat) Fail(w http.ResponseWriter, status int, code, message string) {
+	(&Error{Status: status, Code: code, Message: message}).Write(w, format)
+}
+
+// Fail answers a request with an error in the format of the repository type
+func (handler *Handler) Fail(w http.ResponseWriter, status int, code, message string) {
+	handler.ErrorFormat.Fail(w, status, code, message)
+}
+
+// PlainError writes the message as text/plain
+func PlainError(w http.ResponseWriter, e *Error) {
+	http.Error(w, e.Message, e.Status)
+}
+
+func writeErrorJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// JSONError writes {"error":"message","code":"CODE"}, the shape npm and helm
+// clients print and the one binary repositories use
+func JSONError(w http.ResponseWriter, e *Error) {
+	writeErrorJSON(w, e.Status, struct {
+		Error string `json:"error"`
+		Code  string `json:"code,omitempty"`
+	}{Error: e.Message, Code: e.Code})
+}
+
+// TerraformError writes the {"errors":["message"]} body of the terraform registry protocols
+func TerraformError(w http.ResponseWriter, e *Error) {
+	writeErrorJSON(w, e.Status, map[string][]string{"errors": {e.Message}})
+}
+
+// OCIError writes the error body of the OCI distribution spec, an error
+// without a code gets the closest code for its status
+func OCIError(w http.ResponseWriter, e *Error) {
+	code := e.Code
+	if code == "" {
+		code = ociCodes[e.Status]
+	}
+	if code == "" {
+		code = "UNKNOWN"
+	}
+	writeErrorJSON(w, e.Status, map[string]any{
+		"errors": []map[string]string{{"code": code, "message": e.Message}},
+	})
+}
+
+var ociCodes = map[int]string{
+	http.StatusBadRequest:            "UNSUPPORTED",
+	http.StatusUnauthorized:          "UNAUTHORIZED",
+	http.StatusForbidden:             "DENIED",
+	http.StatusNotFound:              "NAME_UNKNOWN",
+	http.StatusMethodNotAllowed:      "UNSUPPORTED",
+	http.StatusRequestEntityTooLarge: "SIZE_INVALID",
+	http.StatusTooManyRequests:       "TOOMANYREQUESTS",
+	http.StatusNotImplemented:        "UNSUPPORTED",
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorFormats(t *testing.T) {
+	tests := []struct {
+		format      ErrorFormat
+		status      int
+		code        string
+		message     string
+		contentType string
+		body        string
+	}{
+		{
+			format:      OCIError,
+			status:      http.StatusNotFound,
+			code:        "BLOB_UNKNOWN",
+			message:     "blob unknown to registry",
+			contentType: "application/json",
+			body:        `{"errors":[{"code":"BLOB_UNKNOWN","message":"blob unknown to registry"}]}`,
+		},
+		{
+			format:      OCIError,
+			status:      http.StatusForbidden,
+			message:     "push denied",
+			contentType: "application/json",
+			body:        `{"errors":[{"code":"DENIED","message":"push denied"}]}`,
+		},
+		{
+			format:      OCIError,
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"errors":[{"code":"UNKNOWN","message":"Internal Server Error"}]}`,
+		},
+		{
+			format:      TerraformError,
+			status:      http.StatusNotFound,
+			message:     "provider not found",
+			contentType: "application/json",
+			body:        `{"errors":["provider not found"]}`,
+		},
+		{
+			format:      JSONError,
+			status:      http.StatusBadRequest,
+			message:     "bad path",
+			contentType: "application/json",
+			body:        `{"error":"bad path"}`,
+		},
+		{
+			format:      nil,
+			status:      http.StatusNotFound,
+			message:     "missing",
+			contentType: "text/plain; charset=utf-8",
+			body:        "missing",
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		test.format.Fail(w, test.status, test.code, test.message)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.body, w.Code, test.status)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: content type %q, want %q", test.body, got, test.contentType)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != test.body {
+			t.Errorf("body %s, want %s", got, test.body)
+		}
+	}
+}
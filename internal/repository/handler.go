@@ -3,31 +3,78 @@ package repository
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/davidjspooner/dsfile/pkg/store"
+	"github.com/davidjspooner/dsrepo/internal/access"
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Handler struct {
+	Name     string
+	Type     string
+	Config   *Config
 	Local    store.Interface
 	Upstream *url.URL
+	Policies access.PolicyList
+	Webhooks *webhook.Dispatcher
+	Caches   map[string]AdminCache
+
+	// optional maintenance actions offered through the admin api
+	CollectGarbage func(ctx context.Context) (removed int, err error)
+	Reindex        func(ctx context.Context) error
+
+	// optional type specific listing for the web ui, defaults to BrowseStore
+	Browse Browser
+
+	// the error body of the protocol, defaults to PlainError
+	ErrorFormat ErrorFormat
+
+	items Routes[*Handler]
+	roles map[UserAlias]*access.Role
 }
 
+// MountStore mounts the local store of a repository, tests swap in an in
+// memory store
+var MountStore = store.Mount
+
 func NewHandler(ctx context.Context, config *Config) (*Handler, error) {
-	handler := &Handler{}
-	var err error
-	handler.Local, err = store.Mount(ctx, config.Local.Path, config.Local.Arguments)
+	handler := &Handler{
+		Name:     config.Name,
+		Type:     config.Type,
+		Config:   config,
+		Policies: config.Policies,
+	}
+	err := handler.items.Add(config, handler)
 	if err != nil {
 		return nil, err
 	}
+	handler.roles, err = userRoles(config)
+	if err != nil {
+		return nil, err
+	}
+	handler.Webhooks, err = webhook.NewDispatcher(config.Webhooks)
+	if err != nil {
+		return nil, err
+	}
+	//virtual repositories have no content of their own
+	if len(config.Members) == 0 {
+		handler.Local, err = MountStore(ctx, config.Local.Path, config.Local.Arguments)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if config.Upstream.Url != "" {
 		handler.Upstream, err = url.Parse(config.Upstream.Url)
@@ -36,18 +83,33 @@ func NewHandler(ctx context.Context, config *Config) (*Handler, error) {
 		}
 	}
 
+	err = registerHandler(handler)
+	if err != nil {
+		return nil, err
+	}
 	return handler, nil
 }
 
-func (handler *Handler) LocalFileExists(target string) bool {
+// Serves reports whether an item of the repository matches name, types that
+// name the repository in the url use it to restrict what may be uploaded
+func (handler *Handler) Serves(name string) bool {
+	return handler.items.Matches(name)
+}
+
+func (handler *Handler) LocalFileExists(ctx context.Context, target string) bool {
+	_, span := StartSpan(ctx, "store.stat", attribute.String("store.target", target))
 	stat, err := handler.Local.Stat(target)
+	EndSpan(span, nil)
 	return err == nil && !stat.IsDir()
 }
 
-func (handler *Handler) HandleLocalGet(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) error {
+func (handler *Handler) HandleLocalGet(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) (err error) {
+	_, span := StartSpan(r.Context(), "store.get", attribute.String("store.target", target))
+	defer func() { EndSpan(span, err) }()
+
 	rFile, err := handler.Local.Open(target)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		handler.Fail(w, http.StatusNotFound, "", path.Base(target)+" not found")
 		logger.Error("file:open", slog.String("target", target), slog.String("error", err.Error()))
 		return err
 	}
@@ -55,7 +117,7 @@ func (handler *Handler) HandleLocalGet(target string, logger slog.Logger, w http
 	stat, err := rFile.Stat()
 	if err != nil {
 		logger.Error("file:stat", slog.String("target", target), slog.String("error", err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
+		handler.Fail(w, http.StatusInternalServerError, "", "could not read "+path.Base(target))
 		return err
 	}
 	w.Header().Set("Content-Disposition", "attachment; filename="+path.Base(target))
@@ -65,8 +127,13 @@ func (handler *Handler) HandleLocalGet(target string, logger slog.Logger, w http
 	etagged, ok := stat.(store.EntityTagged)
 	if ok {
 		etag, err := etagged.EntityTag()
-		if err != nil {
+		if err == nil && etag != "" {
+			etag = quoteEntityTag(etag)
 			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return nil
+			}
 		}
 	}
 
@@ -74,17 +141,32 @@ func (handler *Handler) HandleLocalGet(target string, logger slog.Logger, w http
 	_, err = io.Copy(w, rFile)
 	if err != nil {
 		logger.Error("file:read", slog.String("target", target), slog.String("error", err.Error()))
+		return err
 	}
-	return err
+	handler.Notify(r, webhook.ActionPull, webhook.Target{Name: target, Path: target, Size: stat.Size()})
+	return nil
 }
 
-func (handler *Handler) HandleLocalPut(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) error {
+// quoteEntityTag turns a stored tag, such as the MD5 of the content, into the
+// quoted form HTTP requires
+func quoteEntityTag(tag string) string {
+	if strings.HasPrefix(tag, `"`) || strings.HasPrefix(tag, `W/"`) {
+		return tag
+	}
+	return `"` + tag + `"`
+}
+
+func (handler *Handler) HandleLocalPut(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) (err error) {
+	_, span := StartSpan(r.Context(), "store.put", attribute.String("store.target", target))
+	defer func() { EndSpan(span, err) }()
+
 	defer r.Body.Close()
+	var sums *Checksums
 	buffer := bytes.Buffer{}
 	readLength, err := io.Copy(&buffer, r.Body)
 	if err != nil {
 		logger.Error("content:read", slog.String("target", target), slog.String("error", err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
+		handler.Fail(w, http.StatusInternalServerError, "", "could not read the request body")
 		return err
 	}
 	contentLength := r.Header.Get("Content-Length")
@@ -92,51 +174,108 @@ func (handler *Handler) HandleLocalPut(target string, logger slog.Logger, w http
 		if claimedLength, _ := strconv.Atoi(contentLength); readLength != -1 && int64(claimedLength) != readLength {
 			err := fmt.Errorf("content length mismatch: %d != %d", claimedLength, readLength)
 			logger.Error("content:validate", slog.String("target", target), slog.String("error", err.Error()))
-			w.WriteHeader(http.StatusInternalServerError)
+			handler.Fail(w, http.StatusBadRequest, "SIZE_INVALID", err.Error())
 			return err
 		}
 	}
 
-	etag := r.Header.Get("ETag")
-	if etag == "" {
-		hmac := md5.New()
-		hmac.Write(buffer.Bytes())
-		etag = hex.EncodeToString(hmac.Sum(nil))
+	expected, err := ExpectedChecksums(r.Header)
+	if err == nil {
+		sums = NewChecksums(buffer.Bytes())
+		err = sums.Verify(expected)
 	}
+	if err != nil {
+		logger.Error("content:verify", slog.String("target", target), slog.String("error", err.Error()))
+		handler.Fail(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return err
+	}
+
+	action := audit.ActionPush
+	if handler.LocalFileExists(r.Context(), target) {
+		action = audit.ActionOverwrite
+	}
+	span.SetAttributes(attribute.Int64("store.size", readLength))
 
 	info := store.Info{
 		Size:      int64(readLength),
 		Mode:      0644,
-		EntityTag: etag,
+		EntityTag: sums.MD5,
 	}
 
 	wFile, err := handler.Local.Create(target, info.FileInfo())
 	if err != nil {
 		logger.Error("file:create", slog.String("target", target), slog.String("error", err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
+		handler.Fail(w, http.StatusInternalServerError, "", "could not store "+path.Base(target))
 		return err
 	}
 	_, err = wFile.Write(buffer.Bytes())
 	if err != nil {
 		logger.Error("file:write start", slog.String("target", target), slog.String("error", err.Error()))
 		wFile.Close()
-		w.WriteHeader(http.StatusInternalServerError)
+		handler.Fail(w, http.StatusInternalServerError, "", "could not store "+path.Base(target))
 		return err
 	}
 	err = wFile.Close()
 	if err != nil {
 		logger.Error("file:write finish", slog.String("target", target), slog.String("error", err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
+		handler.Fail(w, http.StatusInternalServerError, "", "could not store "+path.Base(target))
 		return err
 	}
+	err = handler.writeChecksums(target, sums)
+	if err != nil {
+		logger.Error("checksums:write", slog.String("target", target), slog.String("error", err.Error()))
+		handler.Fail(w, http.StatusInternalServerError, "", "could not store the checksums of "+path.Base(target))
+		return err
+	}
+
+	handler.RecordWrite(r, action, target, "sha256:"+sums.SHA256, readLength)
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-func (handler *Handler) HandleLocalDelete(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) error {
-	w.WriteHeader(http.StatusNotImplemented)
-	err := fmt.Errorf("not implemented")
-	logger.Error("file:deletion", slog.String("target", target), slog.String("error", err.Error()))
-	return err
+type remover interface {
+	Remove(name string) error
+}
+
+func (handler *Handler) RemoveLocal(target string) error {
+	removable, ok := handler.Local.(remover)
+	if !ok {
+		return fmt.Errorf("store does not support deletion")
+	}
+	return removable.Remove(target)
+}
+
+func (handler *Handler) HandleLocalDelete(target string, logger slog.Logger, w http.ResponseWriter, r *http.Request) (err error) {
+	_, span := StartSpan(r.Context(), "store.delete", attribute.String("store.target", target))
+	defer func() { EndSpan(span, err) }()
+
+	removable, ok := handler.Local.(remover)
+	if !ok {
+		handler.Fail(w, http.StatusNotImplemented, "", "the store does not support deletion")
+		err = fmt.Errorf("not implemented")
+		logger.Error("file:deletion", slog.String("target", target), slog.String("error", err.Error()))
+		return err
+	}
+	stat, err := handler.Local.Stat(target)
+	if err != nil {
+		handler.Fail(w, http.StatusNotFound, "", path.Base(target)+" not found")
+		logger.Error("file:stat", slog.String("target", target), slog.String("error", err.Error()))
+		return err
+	}
+	err = removable.Remove(target)
+	if err != nil {
+		handler.Fail(w, http.StatusInternalServerError, "", "could not delete "+path.Base(target))
+		logger.Error("file:deletion", slog.String("target", target), slog.String("error", err.Error()))
+		return err
+	}
+	//files stored before checksums were kept have none
+	if err := removable.Remove(checksumPath(target)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Error("checksums:deletion", slog.String("target", target), slog.String("error", err.Error()))
+	}
+
+	handler.RecordWrite(r, audit.ActionDelete, target, "", stat.Size())
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
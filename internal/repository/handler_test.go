@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/repository/repotest"
+)
+
+func TestHandleLocalGetETag(t *testing.T) {
+	repotest.Mount(t)
+	handler, err := repository.NewHandler(context.Background(), &repository.Config{Name: "etag-handler", Type: "binary", Items: []string{"**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := *slog.Default()
+	const content = "some content"
+	put := httptest.NewRequest("PUT", "/file.txt", strings.NewReader(content))
+	rec := httptest.NewRecorder()
+	if err := handler.HandleLocalPut("file.txt", logger, rec, put); err != nil {
+		t.Fatalf("HandleLocalPut() = %v", err)
+	}
+
+	sum := md5.Sum([]byte(content))
+	want := `"` + hex.EncodeToString(sum[:]) + `"`
+	rec = httptest.NewRecorder()
+	handler.HandleLocalGet("file.txt", logger, rec, httptest.NewRequest("GET", "/file.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Fatalf("get = %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("ETag"); got != want {
+		t.Fatalf("ETag = %q, want %q", got, want)
+	}
+
+	conditional := httptest.NewRequest("GET", "/file.txt", nil)
+	conditional.Header.Set("If-None-Match", want)
+	rec = httptest.NewRecorder()
+	handler.HandleLocalGet("file.txt", logger, rec, conditional)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("conditional get = %d with %d bytes, want 304 without a body", rec.Code, rec.Body.Len())
+	}
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/davidjspooner/dshttp/pkg/mux"
@@ -14,6 +15,13 @@ type Router interface {
 	SetupRoutes(mux mux.Mux) error
 }
 
+// VirtualRouter is a Router that can also aggregate several of its repositories
+// into a virtual repository
+type VirtualRouter interface {
+	Router
+	NewVirtual(ctx context.Context, config *Config) error
+}
+
 var routers = make(map[string]Router)
 
 func RegisterRouter(rType string, router Router) {
@@ -35,5 +43,27 @@ func NewRepo(ctx context.Context, config *Config) error {
 		types := maps.Keys(routers)
 		return fmt.Errorf("unknown tree type: %s is not one of %s", config.Type, strings.Join(types, ", "))
 	}
+	if len(config.Members) > 0 {
+		virtualRouter, ok := router.(VirtualRouter)
+		if !ok {
+			return fmt.Errorf("repository %s has members but %s repositories can not be virtual, only %s can", config.Name, config.Type, strings.Join(virtualTypes(), ", "))
+		}
+		return virtualRouter.NewVirtual(ctx, config)
+	}
+	if config.Deploy != "" {
+		return fmt.Errorf("repository %s has a deploy member but no members", config.Name)
+	}
 	return router.NewRepo(ctx, config)
 }
+
+// virtualTypes lists the repository types that support members
+func virtualTypes() []string {
+	var types []string
+	for rType, router := range routers {
+		if _, ok := router.(VirtualRouter); ok {
+			types = append(types, rType)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
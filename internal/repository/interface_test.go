@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/dshttp/pkg/mux"
+)
+
+type plainRouter struct{}
+
+func (plainRouter) NewRepo(ctx context.Context, config *Config) error { return nil }
+func (plainRouter) SetupRoutes(mux mux.Mux) error                     { return nil }
+
+type virtualRouter struct{ plainRouter }
+
+func (virtualRouter) NewVirtual(ctx context.Context, config *Config) error { return nil }
+
+func TestNewRepoRejectsUnsupportedVirtual(t *testing.T) {
+	RegisterRouter("test-plain", plainRouter{})
+	RegisterRouter("test-virtual", virtualRouter{})
+	t.Cleanup(func() {
+		delete(routers, "test-plain")
+		delete(routers, "test-virtual")
+	})
+
+	err := NewRepo(context.Background(), &Config{Name: "all-plain", Type: "test-plain", Members: []string{"a", "b"}})
+	if err == nil || !strings.Contains(err.Error(), "all-plain") || !strings.Contains(err.Error(), "test-virtual") {
+		t.Errorf("members of a type without virtual support: %v", err)
+	}
+	err = NewRepo(context.Background(), &Config{Name: "all-virtual", Type: "test-virtual", Members: []string{"a", "b"}})
+	if err != nil {
+		t.Errorf("members of a type with virtual support: %v", err)
+	}
+	err = NewRepo(context.Background(), &Config{Name: "deploy-only", Type: "test-plain", Deploy: "a"})
+	if err == nil {
+		t.Error("a deploy member without members was accepted")
+	}
+}
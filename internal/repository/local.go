@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// upstreamClient gives up on an upstream that does not answer, so a hung
+// upstream cannot hold a request or a cache entry forever. Large artifacts
+// still have minutes to arrive once the upstream has answered.
+var upstreamClient = &http.Client{
+	Timeout:   5 * time.Minute,
+	Transport: otelhttp.NewTransport(upstreamTransport()),
+}
+
+func upstreamTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return transport
+}
+
+// ReadLocal reads a whole file from the local store
+func (handler *Handler) ReadLocal(target string) ([]byte, error) {
+	rFile, err := handler.Local.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer rFile.Close()
+	return io.ReadAll(rFile)
+}
+
+// WriteLocal replaces a file in the local store
+func (handler *Handler) WriteLocal(target string, content []byte) error {
+	hash := md5.Sum(content)
+	info := store.Info{
+		Size:      int64(len(content)),
+		Mode:      0644,
+		EntityTag: hex.EncodeToString(hash[:]),
+	}
+	wFile, err := handler.Local.Create(target, info.FileInfo())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wFile, bytes.NewReader(content))
+	if err != nil {
+		wFile.Close()
+		return err
+	}
+	return wFile.Close()
+}
+
+// UpstreamURL joins path elements onto the configured upstream url
+func (handler *Handler) UpstreamURL(elem ...string) string {
+	base := strings.TrimSuffix(handler.Upstream.String(), "/")
+	return base + "/" + strings.TrimPrefix(strings.Join(elem, "/"), "/")
+}
+
+func (handler *Handler) FetchUpstream(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return upstreamClient.Do(req)
+}
+
+type UpstreamError struct {
+	URL    string
+	Status int
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream %s returned %d", e.URL, e.Status)
+}
+
+// FetchToLocal downloads rawURL and stores it as target, returning the content.
+// A non 200 answer is returned as an *UpstreamError.
+func (handler *Handler) FetchToLocal(ctx context.Context, target, rawURL string) (content []byte, err error) {
+	ctx, span := StartSpan(ctx, "upstream.fetch", attribute.String("upstream.url", rawURL), attribute.String("store.target", target))
+	defer func() { EndSpan(span, err) }()
+
+	response, err := handler.FetchUpstream(ctx, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &UpstreamError{URL: rawURL, Status: response.StatusCode}
+	}
+	content, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = handler.WriteLocal(target, content)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"net/http"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+	"github.com/davidjspooner/dsrepo/internal/webhook"
+)
+
+// RecordWrite audits a successful push, overwrite or delete and notifies webhooks
+func (handler *Handler) RecordWrite(r *http.Request, action audit.Action, target, digest string, size int64) {
+	handler.AuditWrite(r, action, target, digest, size)
+
+	webhookAction := webhook.ActionPush
+	if action == audit.ActionDelete {
+		webhookAction = webhook.ActionDelete
+	}
+	handler.Notify(r, webhookAction, webhook.Target{Name: target, Path: target, Digest: digest, Size: size})
+}
+
+// AuditWrite is RecordWrite for types that notify webhooks with a protocol
+// specific target of their own
+func (handler *Handler) AuditWrite(r *http.Request, action audit.Action, target, digest string, size int64) {
+	event := handler.newEvent(r, action, target)
+	event.Digest = digest
+	event.Size = size
+	audit.Record(r.Context(), event)
+}
+
+func (handler *Handler) Notify(r *http.Request, action webhook.Action, target webhook.Target) {
+	user, remote := RequestIdentity(r)
+	if target.URL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		target.URL = scheme + "://" + r.Host + r.URL.Path
+	}
+	handler.Webhooks.Notify(&webhook.Event{
+		Action:     action,
+		Repository: handler.Name,
+		Type:       handler.Type,
+		Target:     target,
+		Request: webhook.Request{
+			Addr:      remote,
+			Host:      r.Host,
+			Method:    r.Method,
+			UserAgent: r.UserAgent(),
+		},
+		Actor: webhook.Actor{Name: user},
+	})
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AdminCache is the part of a Cache the admin api can inspect and purge
+type AdminCache interface {
+	Count() int
+	Purge(key string)
+	Clear()
+}
+
+type Usage struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+var handlersLock sync.Mutex
+var handlers = make(map[string]*Handler)
+
+func registerHandler(handler *Handler) error {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	if _, exists := handlers[handler.Name]; exists {
+		return fmt.Errorf("duplicate repository name %q", handler.Name)
+	}
+	handlers[handler.Name] = handler
+	return nil
+}
+
+func LookupHandler(name string) *Handler {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	return handlers[name]
+}
+
+// Handlers returns every configured repository sorted by name
+func Handlers() []*Handler {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	list := make([]*Handler, 0, len(handlers))
+	for _, handler := range handlers {
+		list = append(list, handler)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// SharingStore returns the other repositories whose local store path is, is
+// inside or contains the path of handler, maintenance that deletes content it
+// does not recognise must not run on such a store
+func (handler *Handler) SharingStore() []string {
+	own := strings.TrimSuffix(handler.Config.Local.Path, "/")
+	shared := []string{}
+	if own == "" {
+		return shared
+	}
+	for _, other := range Handlers() {
+		path := strings.TrimSuffix(other.Config.Local.Path, "/")
+		if other == handler || path == "" {
+			continue
+		}
+		if path == own || strings.HasPrefix(path, own+"/") || strings.HasPrefix(own, path+"/") {
+			shared = append(shared, other.Name)
+		}
+	}
+	return shared
+}
+
+func (handler *Handler) RegisterCache(name string, cache AdminCache) {
+	if handler.Caches == nil {
+		handler.Caches = make(map[string]AdminCache)
+	}
+	handler.Caches[name] = cache
+}
+
+func (handler *Handler) CacheCounts() map[string]int {
+	counts := make(map[string]int, len(handler.Caches))
+	for name, cache := range handler.Caches {
+		counts[name] = cache.Count()
+	}
+	return counts
+}
+
+func (handler *Handler) Usage(ctx context.Context) (*Usage, error) {
+	_, span := StartSpan(ctx, "store.usage")
+	usage := &Usage{}
+	if handler.Local == nil {
+		EndSpan(span, nil)
+		return usage, nil
+	}
+	err := fs.WalkDir(handler.Local, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+		return nil
+	})
+	EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,23 @@
+package repotest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidjspooner/dsrepo/internal/audit"
+)
+
+// Audit records the audit events of the test in a temporary log
+func Audit(t testing.TB) *audit.Log {
+	log, err := audit.Open(context.Background(), &audit.Config{File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit.SetLog(log)
+	t.Cleanup(func() {
+		audit.SetLog(nil)
+		log.Close()
+	})
+	return log
+}
@@ -0,0 +1,138 @@
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/davidjspooner/dshttp/pkg/middleware"
+	"github.com/davidjspooner/dshttp/pkg/mux"
+	"github.com/davidjspooner/dsrepo/internal/access"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+	"github.com/davidjspooner/dsrepo/internal/signing"
+	"gopkg.in/yaml.v3"
+)
+
+// Serve sets up the routes of router behind the observer the server uses, so
+// handlers log as they do when served
+func Serve(t testing.TB, router repository.Router) http.Handler {
+	aMux := mux.NewServeMux()
+	if err := router.SetupRoutes(aMux); err != nil {
+		t.Fatal(err)
+	}
+	return (&middleware.Observer{Logger: slog.Default()}).WrapHandler(aMux)
+}
+
+// Do serves one request, body may be nil
+func Do(handler http.Handler, method, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+// Client sends requests below the url of one repository
+type Client struct {
+	Handler http.Handler
+	Base    string
+}
+
+// NewRepo creates the repository of config through router, with an in memory
+// store, and returns a client for the routes of the router below base
+func NewRepo(t testing.TB, router repository.Router, config *repository.Config, base string) *Client {
+	Mount(t)
+	if err := router.NewRepo(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	return &Client{Handler: Serve(t, router), Base: base}
+}
+
+// Do serves one request for p below the base of the client, body may be nil
+func (c *Client) Do(method, p string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	return Do(c.Handler, method, c.Base+p, body, header)
+}
+
+// Get serves a GET of p below the base of the client
+func (c *Client) Get(p string) *httptest.ResponseRecorder {
+	return c.Do(http.MethodGet, p, nil, nil)
+}
+
+// PublishPolicies let anyone list and get from a repository of type typ but
+// only put and delete the package name
+func PublishPolicies(t testing.TB, typ, name string) access.PolicyList {
+	return Policies(t, fmt.Sprintf(`
+- name: read
+  actions: ["%[1]s:list", "%[1]s:get"]
+  resources: ["%[1]s:*"]
+- name: publish-%[2]s
+  actions: ["%[1]s:put", "%[1]s:delete"]
+  resources: ["%[1]s:%[2]s"]
+`, typ, name))
+}
+
+// Policies parses a yaml list of policies
+func Policies(t testing.TB, text string) access.PolicyList {
+	var policies access.PolicyList
+	if err := yaml.Unmarshal([]byte(text), &policies); err != nil {
+		t.Fatal(err)
+	}
+	return policies
+}
+
+// SigningKey writes a new OpenPGP key for the test and returns the config
+// that loads it, with the key clients verify against
+func SigningKey(t testing.TB) (signing.Config, openpgp.EntityList) {
+	entity, err := openpgp.NewEntity("dsrepo test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := bytes.Buffer{}
+	w, err := armor.Encode(&buffer, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile := filepath.Join(t.TempDir(), "key.asc")
+	if err = os.WriteFile(keyFile, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return signing.Config{KeyFile: keyFile}, openpgp.EntityList{entity}
+}
+
+// RSAKey writes a new RSA key for the test as packager.rsa and returns the
+// config that loads it
+func RSAKey(t testing.TB) (signing.Config, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "packager.rsa")
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return signing.Config{KeyFile: keyFile}, key
+}
@@ -0,0 +1,165 @@
+// Package repotest runs repository types against an in memory store so their
+// handlers can be tested over HTTP
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/davidjspooner/dsfile/pkg/store"
+	"github.com/davidjspooner/dsrepo/internal/repository"
+)
+
+// Store is an in memory store.Interface that also supports removal. Like a
+// real store it keeps the entity tag a file was created with.
+type Store struct {
+	lock  sync.Mutex
+	files fstest.MapFS
+	tags  map[string]string
+}
+
+func NewStore() *Store {
+	return &Store{files: fstest.MapFS{}, tags: map[string]string{}}
+}
+
+type taggedInfo struct {
+	fs.FileInfo
+	tag string
+}
+
+func (info taggedInfo) EntityTag() (string, error) {
+	return info.tag, nil
+}
+
+type taggedFile struct {
+	fs.File
+	tag string
+}
+
+func (file taggedFile) Stat() (fs.FileInfo, error) {
+	info, err := file.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return taggedInfo{info, file.tag}, nil
+}
+
+func (s *Store) Open(name string) (fs.File, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	file, err := s.files.Open(name)
+	if tag := s.tags[name]; err == nil && tag != "" {
+		return taggedFile{file, tag}, nil
+	}
+	return file, err
+}
+
+func (s *Store) Stat(name string) (fs.FileInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	info, err := s.files.Stat(name)
+	if tag := s.tags[name]; err == nil && tag != "" {
+		return taggedInfo{info, tag}, nil
+	}
+	return info, err
+}
+
+func (s *Store) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.files.ReadDir(name)
+}
+
+type writer struct {
+	bytes.Buffer
+	store *Store
+	name  string
+	tag   string
+}
+
+func (w *writer) Close() error {
+	w.store.put(w.name, w.Bytes(), w.tag)
+	return nil
+}
+
+func (s *Store) Create(name string, info fs.FileInfo) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	w := &writer{store: s, name: name}
+	if tagged, ok := info.(store.EntityTagged); ok {
+		w.tag, _ = tagged.EntityTag()
+	}
+	return w, nil
+}
+
+func (s *Store) Remove(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.files, name)
+	delete(s.tags, name)
+	return nil
+}
+
+// Put stores a file as if it had been uploaded now
+func (s *Store) Put(name string, content []byte) {
+	s.put(name, content, "")
+}
+
+func (s *Store) put(name string, content []byte, tag string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.files[name] = &fstest.MapFile{Data: bytes.Clone(content), Mode: 0644, ModTime: time.Now()}
+	s.tags[name] = tag
+}
+
+// Age moves the modification time of a file back by d
+func (s *Store) Age(name string, d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if file, ok := s.files[name]; ok {
+		file.ModTime = file.ModTime.Add(-d)
+	}
+}
+
+// Names lists the stored files below prefix
+func (s *Store) Names(prefix string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := []string{}
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Mount makes repository handlers created during the test use a new in memory
+// store for each local path
+func Mount(t testing.TB) {
+	previous := repository.MountStore
+	repository.MountStore = func(ctx context.Context, path string, args map[string]string) (store.Interface, error) {
+		return NewStore(), nil
+	}
+	t.Cleanup(func() { repository.MountStore = previous })
+}
+
+// Local returns the in memory store of a handler created after Mount
+func Local(t testing.TB, handler *repository.Handler) *Store {
+	local, ok := handler.Local.(*Store)
+	if !ok {
+		t.Fatalf("%s does not use an in memory store", handler.Name)
+	}
+	return local
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"log/slog"
+
+	"github.com/davidjspooner/dsmatch/pkg/matcher"
+)
+
+// Route is one item glob of a repository
+type Route[T any] struct {
+	Repo        T
+	Name        string
+	Item        string
+	Priority    int
+	Order       int
+	specificity int
+}
+
+// Routes finds the repository of a type that serves a name. When items of
+// several repositories match, the highest priority wins, then the most specific
+// item, then the repository configured first. Identical items of several
+// repositories are all kept and ranked the same way.
+type Routes[T any] struct {
+	tree  matcher.Tree[[]*Route[T]]
+	count int
+}
+
+func (routes *Routes[T]) Add(config *Config, repo T) error {
+	routes.count++
+	for _, item := range config.Items {
+		seq, err := NewGlob([]byte(item), '/')
+		if err != nil {
+			return err
+		}
+		leaf, err := routes.tree.Add(seq)
+		if err != nil {
+			return err
+		}
+		leaf.Payload = append(leaf.Payload, &Route[T]{
+			Repo:        repo,
+			Name:        config.Name,
+			Item:        item,
+			Priority:    config.Priority,
+			Order:       routes.count,
+			specificity: Specificity(item),
+		})
+	}
+	return nil
+}
+
+func (routes *Routes[T]) IsEmpty() bool {
+	return routes.tree.IsEmpty()
+}
+
+// Select returns the route that serves name, or nil if no item matches it.
+// The choice between overlapping items is logged, to the default logger if logger is nil.
+func (routes *Routes[T]) Select(name string, logger *slog.Logger) *Route[T] {
+	var best *Route[T]
+	matches := 0
+	for _, leaf := range routes.tree.FindLeaves([]byte(name)) {
+		for _, route := range leaf.Payload {
+			matches++
+			if best == nil || route.before(best) {
+				best = route
+			}
+		}
+	}
+	if matches > 1 {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		logger.Debug("overlapping items", slog.String("name", name), slog.String("repository", best.Name), slog.String("item", best.Item), slog.Int("matches", matches))
+	}
+	return best
+}
+
+// Matches reports whether any item matches name
+func (routes *Routes[T]) Matches(name string) bool {
+	for _, leaf := range routes.tree.FindLeaves([]byte(name)) {
+		if len(leaf.Payload) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (route *Route[T]) before(other *Route[T]) bool {
+	if route.Priority != other.Priority {
+		return route.Priority > other.Priority
+	}
+	if route.specificity != other.specificity {
+		return route.specificity > other.specificity
+	}
+	return route.Order < other.Order
+}
+
+// Specificity ranks how narrowly an item glob matches. Every literal character
+// counts, and an item without wildcards beats any item that matches the same name.
+func Specificity(item string) int {
+	literal := 0
+	for i := 0; i < len(item); i++ {
+		if item[i] != '*' && item[i] != '?' {
+			literal++
+		}
+	}
+	specificity := 2 * literal
+	if literal == len(item) {
+		specificity++
+	}
+	return specificity
+}
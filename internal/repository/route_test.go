@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpecificity(t *testing.T) {
+	// each item is more specific than the next for a name they all match
+	items := []string{"davidjspooner/tool", "davidjspooner/t*", "davidjspooner/*", "*/*", "**"}
+	for i := 1; i < len(items); i++ {
+		if Specificity(items[i-1]) <= Specificity(items[i]) {
+			t.Errorf("%q (%d) should be more specific than %q (%d)", items[i-1], Specificity(items[i-1]), items[i], Specificity(items[i]))
+		}
+	}
+}
+
+func TestRouteBefore(t *testing.T) {
+	route := func(item string, priority, order int) *Route[string] {
+		return &Route[string]{Item: item, Priority: priority, Order: order, specificity: Specificity(item)}
+	}
+	tests := []struct {
+		winner, loser *Route[string]
+	}{
+		{route("davidjspooner/*", 0, 2), route("*/*", 0, 1)},
+		{route("*/*", 0, 1), route("*/?*", 0, 2)},
+		{route("*/*", 0, 1), route("*/*", 0, 2)},
+		{route("**", 10, 3), route("davidjspooner/*", 0, 1)},
+	}
+	for _, test := range tests {
+		if !test.winner.before(test.loser) || test.loser.before(test.winner) {
+			t.Errorf("%q (priority %d, order %d) should win over %q (priority %d, order %d)",
+				test.winner.Item, test.winner.Priority, test.winner.Order,
+				test.loser.Item, test.loser.Priority, test.loser.Order)
+		}
+	}
+}
+
+func TestRoutesIdenticalItems(t *testing.T) {
+	var routes Routes[string]
+	configs := []*Config{
+		{Name: "first", Items: []string{"davidjspooner/*"}},
+		{Name: "second", Items: []string{"davidjspooner/*"}},
+		{Name: "preferred", Items: []string{"davidjspooner/*"}, Priority: 5},
+		{Name: "third", Items: []string{"davidjspooner/*"}},
+	}
+	for _, config := range configs {
+		if err := routes.Add(config, config.Name); err != nil {
+			t.Fatalf("Add(%s) = %v", config.Name, err)
+		}
+	}
+	route := routes.Select("davidjspooner/tool", nil)
+	if route == nil || route.Repo != "preferred" {
+		t.Fatalf("Select() = %v, want the preferred repository", route)
+	}
+	if !routes.Matches("davidjspooner/tool") || routes.Matches("other/tool") {
+		t.Error("Matches() does not follow the items")
+	}
+}
+
+func TestRequestLoggerWithoutObserver(t *testing.T) {
+	var routes Routes[string]
+	for _, name := range []string{"first", "second"} {
+		if err := routes.Add(&Config{Name: name, Items: []string{"davidjspooner/*"}}, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a request that no observer wrapped must still log the overlap
+	logger := RequestLogger(httptest.NewRequest("GET", "/", nil))
+	if route := routes.Select("davidjspooner/tool", &logger); route == nil || route.Repo != "first" {
+		t.Fatalf("Select() = %v, want the first repository", route)
+	}
+}
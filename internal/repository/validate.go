@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// InvalidError describes a value taken from a request that failed validation
+type InvalidError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+var (
+	ociName     = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	ociTag      = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	ociDigest   = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+	semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+)
+
+const maxOCINameLength = 255
+
+// KnownOS and KnownArch are the GOOS and GOARCH style platform names a
+// repository accepts
+var KnownOS = []string{"darwin", "linux", "windows", "freebsd", "openbsd", "netbsd", "solaris", "dragonfly", "plan9", "aix", "zos"}
+var KnownArch = []string{"amd64", "arm", "arm64", "386", "ppc64le", "s390x", "mips64", "mips64le", "riscv64"}
+
+// ValidatePath accepts a relative slash separated path whose elements are all
+// valid segments
+func ValidatePath(field, p string) error {
+	if p == "" {
+		return &InvalidError{Field: field, Value: p, Reason: "empty"}
+	}
+	if strings.HasPrefix(p, "/") {
+		return &InvalidError{Field: field, Value: p, Reason: "absolute path"}
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if reason := segmentProblem(segment); reason != "" {
+			return &InvalidError{Field: field, Value: p, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// ValidateSegment accepts a single path element that can not escape the
+// directory it is joined to
+func ValidateSegment(field, segment string) error {
+	if reason := segmentProblem(segment); reason != "" {
+		return &InvalidError{Field: field, Value: segment, Reason: reason}
+	}
+	return nil
+}
+
+func segmentProblem(segment string) string {
+	switch {
+	case segment == "":
+		return "empty path element"
+	case segment == "." || segment == "..":
+		return "relative path element"
+	case segment == ChecksumDir:
+		return "reserved path element"
+	case strings.ContainsAny(segment, "/\\"):
+		return "path separator"
+	case strings.ContainsFunc(segment, func(r rune) bool { return r < 0x20 || r == 0x7f }):
+		return "control character"
+	}
+	return ""
+}
+
+// ValidateOCIName accepts a repository name of the OCI distribution spec
+func ValidateOCIName(name string) error {
+	if len(name) > maxOCINameLength || !ociName.MatchString(name) {
+		return &InvalidError{Field: "name", Value: name, Reason: "not an OCI repository name"}
+	}
+	return nil
+}
+
+// ValidateOCITag accepts a tag of the OCI distribution spec
+func ValidateOCITag(tag string) error {
+	if !ociTag.MatchString(tag) {
+		return &InvalidError{Field: "tag", Value: tag, Reason: "not an OCI tag"}
+	}
+	return nil
+}
+
+// ValidateDigest accepts a sha256 or sha512 digest in its canonical form
+func ValidateDigest(digest string) error {
+	if !ociDigest.MatchString(digest) {
+		return &InvalidError{Field: "digest", Value: digest, Reason: "not a sha256 or sha512 digest"}
+	}
+	return nil
+}
+
+// ValidateSemver accepts a MAJOR.MINOR.PATCH version with optional pre-release
+// and build metadata and no leading "v"
+func ValidateSemver(version string) error {
+	if !semverRegex.MatchString(version) {
+		return &InvalidError{Field: "version", Value: version, Reason: "not a semantic version"}
+	}
+	return nil
+}
+
+// ValidatePlatform accepts an os and arch from KnownOS and KnownArch
+func ValidatePlatform(os, arch string) error {
+	if !slices.Contains(KnownOS, os) {
+		return &InvalidError{Field: "os", Value: os, Reason: "unknown operating system"}
+	}
+	if !slices.Contains(KnownArch, arch) {
+		return &InvalidError{Field: "arch", Value: arch, Reason: "unknown architecture"}
+	}
+	return nil
+}
+
+// ValidateSegments checks the single element path values of a request, values
+// the matched route does not have are skipped
+func ValidateSegments(r *http.Request, names ...string) error {
+	for _, name := range names {
+		if value := r.PathValue(name); value != "" {
+			if err := ValidateSegment(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(string) error
+		valid    []string
+		invalid  []string
+	}{
+		{
+			name:     "path",
+			validate: func(s string) error { return ValidatePath("path", s) },
+			valid:    []string{"a", "a/b/c", "tool/v1.2/linux/tool", "..a/b.."},
+			invalid:  []string{"", "/etc/passwd", "a/../b", "..", "a/./b", "a//b", "a/", "a\\b", "a/b\x00", "a\nb", "a\x7fb", ".checksums", "a/.checksums/b.json"},
+		},
+		{
+			name:     "oci name",
+			validate: ValidateOCIName,
+			valid:    []string{"library/alpine", "davidjspooner/tool", "a", "a.b_c__d---e/f"},
+			invalid:  []string{"", "Library/alpine", "a/../b", "a//b", "-a", "a_", "a/", strings.Repeat("a", 256)},
+		},
+		{
+			name:     "oci tag",
+			validate: ValidateOCITag,
+			valid:    []string{"latest", "v1.2.3", "_x", "A-b.c_d"},
+			invalid:  []string{"", ".hidden", "-x", "a/b", "a:b", strings.Repeat("a", 129)},
+		},
+		{
+			name:     "digest",
+			validate: ValidateDigest,
+			valid:    []string{"sha256:" + strings.Repeat("a", 64), "sha512:" + strings.Repeat("0", 128)},
+			invalid:  []string{"sha256:" + strings.Repeat("A", 64), "sha256:abc", "md5:" + strings.Repeat("a", 32), "sha256:../" + strings.Repeat("a", 61)},
+		},
+		{
+			name:     "semver",
+			validate: ValidateSemver,
+			valid:    []string{"0.0.1", "1.2.3", "1.2.3-rc.1", "1.2.3+build.5", "10.20.30-alpha+001"},
+			invalid:  []string{"", "v1.2.3", "1.2", "01.2.3", "1.2.3/../x", "1.2.3-"},
+		},
+	}
+	for _, test := range tests {
+		for _, value := range test.valid {
+			if err := test.validate(value); err != nil {
+				t.Errorf("%s %q: unexpected error %v", test.name, value, err)
+			}
+		}
+		for _, value := range test.invalid {
+			if err := test.validate(value); err == nil {
+				t.Errorf("%s %q: expected an error", test.name, value)
+			}
+		}
+	}
+}
+
+func TestValidatePlatform(t *testing.T) {
+	if err := ValidatePlatform("linux", "amd64"); err != nil {
+		t.Error(err)
+	}
+	for _, platform := range [][2]string{{"linux", "../amd64"}, {"temple", "amd64"}, {"", ""}} {
+		if err := ValidatePlatform(platform[0], platform[1]); err == nil {
+			t.Errorf("%v: expected an error", platform)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// Virtual is the resolved member list of a virtual repository. Reads are
+// answered by the first member that has the item, writes go to the deploy member.
+type Virtual[T any] struct {
+	Members  []T
+	Handlers []*Handler
+	deploy   int
+}
+
+// ResolveVirtual looks up the members of a virtual repository among the
+// repositories of its type, which repos maps by name
+func ResolveVirtual[T any](config *Config, repos map[string]T, handlerOf func(T) *Handler) (*Virtual[T], error) {
+	virtual := &Virtual[T]{deploy: -1}
+	for _, name := range config.Members {
+		member, ok := repos[name]
+		if !ok {
+			return nil, fmt.Errorf("virtual repository %q: unknown %s repository %q", config.Name, config.Type, name)
+		}
+		if slices.Contains(virtual.Handlers, handlerOf(member)) {
+			return nil, fmt.Errorf("virtual repository %q: duplicate member %q", config.Name, name)
+		}
+		if name == config.Deploy {
+			virtual.deploy = len(virtual.Members)
+		}
+		virtual.Members = append(virtual.Members, member)
+		virtual.Handlers = append(virtual.Handlers, handlerOf(member))
+	}
+	if config.Deploy != "" && virtual.deploy < 0 {
+		return nil, fmt.Errorf("virtual repository %q: deploy repository %q is not a member", config.Name, config.Deploy)
+	}
+	return virtual, nil
+}
+
+// Deploy returns the member that receives writes, if there is one
+func (virtual *Virtual[T]) Deploy() (member T, ok bool) {
+	if virtual.deploy < 0 {
+		return member, false
+	}
+	return virtual.Members[virtual.deploy], true
+}
+
+// BrowseMembers lists the union of the member listings, earlier members win
+// when names clash
+func BrowseMembers(members []*Handler) Browser {
+	return func(ctx context.Context, p string) ([]BrowseEntry, error) {
+		var firstErr error
+		found := false
+		seen := make(map[string]bool)
+		list := []BrowseEntry{}
+		for _, member := range members {
+			entries, err := member.List(ctx, p)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			found = true
+			for _, entry := range entries {
+				if !seen[entry.Name] {
+					seen[entry.Name] = true
+					list = append(list, entry)
+				}
+			}
+		}
+		if !found && firstErr != nil {
+			return nil, firstErr
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Name < list[j].Name
+		})
+		return list, nil
+	}
+}
+
+// FirstFound offers a request to each of count members in turn until one
+// answers with something other than 404. When every member misses, the last
+// answer is replayed.
+func FirstFound(w http.ResponseWriter, count int, try func(n int, w http.ResponseWriter)) {
+	var last *missWriter
+	for n := 0; n < count; n++ {
+		last = &missWriter{w: w, header: make(http.Header)}
+		try(n, last)
+		if last.status == 0 {
+			last.WriteHeader(http.StatusOK)
+		}
+		if last.status != http.StatusNotFound {
+			return
+		}
+	}
+	if last == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	last.replay(w)
+}
+
+// Gather offers a request to every one of count members and returns the bodies
+// of the members that answered 200, in member order. When none did, the first
+// answer other than a 404 (or else the last 404) is replayed and ok is false.
+func Gather(w http.ResponseWriter, count int, try func(n int, w http.ResponseWriter)) (bodies [][]byte, ok bool) {
+	var failed *missWriter
+	for n := 0; n < count; n++ {
+		recorder := &missWriter{header: make(http.Header)}
+		try(n, recorder)
+		if recorder.status == 0 || recorder.status == http.StatusOK {
+			bodies = append(bodies, recorder.body.Bytes())
+		} else if failed == nil || failed.status == http.StatusNotFound {
+			failed = recorder
+		}
+	}
+	if len(bodies) > 0 {
+		return bodies, true
+	}
+	if failed == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	failed.replay(w)
+	return nil, false
+}
+
+// missWriter holds back a 404 answer so the next member can be tried, any
+// other answer is passed through to w. Without w everything is held back.
+type missWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (mw *missWriter) Header() http.Header {
+	return mw.header
+}
+
+func (mw *missWriter) WriteHeader(status int) {
+	if mw.status != 0 {
+		return
+	}
+	mw.status = status
+	if status == http.StatusNotFound || mw.w == nil {
+		return
+	}
+	dst := mw.w.Header()
+	for k, v := range mw.header {
+		dst[k] = v
+	}
+	mw.w.WriteHeader(status)
+}
+
+func (mw *missWriter) Write(chunk []byte) (int, error) {
+	if mw.status == 0 {
+		mw.WriteHeader(http.StatusOK)
+	}
+	if mw.status == http.StatusNotFound || mw.w == nil {
+		return mw.body.Write(chunk)
+	}
+	return mw.w.Write(chunk)
+}
+
+func (mw *missWriter) replay(w http.ResponseWriter) {
+	dst := w.Header()
+	for k, v := range mw.header {
+		dst[k] = v
+	}
+	w.WriteHeader(mw.status)
+	w.Write(mw.body.Bytes())
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func answer(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("X-Body", body)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestFirstFound(t *testing.T) {
+	tests := []struct {
+		members []func(w http.ResponseWriter)
+		status  int
+		body    string
+	}{
+		{
+			members: []func(w http.ResponseWriter){answer(200, "local"), answer(200, "remote")},
+			status:  200,
+			body:    "local",
+		},
+		{
+			members: []func(w http.ResponseWriter){answer(404, "missing"), answer(200, "remote")},
+			status:  200,
+			body:    "remote",
+		},
+		{
+			members: []func(w http.ResponseWriter){answer(403, "denied"), answer(200, "remote")},
+			status:  403,
+			body:    "denied",
+		},
+		{
+			members: []func(w http.ResponseWriter){answer(404, "first"), answer(404, "second")},
+			status:  404,
+			body:    "second",
+		},
+		{
+			members: nil,
+			status:  404,
+			body:    "",
+		},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		FirstFound(w, len(test.members), func(n int, w http.ResponseWriter) {
+			test.members[n](w)
+		})
+		if w.Code != test.status || w.Body.String() != test.body {
+			t.Errorf("test %d: got %d %q, expected %d %q", i, w.Code, w.Body.String(), test.status, test.body)
+		}
+		if test.body != "" && w.Header().Get("X-Body") != test.body {
+			t.Errorf("test %d: got header %q, expected %q", i, w.Header().Get("X-Body"), test.body)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	members := []func(w http.ResponseWriter){answer(200, "a"), answer(502, "down"), answer(404, "missing"), answer(200, "b")}
+	w := httptest.NewRecorder()
+	bodies, ok := Gather(w, len(members), func(n int, w http.ResponseWriter) {
+		members[n](w)
+	})
+	if !ok || len(bodies) != 2 || string(bodies[0]) != "a" || string(bodies[1]) != "b" {
+		t.Errorf("got %q %v, expected [a b]", bodies, ok)
+	}
+
+	members = []func(w http.ResponseWriter){answer(404, "missing"), answer(502, "down")}
+	w = httptest.NewRecorder()
+	_, ok = Gather(w, len(members), func(n int, w http.ResponseWriter) {
+		members[n](w)
+	})
+	if ok || w.Code != 502 || w.Body.String() != "down" {
+		t.Errorf("got %d %q %v, expected the 502 replayed", w.Code, w.Body.String(), ok)
+	}
+}
+
+func TestResolveVirtual(t *testing.T) {
+	local := &Handler{Name: "local"}
+	remote := &Handler{Name: "remote"}
+	repos := map[string]*Handler{"local": local, "remote": remote}
+	self := func(h *Handler) *Handler { return h }
+
+	config := &Config{Name: "all", Type: "container", Members: []string{"local", "remote"}, Deploy: "local"}
+	virtual, err := ResolveVirtual(config, repos, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(virtual.Members) != 2 || virtual.Members[0] != local || virtual.Members[1] != remote {
+		t.Errorf("members out of order: %v", virtual.Members)
+	}
+	if deploy, ok := virtual.Deploy(); !ok || deploy != local {
+		t.Errorf("got deploy %v, expected local", deploy)
+	}
+
+	config.Deploy = ""
+	virtual, err = ResolveVirtual(config, repos, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := virtual.Deploy(); ok {
+		t.Errorf("expected no deploy member")
+	}
+
+	for _, bad := range []*Config{
+		{Name: "all", Members: []string{"local", "unknown"}},
+		{Name: "all", Members: []string{"local", "local"}},
+		{Name: "all", Members: []string{"local"}, Deploy: "remote"},
+	} {
+		if _, err := ResolveVirtual(bad, repos, self); err == nil {
+			t.Errorf("expected an error for %v", bad.Members)
+		}
+	}
+}
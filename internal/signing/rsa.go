@@ -0,0 +1,74 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RSASigner signs with a PEM encoded RSA private key, as abuild does for apk indexes
+type RSASigner struct {
+	key *rsa.PrivateKey
+	// Name is the file name clients install the public key as
+	Name string
+}
+
+// LoadRSA reads an unencrypted PKCS#1 or PKCS#8 RSA private key, a config
+// without a key file returns a nil RSASigner
+func LoadRSA(config Config) (*RSASigner, error) {
+	if config.KeyFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM encoded key", config.KeyFile)
+	}
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = fmt.Errorf("not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", config.KeyFile, err)
+	}
+	base := filepath.Base(config.KeyFile)
+	name := strings.TrimSuffix(base, filepath.Ext(base)) + ".rsa.pub"
+	return &RSASigner{key: key, Name: name}, nil
+}
+
+// SignSHA1 returns a PKCS#1 v1.5 signature of the SHA-1 digest of content
+func (signer *RSASigner) SignSHA1(content []byte) ([]byte, error) {
+	digest := sha1.Sum(content)
+	return rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA1, digest[:])
+}
+
+// PublicKey returns the PEM encoded public key clients should trust
+func (signer *RSASigner) PublicKey() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(&signer.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
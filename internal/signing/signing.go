@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// Config names the key used to sign repository metadata
+type Config struct {
+	KeyFile    string `yaml:"keyfile"`
+	Passphrase string `yaml:"passphrase"`
+}
+
+// Signer signs with an OpenPGP private key
+type Signer struct {
+	entity *openpgp.Entity
+}
+
+// Load reads an armored OpenPGP private key, a config without a key file
+// returns a nil Signer
+func Load(config Config) (*Signer, error) {
+	if config.KeyFile == "" {
+		return nil, nil
+	}
+	f, err := os.Open(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", config.KeyFile, err)
+	}
+	if len(keys) == 0 || keys[0].PrivateKey == nil {
+		return nil, fmt.Errorf("%s: no private key", config.KeyFile)
+	}
+	entity := keys[0]
+	if entity.PrivateKey.Encrypted {
+		err = entity.DecryptPrivateKeys([]byte(config.Passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", config.KeyFile, err)
+		}
+	}
+	return &Signer{entity: entity}, nil
+}
+
+// ClearSign returns content wrapped in a cleartext signature, as in apt's InRelease
+func (signer *Signer) ClearSign(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	w, err := clearsign.Encode(&buffer, signer.entity.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DetachSign returns an armored detached signature of content
+func (signer *Signer) DetachSign(content []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := openpgp.ArmoredDetachSign(&buffer, signer.entity, bytes.NewReader(content), nil)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// PublicKey returns the armored public key clients should trust
+func (signer *Signer) PublicKey() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	w, err := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = signer.entity.Serialize(w)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
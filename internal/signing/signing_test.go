@@ -0,0 +1,111 @@
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+func writeKey(t *testing.T) (string, openpgp.EntityList) {
+	entity, err := openpgp.NewEntity("dsrepo test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := bytes.Buffer{}
+	w, err := armor.Encode(&buffer, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile := filepath.Join(t.TempDir(), "key.asc")
+	if err = os.WriteFile(keyFile, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyFile, openpgp.EntityList{entity}
+}
+
+func TestSigner(t *testing.T) {
+	keyFile, keyring := writeKey(t)
+	signer, err := Load(Config{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("Origin: test\nSuite: stable\n")
+
+	signed, err := signer.ClearSign(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := clearsign.Decode(signed)
+	if block == nil {
+		t.Fatal("clear signed content could not be decoded")
+	}
+	if _, err = block.VerifySignature(keyring, nil); err != nil {
+		t.Errorf("clear signature does not verify: %v", err)
+	}
+
+	signature, err := signer.DetachSign(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(content), bytes.NewReader(signature), nil); err != nil {
+		t.Errorf("detached signature does not verify: %v", err)
+	}
+
+	public, err := signer.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(public))
+	if err != nil || len(published) != 1 || published[0].PrivateKey != nil {
+		t.Errorf("public key export = %v, %v", published, err)
+	}
+}
+
+func TestLoadWithoutKey(t *testing.T) {
+	signer, err := Load(Config{})
+	if signer != nil || err != nil {
+		t.Errorf("Load without a key file = %v, %v", signer, err)
+	}
+}
+
+func TestRSASigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "packager.rsa")
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadRSA(Config{KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Name != "packager.rsa.pub" {
+		t.Errorf("unexpected key name %q", signer.Name)
+	}
+	signature, err := signer.SignSHA1([]byte("index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha1.Sum([]byte("index"))
+	if err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type Config struct {
+	URL    string   `yaml:"url"`
+	Events []Action `yaml:"events"`
+	Secret string   `yaml:"secret"`
+}
+
+const SignatureHeader = "X-Dsrepo-Signature"
+
+// Sign returns the value of the signature header for a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type Dispatcher struct {
+	Envelope Envelope
+	hooks    []Config
+}
+
+func NewDispatcher(hooks []Config) (*Dispatcher, error) {
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			return nil, fmt.Errorf("webhook without url")
+		}
+		for _, event := range hook.Events {
+			if !slices.Contains([]Action{ActionPush, ActionPull, ActionDelete}, event) {
+				return nil, fmt.Errorf("webhook %s: unknown event %q", hook.URL, event)
+			}
+		}
+	}
+	return &Dispatcher{Envelope: GenericEnvelope, hooks: hooks}, nil
+}
+
+func (d *Dispatcher) wants(action Action) bool {
+	for _, hook := range d.hooks {
+		if len(hook.Events) == 0 || slices.Contains(hook.Events, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) Notify(event *Event) {
+	if d == nil || queue == nil || !d.wants(event.Action) {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	contentType, body, err := d.Envelope(event)
+	if err != nil {
+		slog.Error("webhook:envelope", slog.String("id", event.ID), slog.String("error", err.Error()))
+		return
+	}
+	for _, hook := range d.hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Action) {
+			continue
+		}
+		delivery := &Delivery{
+			ID:     newID(),
+			URL:    hook.URL,
+			Header: http.Header{},
+			Body:   body,
+		}
+		delivery.Header.Set("Content-Type", contentType)
+		if hook.Secret != "" {
+			delivery.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+		}
+		err := queue.Enqueue(delivery)
+		if err != nil {
+			slog.Error("webhook:enqueue", slog.String("url", hook.URL), slog.String("error", err.Error()))
+		}
+	}
+}
+
+var queue *Queue
+
+// SetQueue installs the queue used by all dispatchers. Without one no webhooks are sent.
+func SetQueue(q *Queue) {
+	queue = q
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
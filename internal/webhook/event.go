@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionPush   Action = "push"
+	ActionPull   Action = "pull"
+	ActionDelete Action = "delete"
+)
+
+type Target struct {
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type Request struct {
+	ID        string `json:"id,omitempty"`
+	Addr      string `json:"addr"`
+	Host      string `json:"host"`
+	Method    string `json:"method"`
+	UserAgent string `json:"useragent"`
+}
+
+type Actor struct {
+	Name string `json:"name,omitempty"`
+}
+
+type Event struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Action     Action    `json:"action"`
+	Repository string    `json:"repository"`
+	Type       string    `json:"type"`
+	Target     Target    `json:"target"`
+	Request    Request   `json:"request"`
+	Actor      Actor     `json:"actor"`
+}
+
+// Envelope turns an event into the body posted to a webhook
+type Envelope func(event *Event) (contentType string, body []byte, err error)
+
+func GenericEnvelope(event *Event) (string, []byte, error) {
+	body, err := json.Marshal(struct {
+		Events []*Event `json:"events"`
+	}{Events: []*Event{event}})
+	return "application/json", body, err
+}
+
+type dockerTarget struct {
+	MediaType  string `json:"mediaType,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Length     int64  `json:"length,omitempty"`
+	Repository string `json:"repository"`
+	URL        string `json:"url,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+type dockerSource struct {
+	Addr       string `json:"addr"`
+	InstanceID string `json:"instanceID"`
+}
+
+type dockerEvent struct {
+	ID        string       `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+	Action    Action       `json:"action"`
+	Target    dockerTarget `json:"target"`
+	Request   Request      `json:"request"`
+	Actor     Actor        `json:"actor"`
+	Source    dockerSource `json:"source"`
+}
+
+// DockerEnvelope follows the docker distribution notification format
+func DockerEnvelope(event *Event) (string, []byte, error) {
+	de := dockerEvent{
+		ID:        event.ID,
+		Timestamp: event.Timestamp,
+		Action:    event.Action,
+		Target: dockerTarget{
+			MediaType:  event.Target.MediaType,
+			Size:       event.Target.Size,
+			Digest:     event.Target.Digest,
+			Length:     event.Target.Size,
+			Repository: event.Target.Name,
+			URL:        event.Target.URL,
+			Tag:        event.Target.Tag,
+		},
+		Request: event.Request,
+		Actor:   event.Actor,
+		Source: dockerSource{
+			Addr:       event.Request.Host,
+			InstanceID: event.Repository,
+		},
+	}
+	body, err := json.Marshal(struct {
+		Events []dockerEvent `json:"events"`
+	}{Events: []dockerEvent{de}})
+	return "application/vnd.docker.distribution.events.v1+json", body, err
+}
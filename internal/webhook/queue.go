@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Delivery struct {
+	ID          string      `json:"id"`
+	URL         string      `json:"url"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Attempts    int         `json:"attempts"`
+	NextAttempt time.Time   `json:"next_attempt"`
+}
+
+// Queue delivers webhooks in the background, retrying with backoff. When it has
+// a directory every pending delivery is kept there until it succeeds or gives up,
+// so restarts do not lose notifications.
+type Queue struct {
+	MaxAttempts int
+	Client      *http.Client
+	Logger      *slog.Logger
+
+	dir     string
+	lock    sync.Mutex
+	pending map[string]*Delivery
+	wake    chan struct{}
+}
+
+func NewQueue(dir string) (*Queue, error) {
+	q := &Queue{
+		MaxAttempts: 10,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		Logger:      slog.Default(),
+		dir:         dir,
+		pending:     make(map[string]*Delivery),
+		wake:        make(chan struct{}, 1),
+	}
+	if dir == "" {
+		return q, nil
+	}
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		encoded, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		d := &Delivery{}
+		err = json.Unmarshal(encoded, d)
+		if err != nil {
+			return nil, fmt.Errorf("webhook queue entry %s: %w", entry.Name(), err)
+		}
+		q.pending[d.ID] = d
+	}
+	return q, nil
+}
+
+func (q *Queue) Enqueue(d *Delivery) error {
+	q.lock.Lock()
+	err := q.persist(d)
+	if err == nil {
+		q.pending[d.ID] = d
+	}
+	q.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
+
+func (q *Queue) persist(d *Delivery) error {
+	if q.dir == "" {
+		return nil
+	}
+	encoded, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(q.dir, d.ID+".tmp")
+	err = os.WriteFile(tmp, encoded, 0640)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, d.ID+".json"))
+}
+
+func (q *Queue) forget(d *Delivery) {
+	delete(q.pending, d.ID)
+	if q.dir != "" {
+		os.Remove(filepath.Join(q.dir, d.ID+".json"))
+	}
+}
+
+func (q *Queue) due(now time.Time) []*Delivery {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	due := []*Delivery{}
+	for _, d := range q.pending {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due
+}
+
+// Run delivers pending webhooks until the context is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		for _, d := range q.due(time.Now()) {
+			q.attempt(ctx, d)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *Queue) attempt(ctx context.Context, d *Delivery) {
+	err := q.send(ctx, d)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	d.Attempts++
+	if err == nil {
+		q.forget(d)
+		return
+	}
+	if d.Attempts >= q.MaxAttempts {
+		q.Logger.Error("webhook:abandoned", slog.String("url", d.URL), slog.String("id", d.ID), slog.String("error", err.Error()))
+		q.forget(d)
+		return
+	}
+	backoff := time.Duration(1<<min(d.Attempts, 12)) * time.Second
+	d.NextAttempt = time.Now().Add(backoff)
+	q.Logger.Warn("webhook:retry", slog.String("url", d.URL), slog.String("id", d.ID), slog.Int("attempts", d.Attempts), slog.String("error", err.Error()))
+	err = q.persist(d)
+	if err != nil {
+		q.Logger.Error("webhook:persist", slog.String("id", d.ID), slog.String("error", err.Error()))
+	}
+}
+
+func (q *Queue) send(ctx context.Context, d *Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	for k, v := range d.Header {
+		req.Header[k] = v
+	}
+	response, err := q.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueueDeliversSignedEnvelope(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	q, err := NewQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetQueue(q)
+	defer SetQueue(nil)
+
+	d, err := NewDispatcher([]Config{
+		{URL: server.URL, Events: []Action{ActionPush}, Secret: "s3cret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Envelope = DockerEnvelope
+	d.Notify(&Event{Action: ActionPull, Target: Target{Name: "library/alpine"}})
+	if q.Len() != 0 {
+		t.Fatalf("pull event should have been filtered out")
+	}
+	d.Notify(&Event{Action: ActionPush, Repository: "local-docker", Target: Target{Name: "library/alpine", Tag: "latest", Digest: "sha256:abc", Size: 12}})
+
+	// the first attempt fails, so the delivery must survive a restart
+	ctx, cancel := context.WithCancel(context.Background())
+	q.attempt(ctx, q.due(time.Now())[0])
+	reloaded, err := NewQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Len() != 1 {
+		t.Fatalf("expected 1 persisted delivery, got %d", reloaded.Len())
+	}
+	for _, pending := range reloaded.pending {
+		pending.NextAttempt = time.Time{}
+	}
+	done := make(chan struct{})
+	go func() {
+		reloaded.Run(ctx)
+		close(done)
+	}()
+	// Run must be finished with the queue directory before the test removes it
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if got, want := r.Header.Get(SignatureHeader), Sign("s3cret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/vnd.docker.distribution.events.v1+json" {
+			t.Errorf("content type = %q", ct)
+		}
+		var envelope struct {
+			Events []struct {
+				Action Action `json:"action"`
+				Target struct {
+					Repository string `json:"repository"`
+					Tag        string `json:"tag"`
+					Length     int64  `json:"length"`
+				} `json:"target"`
+			} `json:"events"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if len(envelope.Events) != 1 || envelope.Events[0].Target.Repository != "library/alpine" || envelope.Events[0].Target.Length != 12 {
+			t.Errorf("unexpected envelope %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not redelivered")
+	}
+}